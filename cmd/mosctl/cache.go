@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd 父命令
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Save or load the DNS cache through the mosdns API",
+}
+
+// cacheSaveCmd 导出缓存
+var cacheSaveCmd = &cobra.Command{
+	Use:   "save [file]",
+	Short: "Dump the in-memory cache (default: the configured dump_file)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := ""
+		if len(args) == 1 {
+			path = args[0]
+		}
+		n, err := config.SaveCache(path)
+		if err != nil {
+			fmt.Printf("❌ 保存失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ 缓存已保存 (%d 字节)\n", n)
+	},
+}
+
+// cacheLoadCmd 加载缓存
+var cacheLoadCmd = &cobra.Command{
+	Use:   "load [file]",
+	Short: "Load a cache dump into the running mosdns (default: the configured dump_file)",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := ""
+		if len(args) == 1 {
+			path = args[0]
+		}
+		if err := config.LoadCache(path); err != nil {
+			fmt.Printf("❌ 加载失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✅ 缓存已加载")
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheSaveCmd)
+	cacheCmd.AddCommand(cacheLoadCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
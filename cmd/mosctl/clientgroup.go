@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/clientgroup"
+	"github.com/spf13/cobra"
+)
+
+var flagGroupPolicy string
+
+// clientGroupCmd 父命令
+var clientGroupCmd = &cobra.Command{
+	Use:   "client-group",
+	Short: "Manage per-client policy groups",
+	Long: `Group clients by IP/CIDR and give each group its own policy:
+  default      normal CN/NoCN split
+  local-only   always use the domestic upstreams
+  remote-only  always use the foreign upstream
+  block-ads    normal CN/NoCN split with ad blocking
+  no-aaaa      never return IPv6 addresses
+
+Ad blocking applies to clients outside every group and to block-ads groups;
+members of any other group are exempt. A client in several groups is blocked
+if one of them is block-ads.
+
+Groups are rendered as client_ip matchers in main_sequence right after the
+hosts plugin, in creation order.`,
+}
+
+var clientGroupCreateCmd = &cobra.Command{
+	Use:     "create <name>",
+	Short:   "Create a client group",
+	Example: `  mosctl client-group create kids --policy block-ads`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		policy, err := clientgroup.ParsePolicy(flagGroupPolicy)
+		if err == nil {
+			err = clientgroup.Create(args[0], policy)
+		}
+		if err != nil {
+			fmt.Printf("❌ 创建失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var clientGroupAddCmd = &cobra.Command{
+	Use:     "add <name> <ip_or_cidr>...",
+	Short:   "Add clients to a group",
+	Example: `  mosctl client-group add guest 192.168.30.0/24`,
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := clientgroup.AddMembers(args[0], args[1:]); err != nil {
+			fmt.Printf("❌ 添加失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var clientGroupRemoveCmd = &cobra.Command{
+	Use:   "remove <name> <ip_or_cidr>...",
+	Short: "Remove clients from a group",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := clientgroup.RemoveMembers(args[0], args[1:]); err != nil {
+			fmt.Printf("❌ 删除失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var clientGroupPolicyCmd = &cobra.Command{
+	Use:     "policy <name> <policy>",
+	Short:   "Change the policy of a group",
+	Example: `  mosctl client-group policy tv no-aaaa`,
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		policy, err := clientgroup.ParsePolicy(args[1])
+		if err == nil {
+			err = clientgroup.SetPolicy(args[0], policy)
+		}
+		if err != nil {
+			fmt.Printf("❌ 设置失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var clientGroupDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a group",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := clientgroup.Delete(args[0]); err != nil {
+			fmt.Printf("❌ 删除失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var clientGroupListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List groups, policies and members",
+	Run: func(cmd *cobra.Command, args []string) {
+		groups, err := clientgroup.Load()
+		if err != nil {
+			fmt.Printf("❌ 读取失败: %v\n", err)
+			os.Exit(1)
+		}
+		if len(groups) == 0 {
+			fmt.Println("尚未创建任何客户端分组")
+			return
+		}
+		for _, g := range groups {
+			members, _ := clientgroup.Members(g)
+			fmt.Printf("  %-16s 策略: %-12s 成员: %s\n", g.Name, g.Policy, strings.Join(members, ", "))
+		}
+	},
+}
+
+func init() {
+	clientGroupCreateCmd.Flags().StringVar(&flagGroupPolicy, "policy", string(clientgroup.PolicyDefault), "Group policy")
+
+	clientGroupCmd.AddCommand(clientGroupCreateCmd)
+	clientGroupCmd.AddCommand(clientGroupAddCmd)
+	clientGroupCmd.AddCommand(clientGroupRemoveCmd)
+	clientGroupCmd.AddCommand(clientGroupPolicyCmd)
+	clientGroupCmd.AddCommand(clientGroupDeleteCmd)
+	clientGroupCmd.AddCommand(clientGroupListCmd)
+	rootCmd.AddCommand(clientGroupCmd)
+}
@@ -21,7 +21,7 @@ var flushCmd = &cobra.Command{
 			fmt.Printf("❌ 清空失败: %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Println("✅ 缓存已清空并重启服务")
+		fmt.Println("✅ 缓存已清空")
 	},
 }
 
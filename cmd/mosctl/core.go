@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/core"
+	"github.com/KyleYu2024/mosctl/internal/geo"
+	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var flagCoreProxy string
+
+// coreCmd 管理 mosdns 核心版本
+var coreCmd = &cobra.Command{
+	Use:   "core",
+	Short: "Check, upgrade, downgrade or roll back the mosdns binary",
+	Long: `Manage the mosdns binary (` + config.MosDNSBin + `).
+
+Upgrades download the release asset for this architecture, verify its SHA-256
+when GitHub publishes one, keep the previous binary as ` + core.BackupPath + `
+and swap the new one in atomically. The service is then restarted and probed;
+if the new core does not start with the current config or stops resolving,
+the previous binary is restored automatically.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		proxy := flagCoreProxy
+		if proxy == "" {
+			proxy = geo.Proxy()
+		}
+		if err := service.SetProxy(proxy); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var coreCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Compare the installed mosdns with the latest release",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		current, latest, newer, err := core.Check()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if current == "" {
+			current = "未安装或无法运行"
+		}
+		fmt.Printf("📦 当前版本: %s\n", current)
+		fmt.Printf("🆕 最新版本: %s (%s)\n", latest.Tag, core.AssetName())
+		if newer {
+			fmt.Println("👉 执行 mosctl core upgrade 升级")
+		} else {
+			fmt.Println("✅ 已是最新版本")
+		}
+	},
+}
+
+var coreUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade mosdns to the latest release",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runCoreUpgrade("")
+	},
+}
+
+var coreInstallCmd = &cobra.Command{
+	Use:     "install <version>",
+	Short:   "Install a specific mosdns release (upgrade or downgrade)",
+	Example: "  mosctl core install v5.3.3",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runCoreUpgrade(args[0])
+	},
+}
+
+var coreRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Swap back to the previous mosdns binary",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := core.Rollback(); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func runCoreUpgrade(tag string) {
+	if err := core.Upgrade(tag, geo.Mirrors()); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	coreCmd.PersistentFlags().StringVar(&flagCoreProxy, "proxy", "", "Download through this proxy (e.g. socks5://127.0.0.1:7891)")
+	coreCmd.AddCommand(coreCheckCmd)
+	coreCmd.AddCommand(coreUpgradeCmd)
+	coreCmd.AddCommand(coreInstallCmd)
+	coreCmd.AddCommand(coreRollbackCmd)
+	rootCmd.AddCommand(coreCmd)
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/geo"
+	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/spf13/cobra"
+)
+
+// geoCmd 父命令
+var geoCmd = &cobra.Command{
+	Use:   "geo",
+	Short: "Manage GeoSite/GeoIP data sources",
+}
+
+// geoSourceCmd 管理数据源
+var geoSourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Show or change where each geo list is downloaded from",
+}
+
+var geoSourceListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List geo data sources",
+	Run: func(cmd *cobra.Command, args []string) {
+		sources, err := geo.Sources()
+		if err != nil {
+			fmt.Printf("❌ 读取失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("本地地区: %s\n", geo.Region())
+		fmt.Printf("镜像顺序: %s\n\n", mirrorChain())
+		for _, src := range sources {
+			mark := ""
+			if geo.IsCustom(src.Name) {
+				mark = " [自定义]"
+			} else if src.OnDemand {
+				mark = " [按需]"
+			}
+			fmt.Printf("  %-14s %s%s\n", src.Name, src.URL, mark)
+			if presets := geo.PresetNames(src.Name); len(presets) > 0 {
+				fmt.Printf("  %-14s 可用预设: %s\n", "", strings.Join(presets, ", "))
+			}
+		}
+	},
+}
+
+var geoSourceSetCmd = &cobra.Command{
+	Use:   "set <name> <url|preset>",
+	Short: "Set the download URL of a geo list",
+	Example: `  mosctl geo source set geosite_cn felixonmars
+  mosctl geo source set geoip_cn https://mirror.example.com/cn.txt`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		url, err := geo.SetSource(args[0], args[1])
+		if err != nil {
+			fmt.Printf("❌ 设置失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ %s 已改为 %s，运行 mosctl update 后生效\n", args[0], url)
+	},
+}
+
+var geoSourceResetCmd = &cobra.Command{
+	Use:   "reset [name]",
+	Short: "Restore the default URL of one or all geo lists",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+		if err := geo.ResetSource(name); err != nil {
+			fmt.Printf("❌ 重置失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✅ 已恢复默认数据源")
+	},
+}
+
+// geoMirrorCmd 设置 GitHub 加速前缀的尝试顺序
+var geoMirrorCmd = &cobra.Command{
+	Use:   "mirror [prefix|direct ...|off|default]",
+	Short: "Show or set the ordered GitHub mirror prefixes used for downloads",
+	Long: `Downloads from GitHub try each mirror prefix in order until one succeeds.
+The mirror that worked last time is tried first on the next update.
+Use "direct" for a plain GitHub connection, "off" to only connect directly,
+and "default" to restore the built-in order.`,
+	Example: `  mosctl geo mirror https://my-mirror.example.com/ https://gh-proxy.com/ direct
+  mosctl geo mirror off        # Reach GitHub directly
+  mosctl geo mirror default`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Printf("镜像顺序: %s\n", mirrorChain())
+			return
+		}
+		if err := geo.SetMirrors(args); err != nil {
+			fmt.Printf("❌ 设置失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ 镜像顺序已保存: %s\n", mirrorChain())
+	},
+}
+
+// geoProxyCmd 设置下载代理
+var geoProxyCmd = &cobra.Command{
+	Use:   "proxy [url|off]",
+	Short: "Show or set the proxy used for downloads (http://, socks5://)",
+	Long: `Without a saved proxy, downloads honour HTTP_PROXY, HTTPS_PROXY, ALL_PROXY and NO_PROXY.
+A proxy passed with "mosctl update --proxy" takes precedence over the saved one.`,
+	Example: `  mosctl geo proxy socks5://127.0.0.1:7891
+  mosctl geo proxy off`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			if p := geo.Proxy(); p != "" {
+				fmt.Printf("当前代理: %s\n", p)
+			} else {
+				fmt.Println("未设置代理 (使用 HTTP_PROXY/HTTPS_PROXY/ALL_PROXY 环境变量)")
+			}
+			return
+		}
+		if err := geo.SetProxy(args[0]); err != nil {
+			fmt.Printf("❌ 设置失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✅ 代理设置已保存")
+	},
+}
+
+var (
+	flagExtractOutput  string
+	flagExtractRefresh bool
+)
+
+// geoExtractCmd 从 geosite.dat / geoip.dat 导出分类
+var geoExtractCmd = &cobra.Command{
+	Use:   "extract <category>",
+	Short: "Extract a v2ray geosite/geoip category as a MosDNS rule file",
+	Long: `Extract a category from geosite.dat or geoip.dat (downloaded on first use) and
+write it as a MosDNS domain_set / ip_set file. By default the file goes to
+/etc/mosdns/rules/<category>.txt; use -o - to print to stdout.`,
+	Example: `  mosctl geo extract geosite:netflix
+  mosctl geo extract geosite:category-games@cn -o /tmp/games.txt
+  mosctl geo extract geoip:private -o -`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := geo.ParseCategory(args[0])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if err := geo.EnsureDat(c.Dat, flagExtractRefresh); err != nil {
+			fmt.Printf("❌ 下载 %s.dat 失败: %v\n", c.Dat, err)
+			os.Exit(1)
+		}
+		rules, err := geo.Extract(c)
+		if err != nil {
+			fmt.Printf("❌ 导出失败: %v\n", err)
+			os.Exit(1)
+		}
+		if flagExtractOutput == "-" {
+			for _, r := range rules {
+				fmt.Println(r)
+			}
+			return
+		}
+		out := flagExtractOutput
+		if out == "" {
+			out = filepath.Join(config.RuleDir, c.FileName())
+		}
+		if _, err := geo.WriteList(out, rules); err != nil {
+			fmt.Printf("❌ 写入失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ 已导出 %s 共 %d 条到 %s\n", c, len(rules), out)
+	},
+}
+
+// geoCategoriesCmd 列出 dat 中的分类
+var geoCategoriesCmd = &cobra.Command{
+	Use:   "categories <geosite|geoip> [keyword]",
+	Short: "List categories available in geosite.dat or geoip.dat",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		dat := args[0]
+		if dat != geo.DatGeoSite && dat != geo.DatGeoIP {
+			fmt.Println("❌ 只能是 geosite 或 geoip")
+			os.Exit(1)
+		}
+		if err := geo.EnsureDat(dat, false); err != nil {
+			fmt.Printf("❌ 下载 %s.dat 失败: %v\n", dat, err)
+			os.Exit(1)
+		}
+		names, err := geo.Categories(dat)
+		if err != nil {
+			fmt.Printf("❌ 读取失败: %v\n", err)
+			os.Exit(1)
+		}
+		for _, name := range names {
+			if len(args) == 2 && !strings.Contains(name, strings.ToLower(args[1])) {
+				continue
+			}
+			fmt.Printf("%s:%s\n", dat, name)
+		}
+	},
+}
+
+// geoBindCmd 把分类绑定到分流分支
+var geoBindCmd = &cobra.Command{
+	Use:   "bind <category> <local|remote|block>",
+	Short: "Route a geosite/geoip category through a branch",
+	Long: `Bind a category to a routing branch. The category is extracted into a rule file
+that the branch's matcher loads, and is re-extracted on every mosctl update.
+
+  local   Resolve with the domestic upstreams (geoip categories extend geoip_cn)
+  remote  Resolve with the foreign upstream
+  block   Block like an ad/tracker domain`,
+	Example: `  mosctl geo bind geosite:netflix remote
+  mosctl geo bind geosite:category-games@cn local
+  mosctl geo bind geoip:private local`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		branch, err := geo.ParseBranch(args[1])
+		if err == nil {
+			err = geo.Bind(args[0], branch)
+		}
+		if err != nil {
+			fmt.Printf("❌ 绑定失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var geoUnbindCmd = &cobra.Command{
+	Use:   "unbind <category>",
+	Short: "Remove a category binding",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := geo.Unbind(args[0]); err != nil {
+			fmt.Printf("❌ 解除绑定失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var geoBindingsCmd = &cobra.Command{
+	Use:   "bindings",
+	Short: "List category bindings",
+	Run: func(cmd *cobra.Command, args []string) {
+		bindings, err := geo.Bindings()
+		if err != nil {
+			fmt.Printf("❌ 读取失败: %v\n", err)
+			os.Exit(1)
+		}
+		if len(bindings) == 0 {
+			fmt.Println("暂无分类绑定")
+			return
+		}
+		for _, b := range bindings {
+			fmt.Printf("  %-40s → %s\n", b.Category, b.Branch)
+		}
+	},
+}
+
+// geoRegionCmd 选择本地地区
+var geoRegionCmd = &cobra.Command{
+	Use:   "region [cc]",
+	Short: "Show or choose the country treated as \"local\"",
+	Long: `Choose which country the domestic branch represents. Only geosite_cn.txt
+decides the split: it holds the region's ccTLD plus the matching geosite.dat
+category when one exists, and every other domain goes to the remote upstream.
+geosite_apple.txt and geosite_no_cn.txt only make sense for mainland China and
+are emptied for other regions. geoip_cn.txt is only used by the Apple split, so
+it is left unchanged and has no effect outside mainland China.
+File names and config.yaml stay the same. Sources customised with
+"mosctl geo source set" are left untouched.`,
+	Example: `  mosctl geo region hk
+  mosctl geo region cn   # Back to mainland China`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Printf("当前本地地区: %s\n", geo.Region())
+			return
+		}
+		skipped, err := geo.SetRegion(args[0])
+		if err != nil {
+			fmt.Printf("❌ 设置失败: %v\n", err)
+			os.Exit(1)
+		}
+		region := geo.Region()
+		fmt.Printf("✅ 本地地区已设为 %s\n", region)
+		for _, name := range skipped {
+			fmt.Printf("⚠️  %s 使用自定义数据源，未随地区切换 (可用 mosctl geo source reset %s 恢复)\n", name, name)
+		}
+		if region != geo.DefaultRegion {
+			if name, ok := geo.RegionCategory(region); ok {
+				fmt.Printf("📋 本地域名: .%s 顶级域名 + geosite:%s\n", region, name)
+			} else {
+				fmt.Printf("⚠️  geosite.dat 中没有 %s 的分类，本地域名只包含 .%s 顶级域名\n", region, region)
+			}
+			fmt.Println("📋 只有本地域名列表 (geosite_cn) 随地区切换，未命中的域名交给国外上游")
+			fmt.Println("💡 别忘了用 mosctl upstream --local <地址> 把国内上游换成当地的 DNS")
+		}
+
+		// 列表规模会随地区变化，跳过缩水检查
+		fmt.Println("⬇️  正在按新地区更新规则...")
+		if err := geo.Update(geo.Options{Force: true}); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✅ 规则更新完毕！")
+	},
+}
+
+var flagHistoryCount int
+
+// geoHistoryCmd 显示更新记录
+var geoHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show recent geo updates with per-file change reports",
+	Run: func(cmd *cobra.Command, args []string) {
+		runs, err := geo.History()
+		if err != nil {
+			fmt.Printf("❌ 读取失败: %v\n", err)
+			os.Exit(1)
+		}
+		if len(runs) == 0 {
+			fmt.Println("暂无更新记录")
+			return
+		}
+		if flagHistoryCount > 0 && len(runs) > flagHistoryCount {
+			runs = runs[len(runs)-flagHistoryCount:]
+		}
+		for i := len(runs) - 1; i >= 0; i-- {
+			printRun(runs[i])
+		}
+	},
+}
+
+func printRun(run geo.Run) {
+	status := "✅ 成功"
+	if !run.OK {
+		status = "❌ " + run.Error
+	}
+	if run.Restarted {
+		status += "，已重启 MosDNS"
+	}
+	if run.From != "" {
+		status += " (离线包 " + run.From + ")"
+	}
+	fmt.Printf("%s  %s\n", run.Time.Local().Format("2006-01-02 15:04:05"), status)
+	for _, f := range run.Files {
+		// 只有下载或离线包中的文件才有大小与来源，派生文件只显示哈希
+		detail := shortHash(f.SHA256)
+		if f.Bytes > 0 {
+			detail = fmt.Sprintf("%-8s %s  %s", config.FormatSize(f.Bytes), detail, service.MirrorName(f.Mirror))
+		}
+		if f.RolledBack {
+			detail += "  ↩️ 已回滚"
+		}
+		switch {
+		case f.Error != "":
+			fmt.Printf("  %-14s ❌ %s\n", f.Name, f.Error)
+		case f.Changed && f.Entries == 0:
+			// mosdns 本体等没有条目的文件
+			fmt.Printf("  %-14s 已替换                       %s\n", f.Name, detail)
+		case f.Changed:
+			fmt.Printf("  %-14s +%-6d -%-6d %7d 条  %s\n", f.Name, f.Added, f.Removed, f.Entries, detail)
+		default:
+			fmt.Printf("  %-14s 无变化       %7d 条\n", f.Name, f.Entries)
+		}
+	}
+	fmt.Println()
+}
+
+func shortHash(sum string) string {
+	if len(sum) > 12 {
+		return sum[:12]
+	}
+	return sum
+}
+
+// geoDiffCmd 显示文件相对上一版本的增删
+var geoDiffCmd = &cobra.Command{
+	Use:   "diff <file>",
+	Short: "Show entries added and removed by the last update of a file",
+	Example: `  mosctl geo diff geosite_cn
+  mosctl geo diff geoip_cn.txt`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		src, err := geo.FindSource(args[0])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if run, ok := geo.LastRun(); ok {
+			for _, f := range run.Files {
+				if f.Name == src.Name && f.URL != "" {
+					fmt.Printf("# 最近一次更新: %s  来源: %s\n", run.Time.Local().Format("2006-01-02 15:04"), f.URL)
+				}
+			}
+		}
+		added, removed, err := geo.Diff(src)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("# %s: +%d -%d\n", src.Name, len(added), len(removed))
+		for _, e := range added {
+			fmt.Println("+ " + e)
+		}
+		for _, e := range removed {
+			fmt.Println("- " + e)
+		}
+	},
+}
+
+// mirrorChain 以 "a → b → 直连" 的形式显示镜像顺序，并标出上次成功的镜像
+func mirrorChain() string {
+	last, ok := geo.LastMirror()
+	var names []string
+	for _, m := range geo.Mirrors() {
+		name := service.MirrorName(m)
+		if ok && m == last {
+			name += " (上次可用)"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, " → ")
+}
+
+func init() {
+	geoSourceCmd.AddCommand(geoSourceListCmd)
+	geoSourceCmd.AddCommand(geoSourceSetCmd)
+	geoSourceCmd.AddCommand(geoSourceResetCmd)
+	geoCmd.AddCommand(geoSourceCmd)
+	geoCmd.AddCommand(geoMirrorCmd)
+	geoCmd.AddCommand(geoProxyCmd)
+	geoCmd.AddCommand(geoRegionCmd)
+	geoHistoryCmd.Flags().IntVarP(&flagHistoryCount, "count", "n", 10, "Number of updates to show (0 for all)")
+	geoCmd.AddCommand(geoHistoryCmd)
+	geoCmd.AddCommand(geoDiffCmd)
+	geoExtractCmd.Flags().StringVarP(&flagExtractOutput, "output", "o", "", "Output file (- for stdout)")
+	geoExtractCmd.Flags().BoolVar(&flagExtractRefresh, "refresh", false, "Check for a newer dat file before extracting")
+	geoCmd.AddCommand(geoExtractCmd)
+	geoCmd.AddCommand(geoCategoriesCmd)
+	geoCmd.AddCommand(geoBindCmd)
+	geoCmd.AddCommand(geoUnbindCmd)
+	geoCmd.AddCommand(geoBindingsCmd)
+	rootCmd.AddCommand(geoCmd)
+}
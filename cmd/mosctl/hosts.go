@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/KyleYu2024/mosctl/internal/rule"
+	"github.com/spf13/cobra"
+)
+
+// hostsCmd 父命令
+var hostsCmd = &cobra.Command{
+	Use:   "hosts",
+	Short: "Manage custom hosts (hosts.txt)",
+	Long:  `Add, remove, list and import static records served by the mosdns hosts plugin.`,
+}
+
+// hostsAddCmd 是 'hosts add' 子命令
+var hostsAddCmd = &cobra.Command{
+	Use:   "add <domain> <ip...>",
+	Short: "Add a hosts record (addresses are merged into existing names)",
+	Example: `  mosctl hosts add nas.lan 192.168.1.10
+  mosctl hosts add domain:home.arpa 192.168.1.1 fd00::1
+  mosctl hosts add full:router.lan 10.0.0.1`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := rule.AddHost(args[0], args[1:]); err != nil {
+			fmt.Printf("❌ 添加失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// hostsRemoveCmd 是 'hosts remove' 子命令
+var hostsRemoveCmd = &cobra.Command{
+	Use:     "remove <domain> [ip...]",
+	Aliases: []string{"rm"},
+	Short:   "Remove a hosts record, or only the given addresses",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := rule.RemoveHost(args[0], args[1:]); err != nil {
+			fmt.Printf("❌ 删除失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// hostsListCmd 是 'hosts list' 子命令
+var hostsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List hosts records and report invalid or shadowed lines",
+	Run: func(cmd *cobra.Command, args []string) {
+		if ok := printHosts(); !ok {
+			os.Exit(1)
+		}
+	},
+}
+
+// hostsImportCmd 是 'hosts import' 子命令
+var hostsImportCmd = &cobra.Command{
+	Use:     "import <file>",
+	Short:   "Import records from an /etc/hosts style file",
+	Example: `  mosctl hosts import /etc/hosts`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		n, err := rule.ImportHosts(args[0])
+		if err != nil {
+			fmt.Printf("❌ 导入失败: %v\n", err)
+			os.Exit(1)
+		}
+		if n == 0 {
+			fmt.Println("⚠️  没有可导入的新记录")
+			return
+		}
+		fmt.Printf("✅ 已导入 %d 条记录\n", n)
+	},
+}
+
+// printHosts 打印 hosts 记录，存在格式错误时返回 false
+func printHosts() bool {
+	entries, problems, err := rule.LoadHosts()
+	if err != nil {
+		fmt.Printf("❌ 读取失败: %v\n", err)
+		return false
+	}
+	if len(entries) == 0 && len(problems) == 0 {
+		fmt.Println("hosts.txt 为空")
+		return true
+	}
+
+	shadowed := rule.ShadowedHosts(entries)
+	for i, e := range entries {
+		if j, ok := shadowed[i]; ok {
+			fmt.Printf("  %4d  %s   ⚠️  被第 %d 行的同名记录覆盖，不会生效\n", e.Line, e, entries[j].Line)
+			continue
+		}
+		fmt.Printf("  %4d  %s\n", e.Line, e)
+	}
+	for _, p := range problems {
+		fmt.Printf("  ❌ %v\n", p)
+	}
+	return len(problems) == 0
+}
+
+func init() {
+	hostsCmd.AddCommand(hostsAddCmd)
+	hostsCmd.AddCommand(hostsRemoveCmd)
+	hostsCmd.AddCommand(hostsListCmd)
+	hostsCmd.AddCommand(hostsImportCmd)
+	rootCmd.AddCommand(hostsCmd)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/KyleYu2024/mosctl/internal/install"
+	"github.com/spf13/cobra"
+)
+
+var installOpts install.Options
+
+// installCmd 代表 install 命令
+var installCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install or repair MosDNS, its service files, rules and config",
+	Long: `Install MosDNS on this machine: dependencies, the mosdns release for this
+architecture (SHA-256 verified when GitHub publishes a digest), mosctl itself,
+config.yaml, service files for systemd / OpenRC / runit / s6, rules, the update
+schedule, the upstream wizard and, on systemd, the health watchdog.
+
+Every step checks the current state first, so running it again repairs a
+broken install without touching your rules or a valid config.yaml.`,
+	Example: `  mosctl install
+  mosctl install --remote 10.10.2.252:53 -y
+  mosctl install --mirror direct --proxy socks5://127.0.0.1:7891
+  mosctl install --mosdns-version v5.3.3`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := install.Run(installOpts); err != nil {
+			fmt.Printf("❌ 安装失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	installCmd.Flags().StringVar(&installOpts.MosDNSVersion, "mosdns-version", "", "Install this mosdns release instead of the latest (e.g. v5.3.3)")
+	installCmd.Flags().StringVar(&installOpts.Remote, "remote", "", "Foreign upstream DNS, skips the wizard (e.g. 10.10.2.252:53)")
+	installCmd.Flags().BoolVarP(&installOpts.Yes, "yes", "y", false, "Do not ask questions, keep the upstreams in config.yaml")
+	installCmd.Flags().StringSliceVar(&installOpts.Mirrors, "mirror", nil, "GitHub mirror prefixes to try in order, \"direct\" for no mirror")
+	installCmd.Flags().StringVar(&installOpts.Proxy, "proxy", "", "Download through this proxy and keep it for mosctl update")
+	installCmd.Flags().BoolVar(&installOpts.SkipPackages, "skip-packages", false, "Do not install dependencies with the package manager")
+	installCmd.Flags().BoolVar(&installOpts.NoWatchdog, "no-watchdog", false, "Do not enable the mosctl watchdog service (systemd)")
+	rootCmd.AddCommand(installCmd)
+}
@@ -8,7 +8,10 @@ import (
 	"strings"
 
 	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/geo"
+	"github.com/KyleYu2024/mosctl/internal/install"
 	"github.com/KyleYu2024/mosctl/internal/rule"
+	"github.com/KyleYu2024/mosctl/internal/selfupdate"
 	"github.com/KyleYu2024/mosctl/internal/service"
 	"github.com/spf13/cobra"
 )
@@ -29,35 +32,39 @@ var rootCmd = &cobra.Command{
 
 func showMenu() {
 	scanner := bufio.NewScanner(os.Stdin)
+	refreshLatest()
 	for {
 		fmt.Println("\033[0;32m=====================================\033[0m")
-		fmt.Println("\033[0;32m         MosDNS 管理面板 [0.5.2]      \033[0m")
+		fmt.Printf("\033[0;32m         MosDNS 管理面板 [%s]      \033[0m\n", strings.TrimPrefix(version, "v"))
+		if latest, _ := selfupdate.Cached(); selfupdate.Newer(latest, version) {
+			fmt.Printf("\033[1;33m   🆕 mosctl %s 可用 (mosctl self-update)\033[0m\n", latest)
+		}
 		fmt.Println("\033[0;32m=====================================\033[0m")
 
 		
-		status := "🟢 运行中"
-		if exec.Command("systemctl", "is-active", "mosdns").Run() != nil {
-			status = "🔴 未运行"
+		status := "🔴 未运行"
+		if st, err := service.GetStatus(); err == nil {
+			status = st.Summary()
 		}
 
-		version := "未知"
+		coreVersion := "未知"
 		vCmd := exec.Command("/usr/local/bin/mosdns", "version")
 		if vOut, err := vCmd.Output(); err == nil {
 			vStr := strings.TrimSpace(string(vOut))
 			vStr = strings.TrimPrefix(vStr, "mosdns")
 			vStr = strings.TrimSpace(vStr)
 			if vStr != "" {
-				version = vStr
+				coreVersion = vStr
 			}
 		}
 
 		hitRate := config.GetCacheHitRate()
-		lastUpdate := config.GetLastUpdate()
-		fmt.Printf(" 状态: %s | 核心: %s | 命中率: %s\n", status, version, hitRate)
+		lastUpdate := geo.LastUpdateSummary(config.GetLastUpdate())
+		fmt.Printf(" 状态: %s | 核心: %s | 命中率: %s\n", status, coreVersion, hitRate)
 		fmt.Println("\033[0;32m=====================================\033[0m")
 		fmt.Println(" [1] 服务管理 (启动/停止/重启)")
 		fmt.Println(" [2] 参数设置 (上游/缓存/TTL)")
-		fmt.Println(" [3] 规则管理 (强制国内/国外/IoT)")
+		fmt.Println(" [3] 规则管理 (强制国内/国外/IoT/拦截)")
 		fmt.Printf(" [4] 更新 Geo 数据库 (上次: %s)\n", lastUpdate)
 		fmt.Println(" [5] 救援模式管理")
 		fmt.Println(" [6] 日志管理中心")
@@ -88,11 +95,7 @@ func showMenu() {
 		case "7":
 			config.RunTest()
 		case "8":
-			fmt.Print("⚠️  高危操作：确定要彻底卸载 MosDNS 吗？(y/n): ")
-			scanner.Scan()
-			if strings.ToLower(scanner.Text()) == "y" {
-				uninstall()
-			}
+			uninstall()
 		case "0":
 			os.Exit(0)
 		default:
@@ -153,6 +156,11 @@ func logMenu(scanner *bufio.Scanner) {
 
 func serviceMenu(scanner *bufio.Scanner) {
 	fmt.Println("\n--- 服务管理 ---")
+	if st, err := service.GetStatus(); err == nil {
+		printServiceStatus(st)
+	} else {
+		fmt.Printf("  ⚠️  无法获取服务状态: %v\n", err)
+	}
 	fmt.Println("  1. ▶️  启动服务")
 	fmt.Println("  2. ⏹️  停止服务")
 	fmt.Println("  3. 🔄  重启服务")
@@ -161,14 +169,43 @@ func serviceMenu(scanner *bufio.Scanner) {
 	scanner.Scan()
 	switch scanner.Text() {
 	case "1":
-		exec.Command("systemctl", "start", "mosdns").Run()
-		fmt.Println("✅ 已发送启动指令")
+		if err := service.StartService(); err != nil {
+			fmt.Printf("❌ 启动失败: %v\n", err)
+			return
+		}
+		fmt.Println("✅ 服务已启动")
 	case "2":
-		exec.Command("systemctl", "stop", "mosdns").Run()
-		fmt.Println("🛑 已发送停止指令")
+		if err := service.StopService(); err != nil {
+			fmt.Printf("❌ 停止失败: %v\n", err)
+			return
+		}
+		fmt.Println("🛑 服务已停止")
 	case "3":
-		service.RestartService()
-		fmt.Println("✅ 已发送重启指令")
+		if err := service.RestartService(); err != nil {
+			fmt.Printf("❌ 重启失败: %v\n", err)
+			return
+		}
+		fmt.Println("✅ 服务已重启")
+	}
+}
+
+// printServiceStatus 输出服务的详细状态，未运行时显示原因
+func printServiceStatus(st service.UnitStatus) {
+	fmt.Printf("  状态: %s (%s/%s，%s)\n", st.Summary(), st.ActiveState, st.SubState, st.Via)
+	if st.Active() {
+		fmt.Printf("  PID: %d | 已运行: %s", st.MainPID, st.Uptime())
+		if st.Memory > 0 {
+			fmt.Printf(" | 内存: %s", config.FormatSize(int64(st.Memory)))
+		}
+		fmt.Println()
+	} else if !st.Since.IsZero() {
+		fmt.Printf("  停止于: %s\n", st.Since.Local().Format("2006-01-02 15:04:05"))
+	}
+	if st.Restarts > 0 {
+		fmt.Printf("  自动重启: %d 次\n", st.Restarts)
+	}
+	if st.ExitCode != "" && (st.ExitCode != "exited" || st.ExitStatus != 0) {
+		fmt.Printf("  上次退出: %s\n", st.Reason())
 	}
 }
 
@@ -212,16 +249,12 @@ func rescueMenu(scanner *bufio.Scanner) {
 	}
 }
 
+// uninstall 预览卸载操作，确认后还原安装时对系统的修改
 func uninstall() {
-	fmt.Println("⏳ 正在彻底卸载...")
-	exec.Command("systemctl", "stop", "mosdns").Run()
-	exec.Command("systemctl", "disable", "mosdns").Run()
-	os.Remove("/etc/systemd/system/mosdns.service")
-	os.Remove("/etc/systemd/system/mosdns-rescue.service")
-	os.RemoveAll("/etc/mosdns")
-	os.Remove("/usr/local/bin/mosdns")
-	os.Remove("/usr/local/bin/mosctl")
-	fmt.Println("✅ 卸载完成。")
+	if err := install.Uninstall(install.UninstallOptions{}); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
 	os.Exit(0)
 }
 
@@ -233,13 +266,16 @@ func rulesMenu(scanner *bufio.Scanner) {
 	fmt.Println("  1. 🇨🇳 添加域名 -> 强制国内 (Force CN)")
 	fmt.Println("  2. 🌍 添加域名 -> 强制国外 (Force NoCN)")
 	fmt.Println("  3. 🔌 添加 IP/CIDR -> 智能家居 (IoT)")
-	fmt.Println("  4. 📝 手动编辑规则文件 (Nano)")
+	fmt.Println("  4. 🚫 添加域名 -> 广告拦截 (Block)")
+	fmt.Println("  5. ✅ 添加域名 -> 拦截白名单 (Allow)")
+	fmt.Println("  6. 📝 手动编辑规则文件 (Nano)")
+	fmt.Println("  7. 🔍 检查规则冲突与冗余")
 	fmt.Println("  0. 🔙  返回")
 	fmt.Print("请选择: ")
 	scanner.Scan()
 	sel := scanner.Text()
 	
-	if sel == "1" || sel == "2" || sel == "3" {
+	if sel == "1" || sel == "2" || sel == "3" || sel == "4" || sel == "5" {
 		fmt.Print("请输入内容 (域名或 IP): ")
 		scanner.Scan()
 		content := strings.TrimSpace(scanner.Text())
@@ -252,16 +288,24 @@ func rulesMenu(scanner *bufio.Scanner) {
 			err = rule.AddRule(content, rule.TypeForceCN)
 		} else if sel == "2" {
 			err = rule.AddRule(content, rule.TypeForceNoCN)
-		} else {
+		} else if sel == "3" {
 			err = rule.AddRule(content, rule.TypeIoT)
+		} else if sel == "4" {
+			err = rule.AddRule(content, rule.TypeBlock)
+		} else {
+			err = rule.AddRule(content, rule.TypeAllow)
 		}
 		
 		if err != nil {
 			fmt.Printf("❌ 失败: %v\n", err)
 		}
-	} else if sel == "4" {
+	} else if sel == "6" {
 		// 手动编辑子菜单
 		manualEditMenu(scanner)
+	} else if sel == "7" {
+		if err := auditRules(scanner, false); err != nil {
+			fmt.Printf("❌ 检查失败: %v\n", err)
+		}
 	}
 }
 
@@ -271,6 +315,8 @@ func manualEditMenu(scanner *bufio.Scanner) {
 	fmt.Println("  2. 🌍 强制国外名单 (force-nocn.txt)")
 	fmt.Println("  3. 🔌 智能家居名单 (user_iot.txt)")
 	fmt.Println("  4. 📔 自定义 Hosts (hosts.txt)")
+	fmt.Println("  5. 🚫 广告拦截名单 (block.txt)")
+	fmt.Println("  6. ✅ 拦截白名单 (block-allow.txt)")
 	fmt.Println("  0. 🔙  返回")
 	fmt.Print("请选择: ")
 	scanner.Scan()
@@ -284,7 +330,11 @@ func manualEditMenu(scanner *bufio.Scanner) {
 	case "3":
 		fileToEdit = rule.PathIoT
 	case "4":
-		fileToEdit = "/etc/mosdns/rules/hosts.txt"
+		fileToEdit = rule.PathHosts
+	case "5":
+		fileToEdit = rule.PathBlock
+	case "6":
+		fileToEdit = rule.PathAllow
 	case "0":
 		return
 	default:
@@ -308,11 +358,25 @@ func manualEditMenu(scanner *bufio.Scanner) {
 	if err := cmd.Run(); err != nil {
 		fmt.Printf("❌ 编辑出错 (请确保系统已安装 nano): %v\n", err)
 	} else {
+		// hosts 格式错误会导致 MosDNS 无法启动，重启前先校验
+		prompt := "❓ 是否重启 MosDNS 以应用更改? (Y/n): "
+		defaultYes := true
+		if fileToEdit == rule.PathHosts {
+			if problems, err := rule.ValidateHosts(); err == nil && len(problems) > 0 {
+				fmt.Println("⚠️  hosts.txt 存在格式错误，重启后 MosDNS 可能无法启动:")
+				for _, p := range problems {
+					fmt.Printf("  ❌ %v\n", p)
+				}
+				prompt = "❓ 仍然重启 MosDNS? (y/N): "
+				defaultYes = false
+			}
+		}
+
 		// 编辑完成后询问重启
-		fmt.Print("❓ 是否重启 MosDNS 以应用更改? (Y/n): ")
+		fmt.Print(prompt)
 		scanner.Scan()
 		ans := strings.ToLower(strings.TrimSpace(scanner.Text()))
-		if ans == "" || ans == "y" {
+		if ans == "y" || (ans == "" && defaultYes) {
 			if err := service.RestartService(); err != nil {
 				fmt.Printf("❌ 重启失败: %v\n", err)
 			} else {
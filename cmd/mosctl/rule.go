@@ -1,71 +1,407 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/KyleYu2024/mosctl/internal/config"
 	"github.com/KyleYu2024/mosctl/internal/rule"
 	"github.com/spf13/cobra"
 )
 
 var (
-	flagDirect bool
-	flagProxy  bool
-	flagIot    bool
+	flagDirect    bool
+	flagProxy     bool
+	flagIot       bool
+	flagBlock     bool
+	flagAllow     bool
+	flagFix       bool
+	flagNote      string
+	flagExpires   string
+	flagFromStdin bool
 )
 
 // ruleCmd 是父命令
 var ruleCmd = &cobra.Command{
 	Use:   "rule",
 	Short: "Manage custom rules",
-	Long:  `Add domains or IPs to custom lists (Force CN, Force NoCN, IoT).`,
+	Long:  `Add domains or IPs to custom lists (Force CN, Force NoCN, IoT, Block, Allow).`,
 }
 
 // ruleAddCmd 是 'rule add' 子命令
 var ruleAddCmd = &cobra.Command{
-	Use:   "add <domain_or_ip>",
-	Short: "Add a rule",
+	Use:   "add <domain_or_ip>...",
+	Short: "Add one or more rules (restarts MosDNS once)",
 	Example: `  mosctl rule add example.com --direct   # Force Domestic
   mosctl rule add google.com --proxy     # Force Foreign
-  mosctl rule add 10.10.1.0/25 --iot     # Smart Home Bypass`,
-	Args: cobra.ExactArgs(1),
+  mosctl rule add 10.10.1.0/25 --iot     # Smart Home Bypass
+  mosctl rule add ads.example.com --block # Block (NXDOMAIN / 0.0.0.0)
+  mosctl rule add t.example.com --allow  # Exempt from blocking
+  mosctl rule add xx.com -p --note "vendor API" --expires 7d
+  cat domains.txt | mosctl rule add --proxy --from-stdin`,
 	Run: func(cmd *cobra.Command, args []string) {
-		content := args[0]
+		rType := mustSingleType(cmd)
 
-		// 互斥检查
-		count := 0
-		if flagDirect { count++ }
-		if flagProxy { count++ }
-		if flagIot { count++ }
+		expires, err := rule.ParseExpiry(flagExpires, time.Now())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		entries := collectEntries(cmd, args)
+		meta := rule.NewMeta(flagNote, expires)
+		tx := rule.Begin()
+		for _, e := range entries {
+			tx.Add(e, rType, meta)
+		}
+		results, err := tx.Commit()
+		exitOnFailures(results, err, "添加失败")
+
+		if (flagBlock || flagAllow) && !config.BlockEnabled() {
+			fmt.Println("⚠️  当前 config.yaml 未包含拦截模块 (# TAG_BLOCK)，规则暂不会生效")
+		}
+	},
+}
+
+// ruleRemoveCmd 是 'rule remove' 子命令
+var ruleRemoveCmd = &cobra.Command{
+	Use:     "remove <domain_or_ip>...",
+	Aliases: []string{"rm"},
+	Short:   "Remove one or more rules (restarts MosDNS once)",
+	Example: `  mosctl rule remove example.com --direct
+  cat old.txt | mosctl rule remove --proxy --from-stdin`,
+	Run: func(cmd *cobra.Command, args []string) {
+		rType := mustSingleType(cmd)
+
+		tx := rule.Begin()
+		for _, e := range collectEntries(cmd, args) {
+			tx.Remove(e, rType)
+		}
+		results, err := tx.Commit()
+		exitOnFailures(results, err, "删除失败")
+	},
+}
 
-		if count != 1 {
-			fmt.Println("❌ 错误: 请明确指定且仅指定一种类型: --direct (-d), --proxy (-p) 或 --iot (-i)")
-			cmd.Usage()
+// mustSingleType 互斥检查：必须且只能指定一种规则类型
+func mustSingleType(cmd *cobra.Command) rule.RuleType {
+	types := selectedTypes()
+	if len(types) != 1 {
+		fmt.Println("❌ 错误: 请明确指定且仅指定一种类型: --direct (-d), --proxy (-p), --iot (-i), --block (-b) 或 --allow (-a)")
+		cmd.Usage()
+		os.Exit(1)
+	}
+	return types[0]
+}
+
+// collectEntries 合并命令行参数与标准输入中的条目 (忽略空行和注释)
+func collectEntries(cmd *cobra.Command, args []string) []string {
+	entries := append([]string{}, args...)
+	if flagFromStdin {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Printf("❌ 读取标准输入失败: %v\n", err)
 			os.Exit(1)
 		}
+	}
+	if len(entries) == 0 {
+		fmt.Println("❌ 错误: 请至少提供一条规则")
+		cmd.Usage()
+		os.Exit(1)
+	}
+	return entries
+}
+
+// exitOnFailures 汇总事务结果，有任何条目失败时以非零状态退出
+func exitOnFailures(results []rule.Result, err error, action string) {
+	if err != nil {
+		fmt.Printf("❌ %s: %v\n", action, err)
+		os.Exit(1)
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("⚠️  共 %d 条，其中 %d 条失败\n", len(results), failed)
+		os.Exit(1)
+	}
+}
+
+// selectedTypes 根据类型参数返回选中的规则列表
+func selectedTypes() []rule.RuleType {
+	var types []rule.RuleType
+	for _, item := range []struct {
+		set   bool
+		rType rule.RuleType
+	}{
+		{flagDirect, rule.TypeForceCN},
+		{flagProxy, rule.TypeForceNoCN},
+		{flagIot, rule.TypeIoT},
+		{flagBlock, rule.TypeBlock},
+		{flagAllow, rule.TypeAllow},
+	} {
+		if item.set {
+			types = append(types, item.rType)
+		}
+	}
+	return types
+}
+
+// ruleListCmd 是 'rule list' 子命令
+var ruleListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List custom rules with their metadata",
+	Example: `  mosctl rule list            # All lists
+  mosctl rule list --proxy    # Force NoCN only`,
+	Run: func(cmd *cobra.Command, args []string) {
+		types := selectedTypes()
+		if len(types) == 0 {
+			types = rule.AllTypes()
+		}
 
-		var err error
-		if flagDirect {
-			err = rule.AddRule(content, rule.TypeForceCN)
-		} else if flagProxy {
-			err = rule.AddRule(content, rule.TypeForceNoCN)
-		} else if flagIot {
-			err = rule.AddRule(content, rule.TypeIoT)
+		now := time.Now()
+		for _, rType := range types {
+			entries, err := rule.ListRules(rType)
+			if err != nil {
+				fmt.Printf("❌ 读取 [%s] 失败: %v\n", rule.ListName(rType), err)
+				os.Exit(1)
+			}
+			fmt.Printf("\n[%s] %d 条\n", rule.ListName(rType), len(entries))
+			for _, e := range entries {
+				fmt.Printf("  %s\n", e.Value)
+				if !e.HasMeta {
+					continue
+				}
+				var info []string
+				if !e.Meta.Added.IsZero() {
+					info = append(info, "添加于 "+e.Meta.Added.Format("2006-01-02 15:04"))
+				}
+				if e.Meta.By != "" {
+					info = append(info, "by "+e.Meta.By)
+				}
+				if !e.Meta.Expires.IsZero() {
+					if e.Meta.Expired(now) {
+						info = append(info, "⌛ 已过期 ("+e.Meta.Expires.Format("2006-01-02 15:04")+")")
+					} else {
+						info = append(info, "过期于 "+e.Meta.Expires.Format("2006-01-02 15:04"))
+					}
+				}
+				if e.Meta.Note != "" {
+					info = append(info, "备注: "+e.Meta.Note)
+				}
+				fmt.Printf("      %s\n", strings.Join(info, " | "))
+			}
 		}
+	},
+}
 
+// ruleGcCmd 是 'rule gc' 子命令，适合放在 cron 或 timer 中定期执行
+var ruleGcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove expired rules and restart once",
+	Run: func(cmd *cobra.Command, args []string) {
+		n, err := rule.CollectGarbage()
 		if err != nil {
+			fmt.Printf("❌ 清理失败: %v\n", err)
+			os.Exit(1)
+		}
+		if n == 0 {
+			fmt.Println("✅ 没有过期的规则")
+			return
+		}
+		fmt.Printf("✅ 已清理 %d 条过期规则\n", n)
+	},
+}
+
+// ruleBlockModeCmd 是 'rule block-mode' 子命令
+var ruleBlockModeCmd = &cobra.Command{
+	Use:   "block-mode [nxdomain|zero]",
+	Short: "Show or set how blocked domains are answered",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			fmt.Printf("当前拦截模式: %s\n", config.GetBlockMode())
+			return
+		}
+		if err := config.SetBlockMode(args[0]); err != nil {
+			fmt.Printf("❌ 设置失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✅ 拦截模式已更新并重启服务")
+	},
+}
+
+// ruleBlocklistCmd 管理拦截订阅
+var ruleBlocklistCmd = &cobra.Command{
+	Use:   "blocklist",
+	Short: "Manage remote blocklist subscriptions (refreshed by 'mosctl update')",
+}
+
+var ruleBlocklistListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List blocklist subscriptions",
+	Run: func(cmd *cobra.Command, args []string) {
+		sources := rule.BlockSources()
+		if len(sources) == 0 {
+			fmt.Println("未配置任何拦截订阅")
+			return
+		}
+		for _, s := range sources {
+			fmt.Printf("  - %s\n", s)
+		}
+	},
+}
+
+var ruleBlocklistAddCmd = &cobra.Command{
+	Use:     "add <url>",
+	Short:   "Subscribe to a blocklist (v2ray list, AdGuard filter or hosts format)",
+	Example: `  mosctl rule blocklist add https://adguardteam.github.io/AdGuardSDNSFilter/Filters/filter.txt`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := rule.AddBlockSource(args[0]); err != nil {
 			fmt.Printf("❌ 添加失败: %v\n", err)
 			os.Exit(1)
 		}
+		fmt.Println("✅ 订阅已添加，运行 mosctl update 后生效")
+	},
+}
+
+var ruleBlocklistRemoveCmd = &cobra.Command{
+	Use:   "remove <url>",
+	Short: "Unsubscribe from a blocklist",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := rule.RemoveBlockSource(args[0]); err != nil {
+			fmt.Printf("❌ 删除失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✅ 订阅已删除，运行 mosctl update 后生效")
 	},
 }
 
+// ruleAuditCmd 是 'rule audit' 子命令
+var ruleAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Report conflicting, redundant or overlapping rules",
+	Long: `Check the custom lists against each other and against the downloaded geo lists,
+then optionally fix the findings interactively:
+  force-cn    shadowed by geosite_apple, duplicated in the list or covered by geosite_cn
+  force-nocn  shadowed by geosite_apple, geosite_cn or force-cn, duplicated in the
+              list or covered by geosite_no_cn
+  block       allowed again by block-allow, duplicated in the list or covered by
+              the blocklist subscriptions
+  allow       duplicated in the list
+  iot         networks contained in another entry`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := auditRules(bufio.NewScanner(os.Stdin), flagFix); err != nil {
+			fmt.Printf("❌ 检查失败: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// auditRules 打印审计结果，并按需进入交互式修复
+func auditRules(scanner *bufio.Scanner, fix bool) error {
+	findings, err := rule.Audit()
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		fmt.Println("✅ 未发现冲突或冗余规则")
+		return nil
+	}
+
+	fmt.Printf("🔍 发现 %d 个问题:\n", len(findings))
+	for _, f := range findings {
+		fmt.Printf("  - %s\n", f)
+	}
+
+	if !fix {
+		fmt.Print("❓ 是否进入交互式修复? (y/N): ")
+		if !scanner.Scan() || strings.ToLower(strings.TrimSpace(scanner.Text())) != "y" {
+			return nil
+		}
+	}
+
+	removals := map[rule.RuleType][]string{}
+	for _, f := range findings {
+		fmt.Printf("\n%s\n", f)
+		for i, fx := range f.Fixes {
+			fmt.Printf("  %d. %s\n", i+1, fx.Label)
+		}
+		fmt.Print("  请选择 (回车跳过): ")
+		if !scanner.Scan() {
+			break
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil || n < 1 || n > len(f.Fixes) {
+			continue
+		}
+		fx := f.Fixes[n-1]
+		removals[fx.Type] = append(removals[fx.Type], fx.Entry)
+	}
+
+	if len(removals) == 0 {
+		fmt.Println("未做任何修改。")
+		return nil
+	}
+	if err := rule.RemoveRules(removals); err != nil {
+		return err
+	}
+	fmt.Println("✅ 修复完成")
+	return nil
+}
+
 func init() {
+	ruleAuditCmd.Flags().BoolVar(&flagFix, "fix", false, "Go straight to interactive fixing")
+
 	// 注册参数
 	ruleAddCmd.Flags().BoolVarP(&flagDirect, "direct", "d", false, "Add to Force CN list (Domestic)")
 	ruleAddCmd.Flags().BoolVarP(&flagProxy, "proxy", "p", false, "Add to Force NoCN list (Foreign)")
 	ruleAddCmd.Flags().BoolVarP(&flagIot, "iot", "i", false, "Add to IoT source bypass list (Smart Home)")
+	ruleAddCmd.Flags().BoolVarP(&flagBlock, "block", "b", false, "Add to ad/tracker block list")
+	ruleAddCmd.Flags().BoolVarP(&flagAllow, "allow", "a", false, "Add to block allowlist (exceptions)")
+	ruleAddCmd.Flags().StringVar(&flagNote, "note", "", "Why this rule exists")
+	ruleAddCmd.Flags().StringVar(&flagExpires, "expires", "", "Expire after a duration (7d, 12h) or on a date (2026-12-01)")
+
+	ruleAddCmd.Flags().BoolVar(&flagFromStdin, "from-stdin", false, "Also read entries from stdin, one per line")
+
+	ruleRemoveCmd.Flags().BoolVarP(&flagDirect, "direct", "d", false, "Remove from Force CN list")
+	ruleRemoveCmd.Flags().BoolVarP(&flagProxy, "proxy", "p", false, "Remove from Force NoCN list")
+	ruleRemoveCmd.Flags().BoolVarP(&flagIot, "iot", "i", false, "Remove from IoT list")
+	ruleRemoveCmd.Flags().BoolVarP(&flagBlock, "block", "b", false, "Remove from block list")
+	ruleRemoveCmd.Flags().BoolVarP(&flagAllow, "allow", "a", false, "Remove from block allowlist")
+	ruleRemoveCmd.Flags().BoolVar(&flagFromStdin, "from-stdin", false, "Also read entries from stdin, one per line")
+
+	ruleListCmd.Flags().BoolVarP(&flagDirect, "direct", "d", false, "Show Force CN list")
+	ruleListCmd.Flags().BoolVarP(&flagProxy, "proxy", "p", false, "Show Force NoCN list")
+	ruleListCmd.Flags().BoolVarP(&flagIot, "iot", "i", false, "Show IoT list")
+	ruleListCmd.Flags().BoolVarP(&flagBlock, "block", "b", false, "Show block list")
+	ruleListCmd.Flags().BoolVarP(&flagAllow, "allow", "a", false, "Show block allowlist")
 
 	ruleCmd.AddCommand(ruleAddCmd)
+	ruleCmd.AddCommand(ruleRemoveCmd)
+	ruleCmd.AddCommand(ruleListCmd)
+	ruleCmd.AddCommand(ruleGcCmd)
+	ruleCmd.AddCommand(ruleAuditCmd)
+	ruleCmd.AddCommand(ruleBlockModeCmd)
+	ruleBlocklistCmd.AddCommand(ruleBlocklistListCmd)
+	ruleBlocklistCmd.AddCommand(ruleBlocklistAddCmd)
+	ruleBlocklistCmd.AddCommand(ruleBlocklistRemoveCmd)
+	ruleCmd.AddCommand(ruleBlocklistCmd)
 	rootCmd.AddCommand(ruleCmd)
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/schedule"
+	"github.com/spf13/cobra"
+)
+
+// scheduleCmd 管理自动更新计划
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Show or change the automatic update schedule",
+	Long: `Manage when "mosctl update" runs automatically.
+
+With systemd this installs mosctl-update.service and mosctl-update.timer
+(randomized delay, missed runs are caught up after boot). Without systemd
+the schedule is kept in root's crontab. An old "mosctl update" crontab line
+left by the install script is migrated to the timer automatically.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		migrated, err := schedule.Migrate()
+		if err != nil {
+			fmt.Printf("⚠️  迁移 crontab 中的自动更新失败: %v\n", err)
+		} else if migrated {
+			fmt.Println("🔁 已将 crontab 中的 mosctl update 迁移为 systemd timer")
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		showSchedule()
+	},
+}
+
+var scheduleShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the current schedule",
+	Run: func(cmd *cobra.Command, args []string) {
+		showSchedule()
+	},
+}
+
+var scheduleSetCmd = &cobra.Command{
+	Use:   "set <OnCalendar>",
+	Short: "Run updates at the given time (systemd OnCalendar syntax)",
+	Example: `  mosctl schedule set "*-*-* 04:30:00"
+  mosctl schedule set "Mon,Thu 03:00"
+  mosctl schedule set daily`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// 允许不加引号: mosctl schedule set Mon 03:00
+		if err := schedule.Set(strings.Join(args, " ")); err != nil {
+			fmt.Printf("❌ 设置失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✅ 自动更新计划已更新")
+		showSchedule()
+	},
+}
+
+var scheduleDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stop and remove the automatic update",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := schedule.Disable(); err != nil {
+			fmt.Printf("❌ 停用失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("⏸️  已停用自动更新")
+	},
+}
+
+func showSchedule() {
+	st, err := schedule.Show()
+	if err != nil {
+		fmt.Printf("❌ 读取失败: %v\n", err)
+		os.Exit(1)
+	}
+	if !st.Enabled {
+		fmt.Printf("⏸️  自动更新未启用 (%s)，使用 mosctl schedule set <时间> 启用\n", st.Backend)
+		return
+	}
+	fmt.Printf("⏰ 自动更新已启用 (%s)\n", st.Backend)
+	if st.Backend == schedule.BackendSystemd {
+		fmt.Printf("   时间: %s (随机延迟 %s，关机错过的更新会在开机后补跑)\n", st.Calendar, schedule.RandomDelay)
+		if st.Next != "" {
+			fmt.Printf("   下次: %s\n", st.Next)
+		}
+		if st.Last != "" {
+			fmt.Printf("   上次: %s\n", st.Last)
+		}
+		return
+	}
+	fmt.Printf("   时间: %s (cron)\n", st.Calendar)
+}
+
+func init() {
+	scheduleCmd.AddCommand(scheduleShowCmd)
+	scheduleCmd.AddCommand(scheduleSetCmd)
+	scheduleCmd.AddCommand(scheduleDisableCmd)
+	rootCmd.AddCommand(scheduleCmd)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/KyleYu2024/mosctl/internal/geo"
+	"github.com/KyleYu2024/mosctl/internal/selfupdate"
+	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagSelfVersion string
+	flagSelfCheck   bool
+	flagSelfProxy   string
+)
+
+// selfUpdateCmd 更新 mosctl 自身
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update mosctl itself from GitHub Releases",
+	Long: `Download the mosctl release asset for this platform, verify it against the
+release's checksums.txt, make sure it runs, and atomically replace the running
+binary. Mirrors and proxy settings are the same ones mosctl update uses.`,
+	Example: `  mosctl self-update
+  mosctl self-update --check
+  mosctl self-update --version v0.5.2`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		proxy := flagSelfProxy
+		if proxy == "" {
+			proxy = geo.Proxy()
+		}
+		if err := service.SetProxy(proxy); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		if flagSelfCheck {
+			latest, err := selfupdate.Latest()
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("📦 当前版本: %s\n", version)
+			fmt.Printf("🆕 最新版本: %s (%s)\n", latest, selfupdate.AssetName())
+			switch {
+			case version == "dev":
+				fmt.Println("👉 当前是开发构建，执行 mosctl self-update 安装发布版本")
+			case selfupdate.Newer(latest, version):
+				fmt.Println("👉 执行 mosctl self-update 升级")
+			default:
+				fmt.Println("✅ 已是最新版本")
+			}
+			return
+		}
+
+		installed, err := selfupdate.Update(flagSelfVersion, version, geo.Mirrors())
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if installed != version {
+			fmt.Printf("✅ mosctl 已更新: %s -> %s\n", version, installed)
+		}
+	},
+}
+
+// refreshLatest 在缓存过期时于后台查询 mosctl 最新版本，供菜单下次显示时提示
+func refreshLatest() {
+	if _, stale := selfupdate.Cached(); !stale || version == "dev" {
+		return
+	}
+	// 代理在启动查询前设置，避免与菜单中的其他下载并发修改
+	if service.SetProxy(geo.Proxy()) != nil {
+		return
+	}
+	go selfupdate.Latest()
+}
+
+func init() {
+	selfUpdateCmd.Flags().StringVar(&flagSelfVersion, "version", "", "Install this mosctl release instead of the latest (e.g. v0.5.2)")
+	selfUpdateCmd.Flags().BoolVar(&flagSelfCheck, "check", false, "Only report whether a newer release exists")
+	selfUpdateCmd.Flags().StringVar(&flagSelfProxy, "proxy", "", "Download through this proxy (e.g. socks5://127.0.0.1:7891)")
+	rootCmd.AddCommand(selfUpdateCmd)
+}
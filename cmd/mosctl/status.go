@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KyleYu2024/mosctl/internal/api"
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/core"
+	"github.com/KyleYu2024/mosctl/internal/geo"
+	"github.com/KyleYu2024/mosctl/internal/rule"
+	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var statusJSON bool
+
+// statusReport 是 mosctl status --json 的输出，字段名保持稳定供脚本使用
+type statusReport struct {
+	Service    serviceReport     `json:"service"`
+	Version    versionReport     `json:"version"`
+	Upstreams  upstreamReport    `json:"upstreams"`
+	Cache      cacheReport       `json:"cache"`
+	Rescue     bool              `json:"rescue"`
+	Rules      map[string]int    `json:"rules"`
+	GeoUpdate  *geoUpdateReport  `json:"geo_update"`
+	Listeners  []config.Listener `json:"listeners"`
+	API        string            `json:"api"`
+	ReportedAt time.Time         `json:"reported_at"`
+}
+
+type serviceReport struct {
+	Manager  string `json:"manager"`
+	Active   bool   `json:"active"`
+	State    string `json:"state"`
+	SubState string `json:"sub_state"`
+	PID      int    `json:"pid,omitempty"`
+	Uptime   int64  `json:"uptime_seconds,omitempty"`
+	Restarts int    `json:"restarts"`
+	Memory   uint64 `json:"memory_bytes,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type versionReport struct {
+	MosDNS string `json:"mosdns"`
+	MosCtl string `json:"mosctl"`
+}
+
+type upstreamReport struct {
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+type cacheReport struct {
+	TTL     int      `json:"ttl"`
+	Hits    uint64   `json:"hits"`
+	Misses  uint64   `json:"misses"`
+	HitRate *float64 `json:"hit_rate"` // 0-1，无法读取 metrics 时为 null
+}
+
+type geoUpdateReport struct {
+	Time        time.Time `json:"time"`
+	OK          bool      `json:"ok"`
+	Error       string    `json:"error,omitempty"`
+	From        string    `json:"from,omitempty"`
+	Files       int       `json:"files"`
+	Changed     int       `json:"changed"`
+	Failed      int       `json:"failed"`
+	RolledBack  bool      `json:"rolled_back"`
+	LastSuccess string    `json:"last_success,omitempty"`
+}
+
+// statusCmd 输出运行状态概览
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show service, cache, rule and update status",
+	Long: `Show a summary of the MosDNS service: state, versions, upstreams, cache,
+rescue mode, rule counts, the last geo update and listener addresses.
+
+With --json the same data is printed as a single JSON object for scripts
+and monitoring (no colors or emoji).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		report := collectStatus()
+		if statusJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ 输出失败: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		printStatus(report)
+	},
+}
+
+func collectStatus() statusReport {
+	report := statusReport{
+		Version:    versionReport{MosCtl: version},
+		Rescue:     service.RescueActive(),
+		Rules:      map[string]int{},
+		Listeners:  config.Listeners(),
+		API:        api.Addr(),
+		ReportedAt: time.Now(),
+	}
+
+	report.Service.Manager = service.Manager().Name()
+	if st, err := service.GetStatus(); err != nil {
+		report.Service.Error = err.Error()
+	} else {
+		report.Service.Active = st.Active()
+		report.Service.State = st.ActiveState
+		report.Service.SubState = st.SubState
+		report.Service.PID = st.MainPID
+		report.Service.Uptime = int64(st.Uptime().Seconds())
+		report.Service.Restarts = st.Restarts
+		report.Service.Memory = st.Memory
+		if !st.Active() {
+			report.Service.Reason = st.Reason()
+		}
+	}
+
+	if v, err := core.Version(config.MosDNSBin); err == nil {
+		report.Version.MosDNS = v
+	}
+
+	local, remote := config.GetCurrentUpstreams()
+	report.Upstreams = upstreamReport{Local: known(local), Remote: known(remote)}
+
+	report.Cache.TTL, _ = strconv.Atoi(config.GetCurrentTTL())
+	if hits, misses, err := config.CacheStats(); err == nil {
+		report.Cache.Hits, report.Cache.Misses = hits, misses
+		rate := 0.0
+		if hits+misses > 0 {
+			rate = float64(hits) / float64(hits+misses)
+		}
+		report.Cache.HitRate = &rate
+	}
+
+	for _, path := range rule.Lists {
+		if n, err := rule.CountEntries(path); err == nil {
+			report.Rules[strings.TrimSuffix(filepath.Base(path), ".txt")] = n
+		}
+	}
+
+	if run, ok := geo.LastRun(); ok {
+		g := &geoUpdateReport{
+			Time:   run.Time,
+			OK:     run.OK,
+			Error:  run.Error,
+			From:   run.From,
+			Files:  len(run.Files),
+			Failed: run.Failed(),
+		}
+		for _, f := range run.Files {
+			if f.Changed {
+				g.Changed++
+			}
+			if f.RolledBack {
+				g.RolledBack = true
+			}
+		}
+		report.GeoUpdate = g
+	}
+	if last := config.GetLastUpdate(); last != "从未更新" {
+		if report.GeoUpdate == nil {
+			report.GeoUpdate = &geoUpdateReport{}
+		}
+		report.GeoUpdate.LastSuccess = strings.TrimSpace(last)
+	}
+	return report
+}
+
+// known 把配置读取失败时的 "未知" 转换为空字符串
+func known(s string) string {
+	if s == "未知" {
+		return ""
+	}
+	return s
+}
+
+func printStatus(r statusReport) {
+	fmt.Println("📊 MosDNS 状态")
+	svc := r.Service
+	switch {
+	case svc.Error != "":
+		fmt.Printf("  服务: ❓ 未知 (%s)\n", svc.Error)
+	case svc.Active:
+		fmt.Printf("  服务: 🟢 运行中 (%s) | PID %d | 已运行 %s | 自动重启 %d 次\n",
+			svc.Manager, svc.PID, time.Duration(svc.Uptime)*time.Second, svc.Restarts)
+	default:
+		fmt.Printf("  服务: 🔴 %s/%s (%s) | %s\n", svc.State, svc.SubState, svc.Manager, svc.Reason)
+	}
+	mosdns := r.Version.MosDNS
+	if mosdns == "" {
+		mosdns = "未知"
+	}
+	fmt.Printf("  版本: mosdns %s | mosctl %s\n", mosdns, r.Version.MosCtl)
+	fmt.Printf("  上游: 国内 %s | 国外 %s\n", orUnknown(r.Upstreams.Local), orUnknown(r.Upstreams.Remote))
+
+	hitRate := "未知"
+	if r.Cache.HitRate != nil {
+		hitRate = fmt.Sprintf("%.1f%% (%d/%d)", *r.Cache.HitRate*100, r.Cache.Hits, r.Cache.Hits+r.Cache.Misses)
+	}
+	fmt.Printf("  缓存: TTL %d 秒 | 命中率 %s\n", r.Cache.TTL, hitRate)
+
+	if r.Rescue {
+		fmt.Printf("  救援: 🚑 已开启 (转发到 %s)\n", service.RescueDNS)
+	} else {
+		fmt.Println("  救援: 未开启")
+	}
+
+	fmt.Println("  规则:")
+	for _, path := range rule.Lists {
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		if n, ok := r.Rules[name]; ok {
+			fmt.Printf("    %-16s %d\n", name, n)
+		}
+	}
+
+	if g := r.GeoUpdate; g == nil {
+		fmt.Println("  Geo 更新: 从未更新")
+	} else if !g.Time.IsZero() {
+		result := "✅ 成功"
+		if !g.OK {
+			result = "❌ 失败"
+			if g.Failed > 0 {
+				result = fmt.Sprintf("❌ %d 个文件失败", g.Failed)
+			}
+		}
+		if g.RolledBack {
+			result += "，已回滚"
+		}
+		fmt.Printf("  Geo 更新: %s %s | %d 个文件变化\n", g.Time.Local().Format("2006-01-02 15:04"), result, g.Changed)
+		if !g.OK && g.LastSuccess != "" {
+			fmt.Printf("            上次成功 %s\n", g.LastSuccess)
+		}
+	} else {
+		fmt.Printf("  Geo 更新: %s\n", g.LastSuccess)
+	}
+
+	var addrs []string
+	for _, l := range r.Listeners {
+		addrs = append(addrs, fmt.Sprintf("%s %s", strings.TrimSuffix(l.Type, "_server"), l.Addr))
+	}
+	addrs = append(addrs, "api "+r.API)
+	fmt.Printf("  监听: %s\n", strings.Join(addrs, " | "))
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "未知"
+	}
+	return s
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "print machine-readable JSON")
+	rootCmd.AddCommand(statusCmd)
+}
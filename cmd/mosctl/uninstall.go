@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/KyleYu2024/mosctl/internal/install"
+	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var uninstallOpts install.UninstallOptions
+
+// uninstallCmd 代表 uninstall 命令
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove MosDNS and undo every system change made by install",
+	Long: `Remove MosDNS and restore what mosctl install changed, using the record it
+keeps in ` + install.StatePath + `: the service files, update timer and cron
+entries, logrotate and sysctl files, the INPUT rules for port 53, the rescue
+chains, /etc/resolv.conf and systemd-resolved.
+
+Every action is listed before anything is touched. Installs made by the old
+install_cli.sh have no record; their changes are inferred instead.`,
+	Example: `  mosctl uninstall
+  mosctl uninstall --keep-config
+  mosctl uninstall --backup /root/mosdns-backup.tar.gz -y`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := install.Uninstall(uninstallOpts); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	uninstallCmd.Flags().BoolVar(&uninstallOpts.KeepConfig, "keep-config", false, "Keep "+service.MosDNSDir+" (config and rules)")
+	uninstallCmd.Flags().StringVar(&uninstallOpts.Backup, "backup", "", "Archive "+service.MosDNSDir+" to this tar.gz before removing it")
+	uninstallCmd.Flags().BoolVarP(&uninstallOpts.Yes, "yes", "y", false, "Do not ask for confirmation")
+	rootCmd.AddCommand(uninstallCmd)
+}
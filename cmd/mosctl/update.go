@@ -4,8 +4,7 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/KyleYu2024/mosctl/internal/config"
-	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/KyleYu2024/mosctl/internal/geo"
 	"github.com/spf13/cobra"
 )
 
@@ -13,50 +12,69 @@ import (
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update GeoIP and GeoSite rules",
+	Example: `  mosctl update
+  mosctl update --bundle geo-bundle.tar.gz --core mosdns-linux-amd64.zip   # 在有网络的机器上打包
+  mosctl update --from geo-bundle.tar.gz                                   # 在离线机器上安装`,
 	Run: func(cmd *cobra.Command, args []string) {
-		UpdateGeoRules()
+		if flagUpdateBundle != "" && flagUpdateFrom != "" {
+			fmt.Println("❌ --bundle 与 --from 不能同时使用")
+			os.Exit(1)
+		}
+		if flagUpdateBundle != "" {
+			if err := geo.CreateBundle(flagUpdateBundle, updateOptions(), flagUpdateCore); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		if flagUpdateCore != "" {
+			fmt.Println("❌ --core 只能与 --bundle 一起使用")
+			os.Exit(1)
+		}
+		// 失败时返回非零退出码，方便 cron / systemd timer 感知
+		if err := UpdateGeoRules(); err != nil {
+			os.Exit(1)
+		}
 	},
 }
 
+var (
+	flagUpdateForce    bool
+	flagUpdateProxy    string
+	flagUpdateBundle   string
+	flagUpdateFrom     string
+	flagUpdateCore     string
+	flagUpdateSkipCore bool
+)
+
 func init() {
+	updateCmd.Flags().BoolVar(&flagUpdateForce, "force", false, "Ignore cached ETags and replace lists even if they shrank by more than half")
+	updateCmd.Flags().StringVar(&flagUpdateProxy, "proxy", "", "Download through this proxy (e.g. socks5://127.0.0.1:7891)")
+	updateCmd.Flags().StringVar(&flagUpdateBundle, "bundle", "", "Download all lists into an offline bundle (tar.gz) instead of installing them")
+	updateCmd.Flags().StringVar(&flagUpdateCore, "core", "", "With --bundle: also pack this mosdns binary or release zip")
+	updateCmd.Flags().StringVar(&flagUpdateFrom, "from", "", "Install lists from an offline bundle (tar.gz or extracted directory)")
+	updateCmd.Flags().BoolVar(&flagUpdateSkipCore, "skip-core", false, "With --from: do not install the mosdns binary from the bundle")
 	rootCmd.AddCommand(updateCmd)
 }
 
-func UpdateGeoRules() {
-	fmt.Println("⬇️  正在更新 GeoSite/GeoIP...")
-
-	// 确保目录存在
-	os.MkdirAll("/etc/mosdns/rules", 0755)
-
-	ghProxy := "https://gh-proxy.com/"
-
-	files := map[string]string{
-		ghProxy + "https://raw.githubusercontent.com/Loyalsoldier/v2ray-rules-dat/release/direct-list.txt": "/etc/mosdns/rules/geosite_cn.txt",
-		ghProxy + "https://raw.githubusercontent.com/Loyalsoldier/geoip/release/text/cn.txt":              "/etc/mosdns/rules/geoip_cn.txt",
-		ghProxy + "https://raw.githubusercontent.com/Loyalsoldier/v2ray-rules-dat/release/apple-cn.txt":    "/etc/mosdns/rules/geosite_apple.txt",
-		ghProxy + "https://raw.githubusercontent.com/Loyalsoldier/v2ray-rules-dat/release/proxy-list.txt":   "/etc/mosdns/rules/geosite_no_cn.txt",
-	}
-
-	failCount := 0
-	for url, path := range files {
-		fmt.Printf("Downloading %s ...\n", path)
-		if err := service.DownloadFile(url, path); err != nil {
-			fmt.Printf("❌ 下载失败 %s: %v\n", path, err)
-			failCount++
-		}
-	}
+func updateOptions() geo.Options {
+	return geo.Options{Force: flagUpdateForce, Proxy: flagUpdateProxy}
+}
 
-	if failCount == 0 {
-		config.SetLastUpdate()
+// UpdateGeoRules 更新全部规则，菜单与命令行共用；指定 --from 时从离线包安装
+func UpdateGeoRules() error {
+	var err error
+	if flagUpdateFrom != "" {
+		fmt.Printf("📦 正在从离线包 %s 更新...\n", flagUpdateFrom)
+		err = geo.ApplyBundle(flagUpdateFrom, updateOptions(), flagUpdateSkipCore)
 	} else {
-		fmt.Printf("⚠️  更新完成，但有 %d 个文件下载失败。\n", failCount)
+		fmt.Println("⬇️  正在更新 GeoSite/GeoIP...")
+		err = geo.Update(updateOptions())
 	}
-
-	// 重启 MosDNS
-	fmt.Println("🔄 重启 MosDNS 服务...")
-	if err := service.RestartService(); err != nil {
-		fmt.Printf("❌ 重启失败: %v\n", err)
-	} else {
-		fmt.Println("✅ 规则更新完毕！")
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return err
 	}
+	fmt.Println("✅ 规则更新完毕！")
+	return nil
 }
@@ -6,13 +6,15 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// version 是 mosctl 的版本号，发布时由 release.yml 通过 -ldflags "-X main.version=<tag>" 注入
+var version = "dev"
+
 // versionCmd 代表 version 命令
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the version number of MosCtl",
 	Run: func(cmd *cobra.Command, args []string) {
-		// 这里可以硬编码，也可以通过编译参数注入
-		fmt.Println("v0.5.2")
+		fmt.Println(version)
 	},
 }
 
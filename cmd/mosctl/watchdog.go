@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/KyleYu2024/mosctl/internal/watchdog"
+	"github.com/spf13/cobra"
+)
+
+var watchdogOpts = watchdog.DefaultOptions
+
+// watchdogCmd 代表 watchdog 命令，由 mosctl-watchdog.service 常驻运行
+var watchdogCmd = &cobra.Command{
+	Use:   "watchdog",
+	Short: "Probe MosDNS continuously and fail over to rescue mode when it stops answering",
+	Long: `Resolve a domain through the MosDNS listener at a fixed interval. After
+--fail-after consecutive failures the watchdog restarts mosdns. If the restart
+did not help (another --fail-after failures), it enables rescue mode, so clients
+keep resolving even when mosdns is running but not answering (a stuck upstream,
+port 53 taken by another process). Rescue mode is turned off again only after
+--recover-after consecutive successes, which keeps it from flapping. A mosdns
+stopped on purpose is left alone.
+
+Starting mosdns always disables rescue mode, so while rescue is on the watchdog
+retries the restart only with a backoff of 5 minutes, doubling up to 1 hour.
+
+mosctl install runs it as ` + watchdog.Unit + ` on systemd only. With OpenRC,
+runit/s6 or the pid-file backend, run "mosctl watchdog" under your own
+supervisor if you want it.`,
+	Example: `  mosctl watchdog
+  mosctl watchdog --interval 5s --fail-after 3 --recover-after 12`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := watchdog.Run(watchdogOpts); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	watchdogCmd.Flags().StringVar(&watchdogOpts.Domain, "domain", watchdogOpts.Domain, "Domain to resolve on each probe")
+	watchdogCmd.Flags().DurationVar(&watchdogOpts.Interval, "interval", watchdogOpts.Interval, "Time between probes")
+	watchdogCmd.Flags().DurationVar(&watchdogOpts.Timeout, "timeout", watchdogOpts.Timeout, "Timeout of a single probe")
+	watchdogCmd.Flags().IntVar(&watchdogOpts.FailAfter, "fail-after", watchdogOpts.FailAfter, "Consecutive failures before restarting mosdns, and again before enabling rescue")
+	watchdogCmd.Flags().IntVar(&watchdogOpts.RecoverAfter, "recover-after", watchdogOpts.RecoverAfter, "Consecutive successes before disabling rescue")
+	rootCmd.AddCommand(watchdogCmd)
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// configPath 与 config.ConfigPath 相同 (api 被 service 引用，不能反向依赖 config)
+const configPath = "/etc/mosdns/config.yaml"
+
+// 默认值与 templates/config.yaml 保持一致
+const (
+	DefaultAddr     = "127.0.0.1:8080"
+	DefaultDumpFile = "/etc/mosdns/cache.dump"
+	CacheTag        = "cache"
+)
+
+var (
+	apiAddrRegex  = regexp.MustCompile(`(?m)^api:\s*\n\s+http:\s*"?([^"\s#]+)"?`)
+	dumpFileRegex = regexp.MustCompile(`dump_file:\s*"?([^"\s#]+)"?`)
+)
+
+// Client 是 MosDNS 插件 HTTP API 的客户端
+type Client struct {
+	base string
+	http *http.Client
+}
+
+// New 创建指向 addr (host:port) 的客户端
+func New(addr string) *Client {
+	return &Client{
+		base: "http://" + addr,
+		http: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WithTimeout 返回使用 d 作为请求超时的客户端副本
+func (c *Client) WithTimeout(d time.Duration) *Client {
+	return &Client{base: c.base, http: &http.Client{Timeout: d}}
+}
+
+// Default 使用 config.yaml 中 api.http 的地址创建客户端
+func Default() *Client {
+	return New(Addr())
+}
+
+// Addr 读取 config.yaml 中的 api.http 地址，监听全部地址时改用本机回环
+func Addr() string {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return DefaultAddr
+	}
+	match := apiAddrRegex.FindSubmatch(content)
+	if match == nil {
+		return DefaultAddr
+	}
+	host, port, err := net.SplitHostPort(string(match[1]))
+	if err != nil {
+		return DefaultAddr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// DumpFile 读取缓存插件的 dump_file 路径
+func DumpFile() string {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return DefaultDumpFile
+	}
+	match := dumpFileRegex.FindSubmatch(content)
+	if match == nil {
+		return DefaultDumpFile
+	}
+	return string(match[1])
+}
+
+// Metrics 获取 Prometheus 格式的监控数据
+func (c *Client) Metrics() (string, error) {
+	body, err := c.get("/metrics")
+	return string(body), err
+}
+
+// FlushCache 清空指定缓存插件的内存缓存
+func (c *Client) FlushCache(tag string) error {
+	_, err := c.get("/plugins/" + tag + "/flush")
+	return err
+}
+
+// DumpCache 导出指定缓存插件的内容
+func (c *Client) DumpCache(tag string) ([]byte, error) {
+	return c.get("/plugins/" + tag + "/dump")
+}
+
+// LoadCache 把之前导出的内容加载回缓存插件
+func (c *Client) LoadCache(tag string, data []byte) error {
+	resp, err := c.http.Post(c.base+"/plugins/"+tag+"/load_dump", "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// SaveCache 导出缓存并原子写入 path
+func (c *Client) SaveCache(tag, path string) (int, error) {
+	data, err := c.DumpCache(tag)
+	if err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (c *Client) get(path string) ([]byte, error) {
+	resp, err := c.http.Get(c.base + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
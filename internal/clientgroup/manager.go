@@ -0,0 +1,363 @@
+package clientgroup
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/service"
+)
+
+// Policy 定义分组内客户端的解析策略
+type Policy string
+
+const (
+	PolicyDefault  Policy = "default"     // 与其他客户端一样走默认分流
+	PolicyLocal    Policy = "local-only"  // 只使用国内上游
+	PolicyRemote   Policy = "remote-only" // 只使用国外上游
+	PolicyBlockAds Policy = "block-ads"   // 执行广告拦截；其他策略的分组不拦截
+	PolicyNoAAAA   Policy = "no-aaaa"     // 不返回 IPv6 地址
+)
+
+// Policies 列出所有可选策略
+var Policies = []Policy{PolicyDefault, PolicyLocal, PolicyRemote, PolicyBlockAds, PolicyNoAAAA}
+
+const (
+	StorePath = "/etc/mosdns/client_groups.json"
+	RuleDir   = "/etc/mosdns/rules"
+)
+
+// Group 是一个命名的客户端分组
+type Group struct {
+	Name   string `json:"name"`
+	Policy Policy `json:"policy"`
+}
+
+// Path 返回分组 CIDR 列表文件路径
+func (g Group) Path() string {
+	return filepath.Join(RuleDir, "client_"+g.Name+".txt")
+}
+
+// Tag 返回分组在 config.yaml 中的 ip_set 标签
+func (g Group) Tag() string {
+	return "client_" + g.Name
+}
+
+var nameRegex = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// ParsePolicy 校验策略名称
+func ParsePolicy(s string) (Policy, error) {
+	for _, p := range Policies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	names := make([]string, len(Policies))
+	for i, p := range Policies {
+		names[i] = string(p)
+	}
+	return "", fmt.Errorf("未知的策略 %q (可选: %s)", s, strings.Join(names, ", "))
+}
+
+// Load 读取全部分组，按创建顺序排列 (越靠前优先级越高)
+func Load() ([]Group, error) {
+	data, err := os.ReadFile(StorePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var groups []Group
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", StorePath, err)
+	}
+	return groups, nil
+}
+
+func save(groups []Group) error {
+	data, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(StorePath, append(data, '\n'))
+}
+
+// writeFile 先写入同目录下的临时文件再替换，避免写到一半时留下残缺的文件
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	os.Chmod(tmp.Name(), 0644)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// update 保存分组并重新渲染、重启；渲染或重启失败时恢复原来的 client_groups.json 与 config.yaml，
+// 保证两者始终一致
+func update(groups []Group) error {
+	prevStore, storeErr := os.ReadFile(StorePath)
+	prevConfig, err := os.ReadFile(config.ConfigPath)
+	if err != nil {
+		return err
+	}
+	if err := save(groups); err != nil {
+		return err
+	}
+	err = apply()
+	if err == nil {
+		return nil
+	}
+
+	if os.IsNotExist(storeErr) {
+		os.Remove(StorePath)
+	} else if rerr := writeFile(StorePath, prevStore); rerr != nil {
+		return fmt.Errorf("%v (恢复 %s 失败: %v)", err, StorePath, rerr)
+	}
+	if current, _ := os.ReadFile(config.ConfigPath); string(current) != string(prevConfig) {
+		if rerr := writeFile(config.ConfigPath, prevConfig); rerr != nil {
+			return fmt.Errorf("%v (恢复 %s 失败: %v)", err, config.ConfigPath, rerr)
+		}
+		// 新配置可能导致服务起不来，用原来的配置再启动一次
+		service.RestartService()
+	}
+	fmt.Println("↩️  已恢复原来的分组与 config.yaml")
+	return err
+}
+
+func find(groups []Group, name string) int {
+	for i, g := range groups {
+		if g.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Create 新建分组
+func Create(name string, policy Policy) error {
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("分组名只能包含小写字母、数字和下划线 (最长 32 位)")
+	}
+	groups, err := Load()
+	if err != nil {
+		return err
+	}
+	if find(groups, name) >= 0 {
+		return fmt.Errorf("分组 %s 已存在", name)
+	}
+
+	if err := checkPolicy(policy); err != nil {
+		return err
+	}
+
+	g := Group{Name: name, Policy: policy}
+	if err := os.MkdirAll(RuleDir, 0755); err != nil {
+		return fmt.Errorf("无法创建目录: %v", err)
+	}
+	if _, err := os.Stat(g.Path()); os.IsNotExist(err) {
+		if err := writeFile(g.Path(), nil); err != nil {
+			return fmt.Errorf("无法创建分组文件: %v", err)
+		}
+	}
+	fmt.Printf("✅ 已创建分组 %s (策略: %s)\n", name, policy)
+	return update(append(groups, g))
+}
+
+// Delete 删除分组及其 CIDR 列表
+func Delete(name string) error {
+	groups, err := Load()
+	if err != nil {
+		return err
+	}
+	i := find(groups, name)
+	if i < 0 {
+		return fmt.Errorf("分组 %s 不存在", name)
+	}
+	g := groups[i]
+	// 先更新配置再删文件，避免 MosDNS 引用不存在的文件
+	if err := update(append(groups[:i], groups[i+1:]...)); err != nil {
+		return err
+	}
+	os.Remove(g.Path())
+	fmt.Printf("🗑️  已删除分组 %s\n", name)
+	return nil
+}
+
+// SetPolicy 修改分组策略
+func SetPolicy(name string, policy Policy) error {
+	groups, err := Load()
+	if err != nil {
+		return err
+	}
+	i := find(groups, name)
+	if i < 0 {
+		return fmt.Errorf("分组 %s 不存在", name)
+	}
+	if err := checkPolicy(policy); err != nil {
+		return err
+	}
+	groups[i].Policy = policy
+	fmt.Printf("✅ 分组 %s 的策略已设为 %s\n", name, policy)
+	return update(groups)
+}
+
+// AddMembers 向分组添加 IP/CIDR
+func AddMembers(name string, members []string) error {
+	g, err := get(name)
+	if err != nil {
+		return err
+	}
+	current, err := Members(g)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, m := range members {
+		m = strings.TrimSpace(m)
+		if !isNetwork(m) {
+			return fmt.Errorf("%q 不是有效的 IP 或 CIDR", m)
+		}
+		if contains(current, m) {
+			fmt.Printf("⚠️  %s 已在分组 %s 中，跳过添加。\n", m, name)
+			continue
+		}
+		current = append(current, m)
+		added++
+	}
+	if added == 0 {
+		return nil
+	}
+	if err := writeMembers(g, current); err != nil {
+		return err
+	}
+	fmt.Printf("✅ 已向分组 %s 添加 %d 个地址\n", name, added)
+	return restart()
+}
+
+// RemoveMembers 从分组删除 IP/CIDR
+func RemoveMembers(name string, members []string) error {
+	g, err := get(name)
+	if err != nil {
+		return err
+	}
+	current, err := Members(g)
+	if err != nil {
+		return err
+	}
+	var kept []string
+	for _, m := range current {
+		if !contains(members, m) {
+			kept = append(kept, m)
+		}
+	}
+	if len(kept) == len(current) {
+		return fmt.Errorf("分组 %s 中没有这些地址", name)
+	}
+	if err := writeMembers(g, kept); err != nil {
+		return err
+	}
+	fmt.Printf("🗑️  已从分组 %s 删除 %d 个地址\n", name, len(current)-len(kept))
+	return restart()
+}
+
+// Members 读取分组中的 IP/CIDR
+func Members(g Group) ([]string, error) {
+	data, err := os.ReadFile(g.Path())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			members = append(members, line)
+		}
+	}
+	return members, nil
+}
+
+func writeMembers(g Group, members []string) error {
+	out := strings.Join(members, "\n")
+	if out != "" {
+		out += "\n"
+	}
+	return writeFile(g.Path(), []byte(out))
+}
+
+func get(name string) (Group, error) {
+	groups, err := Load()
+	if err != nil {
+		return Group{}, err
+	}
+	i := find(groups, name)
+	if i < 0 {
+		return Group{}, fmt.Errorf("分组 %s 不存在，请先执行 mosctl client-group create %s", name, name)
+	}
+	return groups[i], nil
+}
+
+// apply 重新渲染 config.yaml 并重启
+func apply() error {
+	groups, err := Load()
+	if err != nil {
+		return err
+	}
+	if err := Render(groups); err != nil {
+		return err
+	}
+	return restart()
+}
+
+// checkPolicy 确认当前配置支持该策略
+func checkPolicy(policy Policy) error {
+	if policy == PolicyBlockAds && !config.BlockEnabled() {
+		return fmt.Errorf("当前 config.yaml 未包含拦截模块 (# TAG_BLOCK)，无法使用 %s 策略", policy)
+	}
+	return nil
+}
+
+func restart() error {
+	fmt.Println("🔄 正在重载服务以生效分组...")
+	if err := service.RestartService(); err != nil {
+		fmt.Printf("❌ 分组已写入但服务重启失败: %v\n", err)
+		return err
+	}
+	fmt.Println("🎉 服务重载成功，分组已生效！")
+	return nil
+}
+
+func isNetwork(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(s)
+	return err == nil
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
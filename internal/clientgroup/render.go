@@ -0,0 +1,172 @@
+package clientgroup
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+)
+
+// config.yaml 中由 mosctl 维护的两段区域
+const (
+	beginGroups   = "  # BEGIN MOSCTL CLIENT GROUPS"
+	endGroups     = "  # END MOSCTL CLIENT GROUPS"
+	beginPolicies = "      # BEGIN MOSCTL CLIENT POLICIES"
+	endPolicies   = "      # END MOSCTL CLIENT POLICIES"
+)
+
+// blockExec 是 main_sequence 中执行广告拦截的两行，由策略区域接管
+const blockExec = "      - exec: $query_is_block_domain\n      - exec: jump has_resp_sequence\n"
+
+var (
+	mainSequenceRegex = regexp.MustCompile(`(?m)^  - tag: main_sequence\n    type: sequence\n    args:\n`)
+	hostsExecRegex    = regexp.MustCompile(`(?m)^      - exec: \$hosts\n      - exec: jump has_resp_sequence\n`)
+)
+
+// Render 把分组写入 config.yaml：ip_set 定义放在 main_sequence 之前，
+// 广告拦截与 client_ip 匹配规则放在 main_sequence 中 hosts 之后
+func Render(groups []Group) error {
+	content, err := os.ReadFile(config.ConfigPath)
+	if err != nil {
+		return err
+	}
+	text, err := ensureMarkers(string(content))
+	if err != nil {
+		return err
+	}
+
+	var defs, rules []string
+	for _, g := range groups {
+		defs = append(defs,
+			"  - tag: "+g.Tag(),
+			"    type: ip_set",
+			"    args:",
+			"      files:",
+			fmt.Sprintf("        - %q", g.Path()),
+			"",
+		)
+		rules = append(rules, policyRules(g)...)
+	}
+	if strings.Contains(text, "  - tag: query_is_block_domain\n") {
+		rules = append(blockRules(groups), rules...)
+	}
+
+	text = replaceBetween(text, beginGroups, endGroups, defs)
+	text = replaceBetween(text, beginPolicies, endPolicies, rules)
+	return writeFile(config.ConfigPath, []byte(text))
+}
+
+// blockRules 生成广告拦截规则：不属于任何分组的客户端与 block-ads 分组执行拦截，
+// 其他分组不拦截。同时属于多个分组的客户端只要在 block-ads 分组中就会被拦截
+func blockRules(groups []Group) []string {
+	var rules, tags []string
+	for _, g := range groups {
+		tags = append(tags, "$"+g.Tag())
+		if g.Policy == PolicyBlockAds {
+			rules = append(rules,
+				"      - matches: client_ip $"+g.Tag(),
+				"        exec: $query_is_block_domain",
+			)
+		}
+	}
+	if len(tags) == 0 {
+		rules = append(rules, "      - exec: $query_is_block_domain")
+	} else {
+		rules = append(rules,
+			fmt.Sprintf(`      - matches: "!client_ip %s"`, strings.Join(tags, " ")),
+			"        exec: $query_is_block_domain",
+		)
+	}
+	return append(rules, "      - exec: jump has_resp_sequence")
+}
+
+// policyRules 生成分组策略对应的 main_sequence 规则 (block-ads 由 blockRules 处理)
+func policyRules(g Group) []string {
+	match := "client_ip $" + g.Tag()
+	switch g.Policy {
+	case PolicyLocal:
+		return []string{
+			"      - matches: " + match,
+			"        exec: $forward_local",
+			"      - matches: " + match,
+			"        exec: accept",
+		}
+	case PolicyRemote:
+		return []string{
+			"      - matches: " + match,
+			"        exec: $forward_remote_upstream",
+			"      - matches: " + match,
+			"        exec: accept",
+		}
+	case PolicyNoAAAA:
+		return []string{
+			"      - matches:",
+			"          - " + match,
+			"          - qtype 28",
+			"        exec: reject 0",
+		}
+	}
+	return nil
+}
+
+// ensureMarkers 为旧版配置补上标记区域。策略区域必须紧跟在 hosts 之后，
+// 旧版放在 main_sequence 最前面的区域会被移到 hosts 之后，并接管原有的广告拦截调用
+func ensureMarkers(text string) (string, error) {
+	if mainSequenceRegex.FindStringIndex(text) == nil {
+		return "", fmt.Errorf("config.yaml 中找不到 main_sequence")
+	}
+	if !policiesAfterHosts(text) {
+		text = removeRegion(text, beginPolicies, endPolicies)
+		region := beginPolicies + "\n" + endPolicies + "\n"
+		if strings.Contains(text, blockExec) {
+			text = strings.Replace(text, blockExec, "", 1)
+		}
+		loc := hostsExecRegex.FindStringIndex(text)
+		if loc == nil {
+			// 没有 hosts 插件的旧配置
+			loc = mainSequenceRegex.FindStringIndex(text)
+		}
+		text = text[:loc[1]] + region + text[loc[1]:]
+	}
+	if !strings.Contains(text, beginGroups) {
+		loc := mainSequenceRegex.FindStringIndex(text)
+		text = text[:loc[0]] + beginGroups + "\n" + endGroups + "\n\n" + text[loc[0]:]
+	}
+	return text, nil
+}
+
+// policiesAfterHosts 判断策略区域是否已经位于 hosts 之后 (没有 hosts 插件时位于 main_sequence 最前面)
+func policiesAfterHosts(text string) bool {
+	anchor := hostsExecRegex
+	if hostsExecRegex.FindStringIndex(text) == nil {
+		anchor = mainSequenceRegex
+	}
+	loc := anchor.FindStringIndex(text)
+	return strings.HasPrefix(text[loc[1]:], beginPolicies+"\n")
+}
+
+// removeRegion 删除两行标记及其之间的内容
+func removeRegion(text, begin, end string) string {
+	start := strings.Index(text, begin+"\n")
+	stop := strings.Index(text, end+"\n")
+	if start < 0 || stop < start {
+		return text
+	}
+	return text[:start] + text[stop+len(end)+1:]
+}
+
+// replaceBetween 替换两行标记之间的内容
+func replaceBetween(text, begin, end string, lines []string) string {
+	start := strings.Index(text, begin+"\n")
+	stop := strings.Index(text, end)
+	if start < 0 || stop < start {
+		return text
+	}
+	body := ""
+	if len(lines) > 0 {
+		body = strings.Join(lines, "\n") + "\n"
+	}
+	return text[:start+len(begin)+1] + body + text[stop:]
+}
@@ -0,0 +1,124 @@
+package clientgroup
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/KyleYu2024/mosctl/templates"
+)
+
+func templateConfig(t *testing.T) string {
+	t.Helper()
+	data, err := templates.FS.ReadFile("config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// mainSequence 返回 main_sequence 中 hosts 到智能家居直连之间的内容
+func mainSequence(t *testing.T, text string) string {
+	t.Helper()
+	start := strings.Index(text, "      - exec: $hosts\n")
+	end := strings.Index(text, "      # 智能家居直连")
+	if start < 0 || end < start {
+		t.Fatalf("main_sequence layout not found:\n%s", text)
+	}
+	return strings.TrimRight(text[start:end], " \n")
+}
+
+func TestEnsureMarkers(t *testing.T) {
+	current := templateConfig(t)
+	want := mainSequence(t, current)
+
+	// 旧版把策略区域放在 main_sequence 最前面，拦截调用在区域之外
+	legacy := strings.Replace(current,
+		"      - exec: $hosts\n      - exec: jump has_resp_sequence\n"+beginPolicies+"\n"+blockExec+endPolicies+"\n",
+		beginPolicies+"\n      - matches: client_ip $client_tv\n        exec: accept\n"+endPolicies+"\n"+
+			"      - exec: $hosts\n      - exec: jump has_resp_sequence\n"+blockExec, 1)
+	if legacy == current {
+		t.Fatal("template layout changed, update the legacy fixture")
+	}
+	// 更早的配置没有任何标记
+	bare := strings.Replace(strings.Replace(legacy, beginPolicies+"\n      - matches: client_ip $client_tv\n        exec: accept\n"+endPolicies+"\n", "", 1),
+		beginGroups+"\n"+endGroups+"\n\n", "", 1)
+
+	for name, in := range map[string]string{"current": current, "legacy": legacy, "bare": bare} {
+		out, err := ensureMarkers(in)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out = replaceBetween(out, beginPolicies, endPolicies, blockRules(nil))
+		if got := mainSequence(t, out); got != want {
+			t.Errorf("%s: main_sequence =\n%s\nwant\n%s", name, got, want)
+		}
+		if strings.Count(out, beginPolicies) != 1 || strings.Count(out, beginGroups) != 1 {
+			t.Errorf("%s: markers duplicated", name)
+		}
+		if strings.Count(out, "exec: $query_is_block_domain") != 1 {
+			t.Errorf("%s: block exec not moved into the policy region", name)
+		}
+		// 再次执行不应改变内容
+		again, _ := ensureMarkers(out)
+		if again != out {
+			t.Errorf("%s: ensureMarkers is not idempotent", name)
+		}
+	}
+
+	if _, err := ensureMarkers("plugins: []\n"); err == nil {
+		t.Error("config without main_sequence did not return an error")
+	}
+}
+
+func TestBlockRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []Group
+		want   []string
+	}{
+		{
+			name: "no groups",
+			want: []string{"      - exec: $query_is_block_domain", "      - exec: jump has_resp_sequence"},
+		},
+		{
+			name:   "opt-out groups",
+			groups: []Group{{"tv", PolicyLocal}, {"guest", PolicyDefault}},
+			want: []string{
+				`      - matches: "!client_ip $client_tv $client_guest"`,
+				"        exec: $query_is_block_domain",
+				"      - exec: jump has_resp_sequence",
+			},
+		},
+		{
+			name:   "block-ads group",
+			groups: []Group{{"kids", PolicyBlockAds}, {"tv", PolicyNoAAAA}},
+			want: []string{
+				"      - matches: client_ip $client_kids",
+				"        exec: $query_is_block_domain",
+				`      - matches: "!client_ip $client_kids $client_tv"`,
+				"        exec: $query_is_block_domain",
+				"      - exec: jump has_resp_sequence",
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := blockRules(tt.groups); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: blockRules =\n%s\nwant\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestPolicyRules(t *testing.T) {
+	for _, p := range []Policy{PolicyDefault, PolicyBlockAds} {
+		if rules := policyRules(Group{Name: "g", Policy: p}); rules != nil {
+			t.Errorf("%s: policyRules = %q, want none", p, rules)
+		}
+	}
+	for _, p := range []Policy{PolicyLocal, PolicyRemote, PolicyNoAAAA} {
+		rules := policyRules(Group{Name: "g", Policy: p})
+		if len(rules) == 0 || !strings.Contains(strings.Join(rules, "\n"), "client_ip $client_g") {
+			t.Errorf("%s: policyRules = %q", p, rules)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 健康检查使用的域名，分别走国内与国外上游 (与 RunTest 一致)
+const (
+	ProbeDomestic = "www.baidu.com"
+	ProbeForeign  = "www.google.com"
+)
+
+// ProbeDomains 是健康检查默认探测的域名
+var ProbeDomains = []string{ProbeDomestic, ProbeForeign}
+
+var listenRegex = regexp.MustCompile(`type:\s*(\w+_server)\s*\n\s*args:\s*\n(?:\s+\w+:.*\n)*?\s+listen:\s*"?([^"\s#]+)"?`)
+
+// Listener 是 config.yaml 中一个服务插件的监听地址
+type Listener struct {
+	Type string `json:"type"` // udp_server / tcp_server / http_server ...
+	Addr string `json:"addr"`
+}
+
+// Listeners 返回 config.yaml 中全部服务插件的监听地址
+func Listeners() []Listener {
+	content, err := os.ReadFile(ConfigPath)
+	if err != nil {
+		return nil
+	}
+	var listeners []Listener
+	for _, match := range listenRegex.FindAllSubmatch(content, -1) {
+		listeners = append(listeners, Listener{Type: string(match[1]), Addr: string(match[2])})
+	}
+	return listeners
+}
+
+// ListenAddr 返回本机探测 MosDNS 使用的地址，监听全部地址时改用本机回环
+func ListenAddr() string {
+	listen := ":53"
+	for _, l := range Listeners() {
+		if l.Type == "udp_server" {
+			listen = l.Addr
+			break
+		}
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "127.0.0.1:53"
+	}
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// ProbeResult 是一次解析探测的结果
+type ProbeResult struct {
+	Domain  string
+	Addrs   []string
+	Latency time.Duration
+	Err     error
+}
+
+// Probe 通过 MosDNS 的 UDP 监听地址解析 domain
+func Probe(domain string, timeout time.Duration) ProbeResult {
+	addr := ListenAddr()
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", addr)
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	addrs, err := resolver.LookupHost(ctx, domain)
+	return ProbeResult{Domain: domain, Addrs: addrs, Latency: time.Since(start), Err: err}
+}
+
+// Healthy 返回 domains 中当前能够解析的域名
+func Healthy(domains []string, timeout time.Duration) []string {
+	var ok []string
+	for _, domain := range domains {
+		if Probe(domain, timeout).Err == nil {
+			ok = append(ok, domain)
+		}
+	}
+	return ok
+}
+
+// HealthCheck 在 wait 时间内反复探测，直到 domains 全部能够解析
+// MosDNS 重启后加载规则需要几秒，因此不会只探测一次；超时后返回仍然失败的域名
+func HealthCheck(domains []string, wait time.Duration) error {
+	deadline := time.Now().Add(wait)
+	pending := domains
+	var lastErr error
+	for {
+		var failed []string
+		for _, domain := range pending {
+			res := Probe(domain, 3*time.Second)
+			if res.Err != nil {
+				failed = append(failed, domain)
+				lastErr = res.Err
+				// net.DNSError 会带上系统 resolv.conf 中的服务器地址，容易误导
+				if dnsErr, ok := res.Err.(*net.DNSError); ok {
+					lastErr = errors.New(dnsErr.Err)
+				}
+			}
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("无法通过 %s 解析 %s: %v", ListenAddr(), strings.Join(failed, ", "), lastErr)
+		}
+		pending = failed
+		time.Sleep(time.Second)
+	}
+}
@@ -2,8 +2,6 @@ package config
 
 import (
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"regexp"
@@ -11,23 +9,33 @@ import (
 	"strings"
 	"time"
 
+	"github.com/KyleYu2024/mosctl/internal/api"
 	"github.com/KyleYu2024/mosctl/internal/service"
 )
 
 // GetCacheHitRate 获取缓存命中率
 func GetCacheHitRate() string {
-	resp, err := http.Get("http://127.0.0.1:8080/metrics")
+	hits, misses, err := CacheStats()
 	if err != nil {
 		return "0.0%"
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+	total := float64(hits + misses)
+	if total == 0 {
 		return "0.0%"
 	}
 
-	content := string(body)
+	rate := (float64(hits) / total) * 100
+	return fmt.Sprintf("%.1f%%", rate)
+}
+
+// CacheStats 从 metrics 读取缓存的命中与未命中次数
+func CacheStats() (hits, misses uint64, err error) {
+	content, err := api.Default().Metrics()
+	if err != nil {
+		return 0, 0, err
+	}
+
 	hitRegex := regexp.MustCompile(`mosdns_cache_hit_total\{tag="cache"\}\s+(\d+)`)
 	missRegex := regexp.MustCompile(`mosdns_cache_miss_total\{tag="cache"\}\s+(\d+)`)
 
@@ -35,19 +43,12 @@ func GetCacheHitRate() string {
 	missMatch := missRegex.FindStringSubmatch(content)
 
 	if len(hitMatch) < 2 || len(missMatch) < 2 {
-		return "0.0%"
+		return 0, 0, fmt.Errorf("metrics 中没有缓存统计")
 	}
 
-	hits, _ := strconv.ParseFloat(hitMatch[1], 64)
-	misses, _ := strconv.ParseFloat(missMatch[1], 64)
-
-	total := hits + misses
-	if total == 0 {
-		return "0.0%"
-	}
-
-	rate := (hits / total) * 100
-	return fmt.Sprintf("%.1f%%", rate)
+	hits, _ = strconv.ParseUint(hitMatch[1], 10, 64)
+	misses, _ = strconv.ParseUint(missMatch[1], 10, 64)
+	return hits, misses, nil
 }
 
 const (
@@ -74,6 +75,14 @@ func SetLastUpdate() {
 
 
 func SetUpstream(isLocal bool, addr string) error {
+	if err := WriteUpstream(isLocal, addr); err != nil {
+		return err
+	}
+	return service.RestartService()
+}
+
+// WriteUpstream 修改 config.yaml 中的上游地址但不重启服务 (供安装向导使用)
+func WriteUpstream(isLocal bool, addr string) error {
 	addr = strings.TrimSpace(addr)
 	if addr == "" {
 		return fmt.Errorf("地址不能为空")
@@ -100,11 +109,7 @@ func SetUpstream(isLocal bool, addr string) error {
 	}
 
 	updatedContent := re.ReplaceAllString(string(content), fmt.Sprintf(`addr: "%s" %s`, addr, tag))
-	if err := os.WriteFile(ConfigPath, []byte(updatedContent), 0644); err != nil {
-		return err
-	}
-
-	return service.RestartService()
+	return os.WriteFile(ConfigPath, []byte(updatedContent), 0644)
 }
 
 func SetCacheTTL(ttl string) error {
@@ -122,10 +127,38 @@ func SetCacheTTL(ttl string) error {
 	return service.RestartService()
 }
 
+// FlushCache 通过 API 清空缓存；API 不可用时退回删除 dump 文件并重启
 func FlushCache() error {
 	fmt.Println("🧹 正在清空 DNS 缓存...")
-	os.Remove("/etc/mosdns/cache.dump")
-	return service.RestartService()
+	dumpFile := api.DumpFile()
+	if err := api.Default().FlushCache(api.CacheTag); err != nil {
+		fmt.Printf("⚠️  API 清空失败 (%v)，改为重启服务清空\n", err)
+		os.Remove(dumpFile)
+		return service.RestartServiceDiscardCache()
+	}
+	// 同时删除磁盘上的 dump，避免下次启动时把旧缓存加载回来
+	os.Remove(dumpFile)
+	return nil
+}
+
+// SaveCache 把内存中的缓存导出到 path (为空时使用 dump_file)
+func SaveCache(path string) (int, error) {
+	if path == "" {
+		path = api.DumpFile()
+	}
+	return api.Default().SaveCache(api.CacheTag, path)
+}
+
+// LoadCache 把 path (为空时使用 dump_file) 中的缓存加载回 MosDNS
+func LoadCache(path string) error {
+	if path == "" {
+		path = api.DumpFile()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return api.Default().LoadCache(api.CacheTag, data)
 }
 
 // GetCurrentUpstreams 返回 (国内DNS, 国外DNS)
@@ -242,7 +275,11 @@ func GetLogSize() string {
 	if err != nil {
 		return "0 B"
 	}
-	size := info.Size()
+	return FormatSize(info.Size())
+}
+
+// FormatSize 把字节数格式化为 KB/MB 等易读形式
+func FormatSize(size int64) string {
 	const unit = 1024
 	if size < unit {
 		return fmt.Sprintf("%d B", size)
@@ -255,4 +292,83 @@ func GetLogSize() string {
 	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
+// 拦截模式：NXDOMAIN 或返回 0.0.0.0 / ::
+const (
+	BlockModeNXDomain = "nxdomain"
+	BlockModeZero     = "zero"
+)
+
+var blockExecRegex = regexp.MustCompile(`exec:\s*[^\n#]+#\s*TAG_BLOCK`)
+
+// BlockEnabled 判断当前配置是否包含广告拦截模块
+func BlockEnabled() bool {
+	content, err := os.ReadFile(ConfigPath)
+	if err != nil {
+		return false
+	}
+	return blockExecRegex.Match(content)
+}
 
+// GetBlockMode 获取当前拦截模式
+func GetBlockMode() string {
+	content, err := os.ReadFile(ConfigPath)
+	if err != nil {
+		return "未知"
+	}
+	match := blockExecRegex.Find(content)
+	if match == nil {
+		return "未启用"
+	}
+	if strings.Contains(string(match), "black_hole") {
+		return BlockModeZero
+	}
+	return BlockModeNXDomain
+}
+
+// SetBlockMode 设置拦截命中时的应答方式
+func SetBlockMode(mode string) error {
+	var exec string
+	switch mode {
+	case BlockModeNXDomain:
+		exec = "reject 3"
+	case BlockModeZero:
+		exec = "black_hole 0.0.0.0 ::"
+	default:
+		return fmt.Errorf("未知的拦截模式 %s (可选: %s, %s)", mode, BlockModeNXDomain, BlockModeZero)
+	}
+
+	content, err := os.ReadFile(ConfigPath)
+	if err != nil {
+		return err
+	}
+	if !blockExecRegex.Match(content) {
+		return fmt.Errorf("找不到标记 # TAG_BLOCK，请先更新 config.yaml 模板")
+	}
+
+	updatedContent := blockExecRegex.ReplaceAllString(string(content), "exec: "+exec+" # TAG_BLOCK")
+	if err := os.WriteFile(ConfigPath, []byte(updatedContent), 0644); err != nil {
+		return err
+	}
+
+	return service.RestartService()
+}
+
+// AttachRuleFile 把规则文件加入 config.yaml 中某个 domain_set / ip_set 插件的 files 列表
+// 已经存在时不做修改，返回值表示是否写入了配置
+func AttachRuleFile(tag, path string) (bool, error) {
+	content, err := os.ReadFile(ConfigPath)
+	if err != nil {
+		return false, err
+	}
+	text := string(content)
+	if strings.Contains(text, `"`+path+`"`) {
+		return false, nil
+	}
+	re := regexp.MustCompile(`(?m)^  - tag: ` + regexp.QuoteMeta(tag) + `\n    type: (domain_set|ip_set)\n    args:\n      files:\n`)
+	loc := re.FindStringIndex(text)
+	if loc == nil {
+		return false, fmt.Errorf("config.yaml 中找不到插件 %s 的 files 列表", tag)
+	}
+	text = text[:loc[1]] + fmt.Sprintf("        - %q\n", path) + text[loc[1]:]
+	return true, os.WriteFile(ConfigPath, []byte(text), 0644)
+}
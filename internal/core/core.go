@@ -0,0 +1,136 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+)
+
+// BackupPath 保存替换前的 mosdns，用于回滚
+const BackupPath = config.MosDNSBin + ".bak"
+
+// elfArch 把 ELF 机器类型映射为 GOARCH 名称
+var elfArch = map[elf.Machine]string{
+	elf.EM_X86_64:  "amd64",
+	elf.EM_386:     "386",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_ARM:     "arm",
+	elf.EM_MIPS:    "mips",
+	elf.EM_RISCV:   "riscv64",
+	elf.EM_PPC64:   "ppc64le",
+	elf.EM_S390:    "s390x",
+}
+
+// ReadBinary 读取 mosdns 可执行文件，path 也可以是官方发布的 mosdns-linux-*.zip
+func ReadBinary(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return data, nil
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("解压 %s 失败: %v", path, err)
+	}
+	for _, f := range zr.File {
+		if filepath.Base(f.Name) != "mosdns" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("%s 中没有 mosdns 可执行文件", path)
+}
+
+// Arch 返回 ELF 可执行文件对应的 GOARCH
+func Arch(data []byte) (string, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("不是 Linux 可执行文件: %v", err)
+	}
+	arch, ok := elfArch[f.Machine]
+	if !ok {
+		return f.Machine.String(), nil
+	}
+	if arch == "mips" && f.ByteOrder == binary.LittleEndian {
+		arch = "mipsle"
+	}
+	return arch, nil
+}
+
+// Version 运行 mosdns version，返回去掉 "mosdns" 前缀后的版本号
+func Version(bin string) (string, error) {
+	out, err := exec.Command(bin, "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("无法运行 %s: %v", bin, err)
+	}
+	v := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(out)), "mosdns"))
+	if v == "" {
+		return "", fmt.Errorf("%s 没有输出版本号", bin)
+	}
+	return v, nil
+}
+
+// Install 校验架构并试运行新的 mosdns，通过后原子替换 config.MosDNSBin
+// 旧文件保留为 BackupPath；内容相同时不替换，返回新版本号与是否替换
+// 不负责重启服务
+func Install(data []byte) (string, bool, error) {
+	arch, err := Arch(data)
+	if err != nil {
+		return "", false, err
+	}
+	if arch != runtime.GOARCH {
+		return "", false, fmt.Errorf("mosdns 是 %s 架构，本机是 %s", arch, runtime.GOARCH)
+	}
+
+	dir := filepath.Dir(config.MosDNSBin)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", false, err
+	}
+	tmp, err := os.CreateTemp(dir, ".mosdns.tmp-")
+	if err != nil {
+		return "", false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", false, err
+	}
+	tmp.Close()
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return "", false, err
+	}
+	version, err := Version(tmp.Name())
+	if err != nil {
+		return "", false, err
+	}
+
+	if old, err := os.ReadFile(config.MosDNSBin); err == nil {
+		if bytes.Equal(old, data) {
+			return version, false, nil
+		}
+		if err := os.WriteFile(BackupPath, old, 0755); err != nil {
+			return "", false, fmt.Errorf("备份旧版本失败: %v", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), config.MosDNSBin); err != nil {
+		return "", false, err
+	}
+	return version, true, nil
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestReadBinary(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "mosdns")
+	if err := os.WriteFile(plain, []byte("\x7fELF plain"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadBinary(plain); err != nil || string(data) != "\x7fELF plain" {
+		t.Errorf("ReadBinary(plain) = %q, %v", data, err)
+	}
+
+	writeZip := func(name string, files map[string]string) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		for n, content := range files {
+			w, err := zw.Create(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(content))
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		return path
+	}
+
+	release := writeZip("mosdns-linux-amd64.zip", map[string]string{
+		"LICENSE":    "GPL",
+		"README.md":  "readme",
+		"bin/mosdns": "\x7fELF zipped",
+	})
+	if data, err := ReadBinary(release); err != nil || string(data) != "\x7fELF zipped" {
+		t.Errorf("ReadBinary(zip) = %q, %v", data, err)
+	}
+
+	empty := writeZip("empty.zip", map[string]string{"LICENSE": "GPL"})
+	if _, err := ReadBinary(empty); err == nil {
+		t.Error("ReadBinary on zip without mosdns succeeded")
+	}
+}
+
+func TestArch(t *testing.T) {
+	if _, err := Arch([]byte("#!/bin/sh\n")); err == nil {
+		t.Error("Arch accepted a shell script")
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("测试程序本身不是 ELF 文件")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arch, err := Arch(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arch != runtime.GOARCH {
+		t.Errorf("Arch = %s, want %s", arch, runtime.GOARCH)
+	}
+}
+
+func TestSwapFiles(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "mosdns")
+	backup := bin + ".bak"
+	if err := os.WriteFile(bin, []byte("new"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(backup, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(wantBin, wantBackup string) {
+		t.Helper()
+		if data, _ := os.ReadFile(bin); string(data) != wantBin {
+			t.Errorf("bin = %q, want %q", data, wantBin)
+		}
+		if data, _ := os.ReadFile(backup); string(data) != wantBackup {
+			t.Errorf("backup = %q, want %q", data, wantBackup)
+		}
+	}
+
+	if err := swapFiles(bin, backup); err != nil {
+		t.Fatal(err)
+	}
+	check("old", "new")
+	info, err := os.Stat(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		t.Errorf("bin mode = %v, want executable", info.Mode())
+	}
+
+	// 再次交换回到原来的版本
+	if err := swapFiles(bin, backup); err != nil {
+		t.Fatal(err)
+	}
+	check("new", "old")
+
+	// 只有备份时直接恢复，备份保持不变
+	os.Remove(bin)
+	if err := swapFiles(bin, backup); err != nil {
+		t.Fatal(err)
+	}
+	check("old", "old")
+
+	// 没有备份时失败且不动 bin
+	os.Remove(backup)
+	if err := swapFiles(bin, backup); err == nil {
+		t.Error("swapFiles without backup succeeded")
+	}
+	if data, _ := os.ReadFile(bin); string(data) != "old" {
+		t.Errorf("bin changed to %q", data)
+	}
+
+	// 没有临时文件残留
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.Name() != "mosdns" {
+			t.Errorf("leftover file %s", e.Name())
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/service"
+)
+
+const (
+	// Repo 是 mosdns 的 GitHub 仓库
+	Repo = "IrineSistiana/mosdns"
+	// DefaultVersion 在无法查询最新版本时使用
+	DefaultVersion = "v5.3.3"
+)
+
+// Release 是 GitHub 上的一个 mosdns 发布版本
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+// Asset 是发布中的一个文件
+type Asset struct {
+	Name   string `json:"name"`
+	URL    string `json:"browser_download_url"`
+	Digest string `json:"digest"` // "sha256:<hex>"，较早的发布没有
+}
+
+// Resolve 查询 tag 对应的发布，tag 为空表示最新版本
+// 无法访问 GitHub API 时返回只有 Tag 的 Release 和错误 (tag 为空时使用 DefaultVersion)，
+// 调用方仍可下载，但无法校验 SHA-256
+func Resolve(tag string) (Release, error) {
+	url := "https://api.github.com/repos/" + Repo + "/releases/latest"
+	if tag != "" && tag != "latest" {
+		url = "https://api.github.com/repos/" + Repo + "/releases/tags/" + tag
+	}
+	var rel Release
+	if err := service.FetchJSON(url, &rel); err != nil || rel.Tag == "" {
+		if tag == "" || tag == "latest" {
+			tag = DefaultVersion
+		}
+		if err == nil {
+			err = fmt.Errorf("GitHub API 没有返回版本号")
+		}
+		return Release{Tag: tag}, fmt.Errorf("无法查询 mosdns 发布信息: %v", err)
+	}
+	return rel, nil
+}
+
+// AssetName 返回本机架构对应的发布文件名，如 mosdns-linux-amd64.zip
+func AssetName() string {
+	arch := runtime.GOARCH
+	switch arch {
+	case "arm":
+		arch = "arm-" + armVersion()
+	case "mips", "mipsle":
+		arch += "-softfloat"
+	}
+	return "mosdns-linux-" + arch + ".zip"
+}
+
+var cpuArchRegex = regexp.MustCompile(`(?m)^CPU architecture:\s*(\d+)`)
+
+// armVersion 从 /proc/cpuinfo 判断 ARM 版本 (5/6/7)，ARMv8 的 32 位系统按 7 处理
+func armVersion() string {
+	if data, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		if match := cpuArchRegex.FindSubmatch(data); match != nil {
+			switch v := string(match[1]); v {
+			case "5", "6", "7":
+				return v
+			}
+		}
+	}
+	if out, err := exec.Command("uname", "-m").Output(); err == nil {
+		machine := strings.TrimSpace(string(out))
+		for _, v := range []string{"5", "6"} {
+			if strings.HasPrefix(machine, "armv"+v) {
+				return v
+			}
+		}
+	}
+	return "7"
+}
+
+// asset 返回发布中本机架构的文件，发布信息不完整时按命名规则拼出下载地址
+func (r Release) asset() (Asset, error) {
+	name := AssetName()
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, nil
+		}
+	}
+	if len(r.Assets) > 0 {
+		return Asset{}, fmt.Errorf("mosdns %s 没有 %s", r.Tag, name)
+	}
+	return Asset{Name: name, URL: "https://github.com/" + Repo + "/releases/download/" + r.Tag + "/" + name}, nil
+}
+
+// Download 通过 mirrors 下载本机架构的发布 zip，校验 SHA-256 (发布信息中有 digest 时) 后返回 mosdns 可执行文件
+// zip 中文件的 CRC 在解压时校验；架构与能否运行由 Install 检查
+func Download(rel Release, mirrors []string) ([]byte, error) {
+	a, err := rel.asset()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "mosdns-download-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	dest := filepath.Join(dir, a.Name)
+	mirror, err := service.DownloadFileVia(mirrors, a.URL, dest)
+	if err != nil {
+		return nil, fmt.Errorf("下载 %s 失败: %v", a.Name, err)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	got := hex.EncodeToString(sum[:])
+	if want, ok := strings.CutPrefix(a.Digest, "sha256:"); ok {
+		if !strings.EqualFold(want, got) {
+			return nil, fmt.Errorf("%s 的 SHA-256 校验失败 (通过 %s 下载): 期望 %s，实际 %s", a.Name, service.MirrorName(mirror), want, got)
+		}
+		fmt.Printf("🔒 %s SHA-256 校验通过\n", a.Name)
+	} else {
+		fmt.Printf("⚠️  没有 %s 的官方 SHA-256，仅校验 zip 完整性 (%s)\n", a.Name, got[:12])
+	}
+	return ReadBinary(dest)
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/KyleYu2024/mosctl/internal/version"
+)
+
+const (
+	// startWait 是重启后等待 mosdns 加载配置的时间，配置不兼容时 mosdns 会在此期间退出
+	startWait = 3 * time.Second
+	// healthWait 是重启后等待解析恢复的最长时间
+	healthWait = 20 * time.Second
+)
+
+// Check 返回当前版本与最新发布，newer 表示最新发布比当前版本新
+func Check() (current string, latest Release, newer bool, err error) {
+	current, _ = Version(config.MosDNSBin)
+	latest, err = Resolve("")
+	if err != nil {
+		return current, Release{}, false, err
+	}
+	return current, latest, current == "" || version.Compare(latest.Tag, current) > 0, nil
+}
+
+// Upgrade 安装 tag 指定的版本 (为空表示最新版本)，mirrors 是 GitHub 加速前缀
+// 新版本无法用当前配置启动或无法解析时自动恢复旧版本
+func Upgrade(tag string, mirrors []string) error {
+	current, _ := Version(config.MosDNSBin)
+	rel, err := Resolve(tag)
+	if err != nil {
+		// 查询最新版本失败时无法判断该装哪个版本
+		if tag == "" || tag == "latest" {
+			return err
+		}
+		fmt.Printf("⚠️  %v，将直接下载 %s (无法校验 SHA-256)\n", err, rel.Tag)
+	}
+	if current != "" && version.Compare(current, rel.Tag) == 0 {
+		fmt.Printf("✔️  mosdns 已是 %s\n", current)
+		return nil
+	}
+
+	fmt.Printf("⬇️  正在下载 mosdns %s (%s)...\n", rel.Tag, AssetName())
+	data, err := Download(rel, mirrors)
+	if err != nil {
+		return err
+	}
+	baseline := config.Healthy(config.ProbeDomains, 2*time.Second)
+	installed, changed, err := Install(data)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Printf("✔️  mosdns %s 无变化\n", installed)
+		return nil
+	}
+	fmt.Printf("🔁 已替换 mosdns: %s -> %s，正在验证...\n", orUnknown(current), installed)
+
+	if err := restartVerified(baseline); err != nil {
+		fmt.Printf("❌ 新版本异常: %v\n", err)
+		fmt.Println("↩️  正在恢复旧版本...")
+		if rbErr := swapBackup(); rbErr != nil {
+			return fmt.Errorf("新版本异常 (%v)，且恢复旧版本失败: %v", err, rbErr)
+		}
+		if rbErr := restartVerified(baseline); rbErr != nil {
+			return fmt.Errorf("新版本异常 (%v)，已恢复旧版本，但服务仍然异常: %v", err, rbErr)
+		}
+		return fmt.Errorf("新版本异常 (%v)，已恢复 %s", err, orUnknown(current))
+	}
+	fmt.Printf("✅ mosdns 已更新为 %s (旧版本保留为 %s)\n", installed, BackupPath)
+	return nil
+}
+
+// Rollback 与 BackupPath 交换，恢复上一个版本；再次执行可以回到当前版本
+func Rollback() error {
+	if _, err := os.Stat(BackupPath); err != nil {
+		return fmt.Errorf("没有可回滚的版本 (%s 不存在)", BackupPath)
+	}
+	previous, err := Version(BackupPath)
+	if err != nil {
+		return fmt.Errorf("备份的 mosdns 无法运行: %v", err)
+	}
+	current, _ := Version(config.MosDNSBin)
+	baseline := config.Healthy(config.ProbeDomains, 2*time.Second)
+	if err := swapBackup(); err != nil {
+		return err
+	}
+	fmt.Printf("↩️  已回滚 mosdns: %s -> %s\n", orUnknown(current), previous)
+	if err := restartVerified(baseline); err != nil {
+		return fmt.Errorf("回滚后服务异常: %v，可再次执行 mosctl core rollback 恢复 %s", err, orUnknown(current))
+	}
+	fmt.Println("✅ 回滚完成，服务运行正常")
+	return nil
+}
+
+// swapBackup 交换 MosDNSBin 与 BackupPath，两个文件都通过改名替换，不会留下写了一半的文件
+func swapBackup() error {
+	return swapFiles(config.MosDNSBin, BackupPath)
+}
+
+// swapFiles 用 backup 的内容替换 bin，再把 bin 原来的内容写入 backup
+// 两份内容都先写入临时文件，全部写好后才依次改名替换，写入失败时两个文件都保持原样
+func swapFiles(bin, backup string) error {
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		return err
+	}
+	current, currentErr := os.ReadFile(bin)
+
+	tmpBin, err := stageFile(bin, data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpBin)
+	tmpBackup := ""
+	if currentErr == nil {
+		if tmpBackup, err = stageFile(backup, current); err != nil {
+			return err
+		}
+		defer os.Remove(tmpBackup)
+	}
+
+	if err := os.Rename(tmpBin, bin); err != nil {
+		return err
+	}
+	if tmpBackup != "" {
+		return os.Rename(tmpBackup, backup)
+	}
+	return nil
+}
+
+// stageFile 在 path 所在目录写入可执行的临时文件，返回其路径
+func stageFile(path string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".mosdns.tmp-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	tmp.Close()
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// restartVerified 重启服务并确认 mosdns 能用当前配置运行；baseline 是更新前能解析的域名，
+// 为空时 (例如服务原本就没有运行) 只检查进程是否存活
+func restartVerified(baseline []string) error {
+	if err := service.RestartService(); err != nil {
+		return fmt.Errorf("重启失败: %v", err)
+	}
+	time.Sleep(startWait)
+	st, err := service.GetStatus()
+	if err != nil {
+		return err
+	}
+	if !st.Active() {
+		return fmt.Errorf("mosdns 启动后退出 (%s)", st.Reason())
+	}
+	if len(baseline) == 0 {
+		return nil
+	}
+	fmt.Printf("🩺 正在检查解析 (%s)...\n", strings.Join(baseline, ", "))
+	return config.HealthCheck(baseline, healthWait)
+}
+
+func orUnknown(v string) string {
+	if v == "" {
+		return "未知版本"
+	}
+	return v
+}
@@ -0,0 +1,266 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/service"
+)
+
+// BindingsPath 保存分类与分流分支的绑定关系
+const BindingsPath = "/etc/mosdns/geo_bindings.json"
+
+// Branch 是可以绑定分类的分流分支
+type Branch string
+
+const (
+	BranchLocal  Branch = "local"  // 国内上游 (geosite_cn / geoip_cn)
+	BranchRemote Branch = "remote" // 国外上游 (geosite_no_cn)
+	BranchBlock  Branch = "block"  // 广告拦截 (geosite_block)
+)
+
+// Branches 列出所有分支
+var Branches = []Branch{BranchLocal, BranchRemote, BranchBlock}
+
+// bindTarget 是分支中接收导出结果的插件和文件
+type bindTarget struct {
+	Tag  string
+	Path string
+}
+
+// siteTargets / ipTargets 定义每个分支的 geosite 与 geoip 分类写入哪里
+// geoip 分类只能用于国内分支：geoip_cn 决定哪些应答 IP 被视为国内
+var (
+	siteTargets = map[Branch]bindTarget{
+		BranchLocal:  {Tag: "geosite_cn", Path: "/etc/mosdns/rules/geo_bind_local.txt"},
+		BranchRemote: {Tag: "geosite_no_cn", Path: "/etc/mosdns/rules/geo_bind_remote.txt"},
+		BranchBlock:  {Tag: "geosite_block", Path: "/etc/mosdns/rules/geo_bind_block.txt"},
+	}
+	ipTargets = map[Branch]bindTarget{
+		BranchLocal: {Tag: "geoip_cn", Path: "/etc/mosdns/rules/geo_bind_local_ip.txt"},
+	}
+)
+
+// Binding 把一个分类绑定到分支
+type Binding struct {
+	Category string `json:"category"`
+	Branch   Branch `json:"branch"`
+}
+
+// ParseBranch 校验分支名称
+func ParseBranch(s string) (Branch, error) {
+	for _, b := range Branches {
+		if string(b) == s {
+			return b, nil
+		}
+	}
+	names := make([]string, len(Branches))
+	for i, b := range Branches {
+		names[i] = string(b)
+	}
+	return "", fmt.Errorf("未知的分支 %q (可选: %s)", s, strings.Join(names, ", "))
+}
+
+// target 返回分类在分支中的写入位置
+func target(c Category, b Branch) (bindTarget, error) {
+	targets := siteTargets
+	if c.Dat == DatGeoIP {
+		targets = ipTargets
+	}
+	t, ok := targets[b]
+	if !ok {
+		return bindTarget{}, fmt.Errorf("%s 分类不能绑定到 %s 分支", c.Dat, b)
+	}
+	return t, nil
+}
+
+// Bindings 读取全部绑定
+func Bindings() ([]Binding, error) {
+	data, err := os.ReadFile(BindingsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var bindings []Binding
+	if err := json.Unmarshal(data, &bindings); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", BindingsPath, err)
+	}
+	return bindings, nil
+}
+
+func saveBindings(bindings []Binding) error {
+	data, err := json.MarshalIndent(bindings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(BindingsPath, append(data, '\n'), 0644)
+}
+
+// Bind 把分类绑定到分支，导出规则并重启 MosDNS
+func Bind(category string, branch Branch) error {
+	c, err := ParseCategory(category)
+	if err != nil {
+		return err
+	}
+	t, err := target(c, branch)
+	if err != nil {
+		return err
+	}
+	bindings, err := Bindings()
+	if err != nil {
+		return err
+	}
+	for _, b := range bindings {
+		if b.Category == c.String() {
+			return fmt.Errorf("%s 已绑定到 %s 分支，请先解除绑定", c, b.Branch)
+		}
+	}
+
+	// 先确认分类存在，避免保存一个无法导出的绑定
+	if err := EnsureDat(c.Dat, false); err != nil {
+		return err
+	}
+	rules, err := Extract(c)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("%s 中没有符合条件的条目", c)
+	}
+	if err := saveBindings(append(bindings, Binding{Category: c.String(), Branch: branch})); err != nil {
+		return err
+	}
+	fmt.Printf("✅ 已将 %s (%d 条) 绑定到 %s 分支\n", c, len(rules), branch)
+
+	if _, err := applyBindings(); err != nil {
+		return err
+	}
+	if _, err := config.AttachRuleFile(t.Tag, t.Path); err != nil {
+		return err
+	}
+	return restart()
+}
+
+// Unbind 解除分类绑定
+func Unbind(category string) error {
+	c, err := ParseCategory(category)
+	if err != nil {
+		return err
+	}
+	bindings, err := Bindings()
+	if err != nil {
+		return err
+	}
+	var kept []Binding
+	for _, b := range bindings {
+		if b.Category != c.String() {
+			kept = append(kept, b)
+		}
+	}
+	if len(kept) == len(bindings) {
+		return fmt.Errorf("%s 没有绑定到任何分支", c)
+	}
+	if err := saveBindings(kept); err != nil {
+		return err
+	}
+	fmt.Printf("🗑️  已解除 %s 的绑定\n", c)
+	if _, err := applyBindings(); err != nil {
+		return err
+	}
+	return restart()
+}
+
+// applyBindings 按绑定重新导出所有分支文件，返回内容发生变化的文件
+// 没有绑定的分支写入空文件 (config.yaml 可能仍引用它们)
+func applyBindings() ([]Source, error) {
+	bindings, err := Bindings()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[bindTarget][]string{}
+	kinds := map[bindTarget]Kind{}
+	for _, t := range siteTargets {
+		files[t] = nil
+		kinds[t] = KindDomain
+	}
+	for _, t := range ipTargets {
+		files[t] = nil
+		kinds[t] = KindCIDR
+	}
+	for _, b := range bindings {
+		c, err := ParseCategory(b.Category)
+		if err != nil {
+			return nil, err
+		}
+		t, err := target(c, b.Branch)
+		if err != nil {
+			return nil, err
+		}
+		rules, err := Extract(c)
+		if err != nil {
+			return nil, fmt.Errorf("导出 %s 失败: %v", c, err)
+		}
+		files[t] = append(files[t], rules...)
+	}
+
+	var changed []Source
+	for t, rules := range files {
+		// 从未绑定过的分支不需要创建文件
+		if _, err := os.Stat(t.Path); os.IsNotExist(err) && len(rules) == 0 {
+			continue
+		}
+		src := Source{Name: strings.TrimSuffix(filepath.Base(t.Path), ".txt"), Path: t.Path, Kind: kinds[t]}
+		wrote, err := writeGeneration(src.Name, src.Path, rules)
+		if err != nil {
+			return changed, err
+		}
+		if wrote {
+			changed = append(changed, src)
+		}
+	}
+	return changed, nil
+}
+
+// WriteList 原子写入规则文件，内容相同时不写，返回是否写入
+func WriteList(path string, lines []string) (bool, error) {
+	out := strings.Join(lines, "\n")
+	if out != "" {
+		out += "\n"
+	}
+	if old, err := os.ReadFile(path); err == nil && string(old) == out {
+		return false, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return false, err
+	}
+	if _, err := tmp.WriteString(out); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	tmp.Close()
+	os.Chmod(tmp.Name(), 0644)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	return true, nil
+}
+
+func restart() error {
+	fmt.Println("🔄 正在重载服务以生效绑定...")
+	if err := service.RestartService(); err != nil {
+		fmt.Printf("❌ 绑定已写入但服务重启失败: %v\n", err)
+		return err
+	}
+	fmt.Println("🎉 服务重载成功，绑定已生效！")
+	return nil
+}
@@ -0,0 +1,426 @@
+package geo
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/core"
+	"github.com/KyleYu2024/mosctl/internal/rule"
+)
+
+// 离线包是一个 tar.gz (或解压后的目录)，根目录下有 manifest.json 和各个文件，例如：
+//
+//	manifest.json
+//	geosite_cn.txt
+//	geoip_cn.txt
+//	geosite.dat
+//	geosite_block.txt
+//	mosdns          (可选)
+const (
+	manifestName   = "manifest.json"
+	manifestFormat = 1
+	coreFileName   = "mosdns"
+	// mirrorBundle 作为来自离线包的文件的 "镜像" 显示与记录
+	mirrorBundle = "离线包"
+)
+
+// Manifest 描述离线包的内容，安装前逐个核对 SHA-256 与大小
+type Manifest struct {
+	Format  int          `json:"format"`
+	Created time.Time    `json:"created"`
+	Files   []BundleFile `json:"files"`
+	Core    *BundleFile  `json:"core,omitempty"`
+}
+
+// BundleFile 是离线包中的一个文件
+type BundleFile struct {
+	Name    string `json:"name"` // 数据源名称，例如 geosite_cn；mosdns 本体为 "mosdns"
+	File    string `json:"file"` // 包内文件名
+	URL     string `json:"url,omitempty"`
+	SHA256  string `json:"sha256"`
+	Bytes   int64  `json:"bytes"`
+	Entries int    `json:"entries,omitempty"`
+	Version string `json:"version,omitempty"` // 仅 mosdns
+	Arch    string `json:"arch,omitempty"`    // 仅 mosdns
+}
+
+// CreateBundle 在有网络的机器上下载全部 Geo 列表 (含 dat 文件与合并后的拦截列表)，打包为 out
+// corePath 不为空时一并打包该 mosdns 可执行文件或官方 zip；不会改动本机的规则文件
+// 任一文件下载失败时不生成离线包
+func CreateBundle(out string, opts Options, corePath string) error {
+	staging, err := os.MkdirTemp("", "mosctl-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	all, err := Sources()
+	if err != nil {
+		return err
+	}
+	// 派生数据源由目标机器从 dat 文件生成，dat 文件总是打包，目标机器可能有分类绑定
+	var sources []Source
+	for _, src := range all {
+		if isDerived(src.URL) {
+			continue
+		}
+		src.Path = filepath.Join(staging, filepath.Base(src.Path))
+		sources = append(sources, src)
+	}
+	if err := useProxy(opts.Proxy); err != nil {
+		return err
+	}
+	mirrors := orderMirrors(Mirrors(), loadState())
+
+	m := Manifest{Format: manifestFormat, Created: time.Now().UTC()}
+	failCount := 0
+	for _, res := range fetchAll(sources, mirrors, nil, false, len(sources)) {
+		if res.Err != nil {
+			failCount++
+			continue
+		}
+		m.Files = append(m.Files, BundleFile{
+			Name:    res.Source.Name,
+			File:    filepath.Base(res.Source.Path),
+			URL:     res.URL,
+			SHA256:  res.SHA256,
+			Bytes:   fileSize(res.Source.Path),
+			Entries: res.Entries,
+		})
+	}
+
+	rules, err := rule.FetchBlocklists(mirrors)
+	if err != nil {
+		fmt.Printf("❌ 拦截列表下载失败: %v\n", err)
+		failCount++
+	} else {
+		path := filepath.Join(staging, filepath.Base(blockSource.Path))
+		if _, err := WriteList(path, rules); err != nil {
+			return err
+		}
+		m.Files = append(m.Files, BundleFile{
+			Name:    blockSource.Name,
+			File:    filepath.Base(path),
+			URL:     strings.Join(rule.BlockSources(), " "),
+			SHA256:  fileSHA256(path),
+			Bytes:   fileSize(path),
+			Entries: len(rules),
+		})
+		fmt.Printf("🛡️  拦截列表共 %d 条规则\n", len(rules))
+	}
+	if failCount > 0 {
+		return fmt.Errorf("%d 个文件下载失败，未生成离线包", failCount)
+	}
+
+	if corePath != "" {
+		data, err := core.ReadBinary(corePath)
+		if err != nil {
+			return err
+		}
+		arch, err := core.Arch(data)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(staging, coreFileName), data, 0755); err != nil {
+			return err
+		}
+		m.Core = &BundleFile{Name: coreFileName, File: coreFileName, SHA256: sha256Hex(data), Bytes: int64(len(data)), Arch: arch}
+		// 架构与本机相同时才能试运行获取版本号
+		if v, err := core.Version(filepath.Join(staging, coreFileName)); err == nil {
+			m.Core.Version = v
+		}
+		fmt.Printf("📦 已加入 mosdns (%s %s)\n", arch, m.Core.Version)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(staging, manifestName), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	if err := writeTarGz(out, staging, m); err != nil {
+		return fmt.Errorf("写入 %s 失败: %v", out, err)
+	}
+	fmt.Printf("✅ 离线包已生成: %s (%d 个文件, %s)\n", out, len(m.Files), config.FormatSize(fileSize(out)))
+	return nil
+}
+
+// ApplyBundle 从离线包 (tar.gz 或解压后的目录) 安装 Geo 列表；包中带有 mosdns 时一并安装，除非 skipCore
+// 每个文件先核对清单中的 SHA-256，再经过与在线更新相同的校验、备份与原子替换，最后按需重启 MosDNS
+func ApplyBundle(from string, opts Options, skipCore bool) error {
+	start := time.Now()
+	dir := from
+	if info, err := os.Stat(from); err != nil {
+		return err
+	} else if !info.IsDir() {
+		tmp, err := os.MkdirTemp("", "mosctl-bundle-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		if err := extractTarGz(from, tmp); err != nil {
+			return fmt.Errorf("解压 %s 失败: %v", from, err)
+		}
+		dir = tmp
+	}
+	m, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📦 离线包生成于 %s，共 %d 个文件\n", m.Created.Local().Format("2006-01-02 15:04"), len(m.Files))
+
+	os.MkdirAll(config.RuleDir, 0755)
+	os.MkdirAll(filepath.Dir(PathGeoSiteDat), 0755)
+	all, err := Sources()
+	if err != nil {
+		return err
+	}
+	bindings, err := Bindings()
+	if err != nil {
+		return err
+	}
+	var derived []Source
+	for _, src := range all {
+		if isDerived(src.URL) {
+			derived = append(derived, src)
+		}
+	}
+
+	logf := func(format string, args ...any) { fmt.Printf(format, args...) }
+	total := len(m.Files) + len(derived)
+	var results []Result
+	st := loadState()
+	for _, f := range m.Files {
+		src, ok := bundleTarget(all, f.Name)
+		if !ok {
+			fmt.Printf("⚠️  跳过 %s: 本机没有该数据源或该数据源由 dat 文件生成\n", f.Name)
+			total--
+			continue
+		}
+		if f.URL != "" && src.URL != "" && f.URL != src.URL {
+			fmt.Printf("⚠️  %s 本机的数据源是 %s，离线包来自 %s\n", src.Name, src.URL, f.URL)
+		}
+		res := installBundleFile(dir, f, src, opts.Force, logf)
+		results = append(results, res)
+		printResult(len(results), total, res)
+		if res.Err == nil {
+			// 文件已不是上次在线下载的内容，下次在线更新需要完整下载
+			delete(st.Sources, src.Name)
+		}
+	}
+	results = append(results, deriveAll(derived, opts.Force, len(results), total)...)
+	if err := saveState(st); err != nil {
+		fmt.Printf("⚠️  无法保存下载缓存信息: %v\n", err)
+	}
+
+	if m.Core != nil {
+		if skipCore {
+			fmt.Printf("💡 已跳过离线包中的 mosdns %s\n", m.Core.Version)
+		} else {
+			results = append(results, installBundleCore(dir, *m.Core))
+		}
+	}
+	return finish(Run{Time: start, From: from}, results, len(bindings) > 0)
+}
+
+// bundleTarget 返回离线包文件在本机对应的数据源；本机从 dat 派生的数据源不接受离线包中的版本
+func bundleTarget(sources []Source, name string) (Source, bool) {
+	if name == blockSource.Name {
+		return blockSource, true
+	}
+	for _, src := range sources {
+		if src.Name == name {
+			return src, !isDerived(src.URL)
+		}
+	}
+	return Source{}, false
+}
+
+// installBundleFile 核对清单后复制到目标目录的临时文件，交给 install 校验并替换
+func installBundleFile(dir string, f BundleFile, src Source, force bool, logf func(string, ...any)) Result {
+	res := Result{Source: src, URL: f.URL, Mirror: mirrorBundle, Bytes: f.Bytes, Attempts: 1}
+	data, err := readBundleFile(dir, f)
+	if err != nil {
+		res.Err = permanentError{err}
+		return res
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(src.Path), "."+filepath.Base(src.Path)+".tmp-")
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	return install(src, res, tmp.Name(), force, logf)
+}
+
+// installBundleCore 安装离线包中的 mosdns，旧版本保留为 core.BackupPath
+func installBundleCore(dir string, f BundleFile) Result {
+	res := Result{Source: Source{Name: coreFileName, Path: config.MosDNSBin}, Mirror: mirrorBundle, Bytes: f.Bytes, SHA256: f.SHA256, Attempts: 1}
+	data, err := readBundleFile(dir, f)
+	var version string
+	if err == nil {
+		version, res.Changed, err = core.Install(data)
+	}
+	switch {
+	case err != nil:
+		res.Err = err
+		fmt.Printf("❌ mosdns 安装失败: %v\n", err)
+	case res.Changed:
+		fmt.Printf("✅ mosdns 已更新为 %s\n", version)
+	default:
+		fmt.Printf("💤 mosdns %s 无变化\n", version)
+	}
+	return res
+}
+
+// readBundleFile 读取包内文件并核对大小与 SHA-256
+func readBundleFile(dir string, f BundleFile) ([]byte, error) {
+	if f.File != filepath.Base(f.File) || f.File == "." || f.File == ".." {
+		return nil, fmt.Errorf("清单中的文件名 %q 无效", f.File)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, f.File))
+	if err != nil {
+		return nil, fmt.Errorf("离线包缺少 %s", f.File)
+	}
+	if int64(len(data)) != f.Bytes {
+		return nil, fmt.Errorf("%s 大小不符 (清单 %d 字节，实际 %d 字节)", f.File, f.Bytes, len(data))
+	}
+	if sum := sha256Hex(data); sum != f.SHA256 {
+		return nil, fmt.Errorf("%s SHA-256 不匹配 (清单 %s，实际 %s)", f.File, f.SHA256, sum)
+	}
+	return data, nil
+}
+
+func readManifest(dir string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return m, fmt.Errorf("不是有效的离线包: 缺少 %s", manifestName)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("解析 %s 失败: %v", manifestName, err)
+	}
+	if m.Format != manifestFormat {
+		return m, fmt.Errorf("不支持的离线包格式 %d，请升级 mosctl", m.Format)
+	}
+	return m, nil
+}
+
+// writeTarGz 把 manifest 及其列出的文件打包，先写临时文件再改名
+func writeTarGz(out, dir string, m Manifest) error {
+	names := []string{manifestName}
+	for _, f := range m.Files {
+		names = append(names, f.File)
+	}
+	if m.Core != nil {
+		names = append(names, m.Core.File)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		if err := addTarFile(tw, filepath.Join(dir, name)); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	os.Chmod(tmp.Name(), 0644)
+	return os.Rename(tmp.Name(), out)
+}
+
+func addTarFile(tw *tar.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Uname, hdr.Gname = "", ""
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// extractTarGz 解压到 dir；只接受根目录下的普通文件，防止路径穿越
+func extractTarGz(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if hdr.Typeflag != tar.TypeReg || name != filepath.Base(name) || name == ".." {
+			continue
+		}
+		out, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,347 @@
+package geo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// v2ray 格式的 geosite.dat / geoip.dat，按需下载
+const (
+	PathGeoSiteDat = "/etc/mosdns/dat/geosite.dat"
+	PathGeoIPDat   = "/etc/mosdns/dat/geoip.dat"
+)
+
+// 分类所属的数据文件
+const (
+	DatGeoSite = "geosite"
+	DatGeoIP   = "geoip"
+)
+
+var errCorrupt = errors.New("文件已损坏或不是 v2ray dat 格式")
+
+// Category 是一个 v2ray 分类，例如 geosite:category-games@cn 或 geoip:private
+type Category struct {
+	Dat   string   // geosite 或 geoip
+	Code  string   // 分类名 (小写)
+	Attrs []string // 属性过滤，"!" 开头表示排除带该属性的域名
+}
+
+var categoryCodeRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.!-]*$`)
+
+// ParseCategory 解析 geosite:<name>[@attr...] 或 geoip:<code>
+func ParseCategory(s string) (Category, error) {
+	dat, rest, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	if !ok || (dat != DatGeoSite && dat != DatGeoIP) {
+		return Category{}, fmt.Errorf("%q 格式错误，应为 geosite:<分类>[@属性] 或 geoip:<代码>", s)
+	}
+	parts := strings.Split(rest, "@")
+	c := Category{Dat: dat, Code: parts[0]}
+	if !categoryCodeRegex.MatchString(c.Code) {
+		return Category{}, fmt.Errorf("分类名 %q 无效", c.Code)
+	}
+	for _, attr := range parts[1:] {
+		if strings.TrimPrefix(attr, "!") == "" {
+			return Category{}, fmt.Errorf("%q 中有空的属性", s)
+		}
+		c.Attrs = append(c.Attrs, attr)
+	}
+	if dat == DatGeoIP && len(c.Attrs) > 0 {
+		return Category{}, fmt.Errorf("geoip 分类不支持 @属性")
+	}
+	return c, nil
+}
+
+func (c Category) String() string {
+	s := c.Dat + ":" + c.Code
+	for _, attr := range c.Attrs {
+		s += "@" + attr
+	}
+	return s
+}
+
+// FileName 返回导出文件的默认文件名，例如 geosite_category-games@cn -> geosite_category-games_cn.txt
+func (c Category) FileName() string {
+	name := c.Dat + "_" + c.Code
+	for _, attr := range c.Attrs {
+		name += "_" + strings.ReplaceAll(attr, "!", "not-")
+	}
+	return name + ".txt"
+}
+
+// DatPath 返回分类所在的 dat 文件
+func (c Category) DatPath() string {
+	if c.Dat == DatGeoIP {
+		return PathGeoIPDat
+	}
+	return PathGeoSiteDat
+}
+
+// Extract 从本地 dat 文件中导出分类，geosite 返回 MosDNS 域名规则，geoip 返回 CIDR
+func Extract(c Category) ([]string, error) {
+	data, err := os.ReadFile(c.DatPath())
+	if err != nil {
+		return nil, err
+	}
+	if c.Dat == DatGeoIP {
+		return extractIP(data, c)
+	}
+	return extractSite(data, c)
+}
+
+// Categories 列出 dat 文件中的全部分类名
+func Categories(dat string) ([]string, error) {
+	path := PathGeoSiteDat
+	if dat == DatGeoIP {
+		path = PathGeoIPDat
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	err = eachEntry(data, func(code string, _ []byte) (bool, error) {
+		names = append(names, strings.ToLower(code))
+		return true, nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// v2ray routercommon.Domain.Type
+const (
+	domainPlain  = 0 // 关键字匹配
+	domainRegex  = 1
+	domainDomain = 2 // 子域名匹配
+	domainFull   = 3
+)
+
+// extractSite 解析 GeoSiteList{ repeated GeoSite entry = 1 }
+// GeoSite{ string country_code = 1; repeated Domain domain = 2 }
+// Domain{ Type type = 1; string value = 2; repeated Attribute attribute = 3 }
+func extractSite(data []byte, c Category) ([]string, error) {
+	var rules []string
+	found := false
+	err := eachEntry(data, func(code string, entry []byte) (bool, error) {
+		if !strings.EqualFold(code, c.Code) {
+			return true, nil
+		}
+		found = true
+		return false, eachField(entry, func(num int, _ uint64, msg []byte) error {
+			if num != 2 {
+				return nil
+			}
+			rule, attrs, err := parseDomain(msg)
+			if err != nil {
+				return err
+			}
+			if matchAttrs(attrs, c.Attrs) {
+				rules = append(rules, rule)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("geosite.dat 中没有分类 %s", c.Code)
+	}
+	return rules, nil
+}
+
+func parseDomain(msg []byte) (string, map[string]bool, error) {
+	var typ uint64
+	var value string
+	attrs := map[string]bool{}
+	err := eachField(msg, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			typ = v
+		case 2:
+			value = string(data)
+		case 3:
+			// Attribute{ string key = 1; oneof { bool bool_value = 2; int64 int_value = 3 } }
+			return eachField(data, func(num int, _ uint64, data []byte) error {
+				if num == 1 {
+					attrs[strings.ToLower(string(data))] = true
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	switch typ {
+	case domainPlain:
+		return "keyword:" + value, attrs, nil
+	case domainRegex:
+		return "regexp:" + value, attrs, nil
+	case domainFull:
+		return "full:" + value, attrs, nil
+	default:
+		return "domain:" + value, attrs, nil
+	}
+}
+
+// matchAttrs 要求具备全部属性，并且不具备任何 "!" 开头的属性
+func matchAttrs(have map[string]bool, want []string) bool {
+	for _, attr := range want {
+		if name, ok := strings.CutPrefix(attr, "!"); ok {
+			if have[name] {
+				return false
+			}
+		} else if !have[attr] {
+			return false
+		}
+	}
+	return true
+}
+
+// extractIP 解析 GeoIPList{ repeated GeoIP entry = 1 }
+// GeoIP{ string country_code = 1; repeated CIDR cidr = 2; bool reverse_match = 3 }
+// CIDR{ bytes ip = 1; uint32 prefix = 2 }
+func extractIP(data []byte, c Category) ([]string, error) {
+	var cidrs []string
+	found := false
+	err := eachEntry(data, func(code string, entry []byte) (bool, error) {
+		if !strings.EqualFold(code, c.Code) {
+			return true, nil
+		}
+		found = true
+		return false, eachField(entry, func(num int, v uint64, msg []byte) error {
+			switch num {
+			case 2:
+				cidr, err := parseCIDR(msg)
+				if err != nil {
+					return err
+				}
+				cidrs = append(cidrs, cidr)
+			case 3:
+				if v != 0 {
+					return fmt.Errorf("不支持反向匹配的 geoip 分类 %s", c.Code)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("geoip.dat 中没有分类 %s", c.Code)
+	}
+	return cidrs, nil
+}
+
+func parseCIDR(msg []byte) (string, error) {
+	var ip net.IP
+	var prefix uint64
+	err := eachField(msg, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			ip = net.IP(data)
+		case 2:
+			prefix = v
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return "", errCorrupt
+	}
+	if prefix > uint64(len(ip)*8) {
+		return "", errCorrupt
+	}
+	ipNet := net.IPNet{IP: ip, Mask: net.CIDRMask(int(prefix), len(ip)*8)}
+	return ipNet.String(), nil
+}
+
+// eachEntry 遍历 GeoSiteList / GeoIPList 的每个条目 (两者结构相同：field 1 为条目，条目的 field 1 为分类名)
+// fn 返回 false 时停止遍历
+func eachEntry(data []byte, fn func(code string, entry []byte) (bool, error)) error {
+	stop := errors.New("stop")
+	err := eachField(data, func(num int, _ uint64, entry []byte) error {
+		if num != 1 {
+			return nil
+		}
+		code := ""
+		err := eachField(entry, func(num int, _ uint64, data []byte) error {
+			if num == 1 {
+				code = string(data)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		more, err := fn(code, entry)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return stop
+		}
+		return nil
+	})
+	if err == stop {
+		return nil
+	}
+	return err
+}
+
+// eachField 按 protobuf wire 格式遍历消息的字段
+// varint 字段的值通过 v 传入，length-delimited 字段的内容通过 data 传入，其他类型跳过
+func eachField(msg []byte, fn func(num int, v uint64, data []byte) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errCorrupt
+		}
+		msg = msg[n:]
+		num := int(key >> 3)
+		switch key & 7 {
+		case 0: // varint
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return errCorrupt
+			}
+			msg = msg[n:]
+			if err := fn(num, v, nil); err != nil {
+				return err
+			}
+		case 1: // 64-bit
+			if len(msg) < 8 {
+				return errCorrupt
+			}
+			msg = msg[8:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || l > uint64(len(msg)-n) {
+				return errCorrupt
+			}
+			data := msg[n : n+int(l)]
+			msg = msg[n+int(l):]
+			if err := fn(num, 0, data); err != nil {
+				return err
+			}
+		case 5: // 32-bit
+			if len(msg) < 4 {
+				return errCorrupt
+			}
+			msg = msg[4:]
+		default:
+			return errCorrupt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package geo
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// 测试用的 protobuf 编码
+func pbVarint(num int, v uint64) []byte {
+	b := binary.AppendUvarint(nil, uint64(num)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func pbBytes(num int, data []byte) []byte {
+	b := binary.AppendUvarint(nil, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func pbMsg(fields ...[]byte) []byte {
+	var b []byte
+	for _, f := range fields {
+		b = append(b, f...)
+	}
+	return b
+}
+
+func domain(typ uint64, value string, attrs ...string) []byte {
+	fields := [][]byte{pbVarint(1, typ), pbBytes(2, []byte(value))}
+	for _, a := range attrs {
+		fields = append(fields, pbBytes(3, pbMsg(pbBytes(1, []byte(a)), pbVarint(2, 1))))
+	}
+	return pbBytes(2, pbMsg(fields...))
+}
+
+func geoSiteList() []byte {
+	return pbMsg(
+		pbBytes(1, pbMsg(pbBytes(1, []byte("GOOGLE")), domain(domainDomain, "google.com"))),
+		pbBytes(1, pbMsg(
+			pbBytes(1, []byte("CATEGORY-GAMES")),
+			domain(domainDomain, "steampowered.com"),
+			domain(domainFull, "cdn.games.cn", "cn"),
+			domain(domainPlain, "gamecdn", "cn", "ads"),
+			domain(domainRegex, `^play\d+\.example\.com$`),
+			// 未知字段与 64/32 位字段应被跳过
+			pbVarint(9, 7),
+			[]byte{0x51, 1, 2, 3, 4, 5, 6, 7, 8},
+			[]byte{0x5d, 1, 2, 3, 4},
+		)),
+	)
+}
+
+func TestExtractSite(t *testing.T) {
+	tests := []struct {
+		category string
+		want     []string
+	}{
+		{"geosite:google", []string{"domain:google.com"}},
+		{"geosite:category-games", []string{"domain:steampowered.com", "full:cdn.games.cn", "keyword:gamecdn", `regexp:^play\d+\.example\.com$`}},
+		{"geosite:category-games@cn", []string{"full:cdn.games.cn", "keyword:gamecdn"}},
+		{"geosite:category-games@cn@!ads", []string{"full:cdn.games.cn"}},
+		{"geosite:category-games@!cn", []string{"domain:steampowered.com", `regexp:^play\d+\.example\.com$`}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCategory(tt.category)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := extractSite(geoSiteList(), c)
+		if err != nil {
+			t.Errorf("%s: %v", tt.category, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %q, want %q", tt.category, got, tt.want)
+		}
+	}
+
+	if _, err := extractSite(geoSiteList(), Category{Dat: DatGeoSite, Code: "netflix"}); err == nil {
+		t.Error("missing category did not return an error")
+	}
+}
+
+func cidr(ip []byte, prefix uint64) []byte {
+	return pbBytes(2, pbMsg(pbBytes(1, ip), pbVarint(2, prefix)))
+}
+
+func TestExtractIP(t *testing.T) {
+	data := pbMsg(
+		pbBytes(1, pbMsg(pbBytes(1, []byte("CN")),
+			cidr([]byte{1, 0, 1, 0}, 24),
+			cidr([]byte{0x24, 0x0e, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 20),
+		)),
+		pbBytes(1, pbMsg(pbBytes(1, []byte("BAD")), cidr([]byte{1, 2, 3}, 24))),
+		pbBytes(1, pbMsg(pbBytes(1, []byte("WIDE")), cidr([]byte{1, 2, 3, 4}, 33))),
+		pbBytes(1, pbMsg(pbBytes(1, []byte("REV")), cidr([]byte{1, 2, 3, 4}, 8), pbVarint(3, 1))),
+	)
+
+	got, err := extractIP(data, Category{Dat: DatGeoIP, Code: "cn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.0.1.0/24", "240e::/20"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("geoip:cn = %q, want %q", got, want)
+	}
+	for _, code := range []string{"bad", "wide", "rev", "us"} {
+		if _, err := extractIP(data, Category{Dat: DatGeoIP, Code: code}); err == nil {
+			t.Errorf("geoip:%s did not return an error", code)
+		}
+	}
+}
+
+func TestEachFieldCorrupt(t *testing.T) {
+	tests := map[string][]byte{
+		"truncated key":    {0x80},
+		"truncated varint": {0x08, 0x80},
+		"length overflow":  {0x0a, 0x05, 'a'},
+		"truncated 64-bit": {0x09, 1, 2},
+		"truncated 32-bit": {0x0d, 1},
+	}
+	for name, data := range tests {
+		if err := eachField(data, func(int, uint64, []byte) error { return nil }); err != errCorrupt {
+			t.Errorf("%s: err = %v, want errCorrupt", name, err)
+		}
+	}
+}
+
+func TestParseCategory(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		file string
+	}{
+		{"geosite:CN", "geosite:cn", "geosite_cn.txt"},
+		{" geosite:category-games@cn@!ads ", "geosite:category-games@cn@!ads", "geosite_category-games_cn_not-ads.txt"},
+		{"geoip:private", "geoip:private", "geoip_private.txt"},
+		{"geoip:cn@x", "", ""},
+		{"geosite:", "", ""},
+		{"geosite:cn@", "", ""},
+		{"geosite:cn@!", "", ""},
+		{"site:cn", "", ""},
+		{"cn", "", ""},
+	}
+	for _, tt := range tests {
+		c, err := ParseCategory(tt.in)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseCategory(%q) = %v, want error", tt.in, c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCategory(%q) error: %v", tt.in, err)
+			continue
+		}
+		if c.String() != tt.want || c.FileName() != tt.file {
+			t.Errorf("ParseCategory(%q) = %s (%s), want %s (%s)", tt.in, c, c.FileName(), tt.want, tt.file)
+		}
+	}
+}
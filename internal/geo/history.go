@@ -0,0 +1,317 @@
+package geo
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// HistoryPath 每次更新追加一行 JSON 记录
+	HistoryPath = "/etc/mosdns/geo_history.jsonl"
+	// PrevDir 保存每个文件被替换前的上一版本，供 geo diff 使用
+	PrevDir = "/etc/mosdns/geo_prev"
+	// historyLimit 最多保留的更新记录数
+	historyLimit = 100
+)
+
+// FileRecord 是一次更新中单个文件的结果
+type FileRecord struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	URL     string `json:"url,omitempty"`
+	Mirror  string `json:"mirror,omitempty"`
+	Bytes   int64  `json:"bytes,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+	Entries int    `json:"entries"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+	// RolledBack 表示更新后健康检查失败，文件已恢复为上一版本
+	RolledBack bool `json:"rolled_back,omitempty"`
+}
+
+// Run 是一次 mosctl update 的记录
+type Run struct {
+	Time      time.Time    `json:"time"`
+	From      string       `json:"from,omitempty"` // 离线包路径，为空表示在线更新
+	OK        bool         `json:"ok"`
+	Error     string       `json:"error,omitempty"`
+	Restarted bool         `json:"restarted"`
+	Files     []FileRecord `json:"files"`
+}
+
+// Failed 返回失败的文件数
+func (r Run) Failed() int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// record 把单个文件的更新结果转换为历史记录
+func (res Result) record() FileRecord {
+	rec := FileRecord{
+		Name:    res.Source.Name,
+		Path:    res.Source.Path,
+		URL:     res.URL,
+		Mirror:  res.Mirror,
+		Bytes:   res.Bytes,
+		SHA256:  res.SHA256,
+		Entries: res.Entries,
+		Added:   res.Added,
+		Removed: res.Removed,
+		Changed: res.Changed,
+	}
+	if res.Err != nil {
+		rec.Error = res.Err.Error()
+	}
+	rec.RolledBack = res.RolledBack
+	return rec
+}
+
+// appendHistory 追加一条记录，并只保留最近 historyLimit 条
+func appendHistory(run Run) error {
+	runs, _ := History()
+	runs = append(runs, run)
+	if len(runs) > historyLimit {
+		runs = runs[len(runs)-historyLimit:]
+	}
+	var b strings.Builder
+	for _, r := range runs {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	tmp := HistoryPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, HistoryPath)
+}
+
+// History 按时间顺序读取全部更新记录，损坏的行会被跳过
+func History() ([]Run, error) {
+	f, err := os.Open(HistoryPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var runs []Run
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Run
+		if json.Unmarshal(scanner.Bytes(), &r) == nil {
+			runs = append(runs, r)
+		}
+	}
+	return runs, scanner.Err()
+}
+
+// LastRun 返回最近一次更新记录
+func LastRun() (Run, bool) {
+	runs, err := History()
+	if err != nil || len(runs) == 0 {
+		return Run{}, false
+	}
+	return runs[len(runs)-1], true
+}
+
+// LastUpdateSummary 返回菜单中 "上次" 一栏的内容，最近一次失败时附带上次成功的时间
+func LastUpdateSummary(lastSuccess string) string {
+	runs, err := History()
+	if err != nil || len(runs) == 0 {
+		return lastSuccess
+	}
+	last := runs[len(runs)-1]
+	when := last.Time.Local().Format("2006-01-02 15:04")
+	if last.OK {
+		return when + " ✅"
+	}
+	summary := when + " ❌ 失败"
+	if n := last.Failed(); n > 0 {
+		summary = fmt.Sprintf("%s ❌ %d 个文件失败", when, n)
+	}
+	for i := len(runs) - 2; i >= 0; i-- {
+		if runs[i].OK {
+			return summary + "，上次成功 " + runs[i].Time.Local().Format("01-02 15:04")
+		}
+	}
+	return summary
+}
+
+// prevPath 返回数据源上一版本的保存位置
+func prevPath(name, path string) string {
+	return filepath.Join(PrevDir, name+filepath.Ext(path))
+}
+
+// keepPrevious 在替换 path 之前保留当前版本 (优先使用硬链接，不额外占用空间)
+func keepPrevious(name, path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.MkdirAll(PrevDir, 0755); err != nil {
+		return err
+	}
+	dest := prevPath(name, path)
+	os.Remove(dest)
+	if os.Link(path, dest) == nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest, data, 0644)
+}
+
+// writeGeneration 内容有变化时先保留上一版本，再原子写入新的规则列表
+func writeGeneration(name, path string, lines []string) (bool, error) {
+	out := strings.Join(lines, "\n")
+	if out != "" {
+		out += "\n"
+	}
+	if old, err := os.ReadFile(path); err == nil && string(old) == out {
+		return false, nil
+	}
+	if err := keepPrevious(name, path); err != nil {
+		fmt.Printf("⚠️  %s 无法保留上一版本: %v\n", name, err)
+	}
+	return WriteList(path, lines)
+}
+
+// restorePrevious 把文件恢复为 PrevDir 中保存的上一版本 (复制后原子替换，上一版本仍然保留)
+func restorePrevious(name, path string) error {
+	data, err := os.ReadFile(prevPath(name, path))
+	if err != nil {
+		return fmt.Errorf("没有可用的上一版本")
+	}
+	return replaceFile(path, data, 0644)
+}
+
+// replaceFile 通过同目录临时文件原子替换 path
+func replaceFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// entrySet 读取文件中的条目集合；dat 文件以分类名作为条目
+func entrySet(path string, kind Kind) map[string]bool {
+	set := map[string]bool{}
+	if kind.isDat() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return set
+		}
+		eachEntry(data, func(code string, _ []byte) (bool, error) {
+			set[strings.ToLower(code)] = true
+			return true, nil
+		})
+		return set
+	}
+	for _, line := range readListLines(path) {
+		set[line] = true
+	}
+	return set
+}
+
+// readListLines 读取文本列表中的有效行
+func readListLines(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// diffSets 返回 after 相比 before 新增与删除的条目 (已排序)
+func diffSets(before, after map[string]bool) (added, removed []string) {
+	for e := range after {
+		if !before[e] {
+			added = append(added, e)
+		}
+	}
+	for e := range before {
+		if !after[e] {
+			removed = append(removed, e)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// Diff 比较数据源的上一版本与当前版本
+func Diff(src Source) (added, removed []string, err error) {
+	prev := prevPath(src.Name, src.Path)
+	if _, err := os.Stat(prev); err != nil {
+		return nil, nil, fmt.Errorf("没有 %s 的上一版本 (文件还没有被更新替换过)", src.Name)
+	}
+	added, removed = diffSets(entrySet(prev, src.Kind), entrySet(src.Path, src.Kind))
+	return added, removed, nil
+}
+
+// FindSource 按名称、文件名或完整路径查找数据源
+func FindSource(name string) (Source, error) {
+	sources, err := Sources()
+	if err != nil {
+		return Source{}, err
+	}
+	for _, src := range append(sources, blockSource) {
+		if name == src.Name || name == src.Path || name == filepath.Base(src.Path) {
+			return src, nil
+		}
+	}
+	return Source{}, fmt.Errorf("未知的文件 %s (可选: %s, %s)", name, strings.Join(sourceNames(), ", "), blockSource.Name)
+}
+
+func fileSHA256(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return sha256Hex(data)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
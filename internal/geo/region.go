@@ -0,0 +1,162 @@
+package geo
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultRegion 是默认的 "本地" 地区
+const DefaultRegion = "cn"
+
+// 派生数据源不需要下载，而是在 dat 文件下载完成后从中生成：
+//
+//	geosite:<分类> / geoip:<代码>  从 geosite.dat / geoip.dat 导出
+//	region:<cc>                   国家顶级域名，加上 geosite.dat 中该地区的分类 (如果存在)
+//	none                          空列表，用于只对中国大陆有意义的列表
+const (
+	regionScheme = "region:"
+	noneSource   = "none"
+)
+
+var regionRegex = regexp.MustCompile(`^[a-z]{2}$`)
+
+// isDerived 判断数据源是否从 dat 文件派生
+func isDerived(url string) bool {
+	return url == noneSource || strings.HasPrefix(url, DatGeoSite+":") || strings.HasPrefix(url, DatGeoIP+":") || strings.HasPrefix(url, regionScheme)
+}
+
+// Region 返回当前的本地地区代码
+func Region() string {
+	s, err := loadSettings()
+	if err != nil || s.Region == "" {
+		return DefaultRegion
+	}
+	return s.Region
+}
+
+// regionSources 返回地区对应的数据源，默认地区 (设置中保存为空) 返回 nil
+// 分流只看 geosite_cn：命中的域名走国内上游，其余交给国外上游。geoip_cn 只在 Apple 分流中
+// 用来过滤结果，apple-cn 与 proxy-list 又是针对中国大陆的列表，其他地区清空后 geoip_cn 不再生效，保持原样
+func regionSources(region string) map[string]string {
+	if region == "" || region == DefaultRegion {
+		return nil
+	}
+	return map[string]string{
+		"geosite_cn":    regionScheme + region,
+		"geosite_apple": noneSource,
+		"geosite_no_cn": noneSource,
+	}
+}
+
+// SetRegion 设置本地地区；geosite_cn.txt 等文件名保持不变，只替换内容来源
+// 用户通过 geo source set 自定义过的数据源不受影响，返回这些被跳过的数据源
+func SetRegion(region string) ([]string, error) {
+	region = strings.ToLower(strings.TrimSpace(region))
+	if !regionRegex.MatchString(region) {
+		return nil, fmt.Errorf("%q 不是两位国家/地区代码 (例如 cn、hk、jp)", region)
+	}
+	// geoip.dat 已下载时用其中的国家/地区代码校验输入
+	if codes, err := Categories(DatGeoIP); err == nil && !slices.Contains(codes, region) {
+		return nil, fmt.Errorf("geoip.dat 中没有地区 %q", region)
+	}
+	s, err := loadSettings()
+	if err != nil {
+		return nil, err
+	}
+	var skipped []string
+	for name := range regionSources(region) {
+		if _, ok := s.Sources[name]; ok {
+			skipped = append(skipped, name)
+		}
+	}
+	slices.Sort(skipped)
+
+	s.Region = region
+	if region == DefaultRegion {
+		s.Region = ""
+	}
+	return skipped, saveSettings(s)
+}
+
+// regionCategories 是 geosite.dat 中可能代表某地区的分类，按优先级排列
+func regionCategories(region string) []string {
+	return []string{"geolocation-" + region, "tld-" + region, region}
+}
+
+// RegionCategory 返回 geosite.dat 中代表 region 的分类；没有时本地域名列表只有国家顶级域名，
+// 其余域名都交给国外上游
+func RegionCategory(region string) (string, bool) {
+	names, err := Categories(DatGeoSite)
+	if err != nil {
+		return "", false
+	}
+	for _, name := range regionCategories(region) {
+		if slices.Contains(names, name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// derive 生成派生数据源的内容
+func derive(url string) ([]string, error) {
+	if url == noneSource {
+		return nil, nil
+	}
+	if region, ok := strings.CutPrefix(url, regionScheme); ok {
+		rules := []string{"domain:" + region}
+		if _, err := Categories(DatGeoSite); err != nil {
+			return nil, err
+		}
+		name, ok := RegionCategory(region)
+		if !ok {
+			return rules, nil
+		}
+		extra, err := Extract(Category{Dat: DatGeoSite, Code: name})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range extra {
+			if r != rules[0] {
+				rules = append(rules, r)
+			}
+		}
+		return rules, nil
+	}
+	c, err := ParseCategory(url)
+	if err != nil {
+		return nil, err
+	}
+	return Extract(c)
+}
+
+// deriveSource 从本地 dat 文件生成派生数据源，内容有变化时原子替换
+func deriveSource(src Source, force bool) Result {
+	res := Result{Source: src, URL: src.URL}
+	rules, err := derive(src.URL)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Entries = len(rules)
+	if err := checkSize(src, len(rules), force); err != nil {
+		res.Err = err
+		return res
+	}
+
+	before := entrySet(src.Path, src.Kind)
+	res.SHA256 = sha256Hex([]byte(strings.Join(rules, "\n") + "\n"))
+	res.Changed, res.Err = writeGeneration(src.Name, src.Path, rules)
+	if !res.Changed {
+		return res
+	}
+	after := map[string]bool{}
+	for _, r := range rules {
+		after[r] = true
+	}
+	added, removed := diffSets(before, after)
+	res.Added, res.Removed = len(added), len(removed)
+	return res
+}
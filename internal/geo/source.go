@@ -0,0 +1,285 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/rule"
+	"github.com/KyleYu2024/mosctl/internal/service"
+)
+
+// SettingsPath 保存用户自定义的 Geo 数据源与镜像前缀
+const SettingsPath = "/etc/mosdns/geo_sources.json"
+
+// Source 描述一个 Geo 列表文件及其下载地址
+type Source struct {
+	Name       string // 例如 geosite_cn
+	Path       string // 本地文件路径
+	URL        string // 当前生效的下载地址
+	Kind       Kind   // 文件内容类型，用于下载后校验
+	MinEntries int    // 少于该条目数视为下载异常
+	OnDemand   bool   // 只有存在分类绑定时才随 update 一起更新
+}
+
+// defaultSources 是内置的数据源，顺序即更新顺序
+var defaultSources = []Source{
+	{Name: "geosite_cn", Path: rule.PathGeoSiteCN, URL: "https://raw.githubusercontent.com/Loyalsoldier/v2ray-rules-dat/release/direct-list.txt", Kind: KindDomain, MinEntries: 1000},
+	{Name: "geoip_cn", Path: rule.PathGeoIPCN, URL: "https://raw.githubusercontent.com/Loyalsoldier/geoip/release/text/cn.txt", Kind: KindCIDR, MinEntries: 1000},
+	{Name: "geosite_apple", Path: rule.PathGeoSiteApple, URL: "https://raw.githubusercontent.com/Loyalsoldier/v2ray-rules-dat/release/apple-cn.txt", Kind: KindDomain, MinEntries: 10},
+	{Name: "geosite_no_cn", Path: rule.PathGeoSiteNoCN, URL: "https://raw.githubusercontent.com/Loyalsoldier/v2ray-rules-dat/release/proxy-list.txt", Kind: KindDomain, MinEntries: 1000},
+	{Name: "geosite_dat", Path: PathGeoSiteDat, URL: "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geosite.dat", Kind: KindSiteDat, MinEntries: 100, OnDemand: true},
+	{Name: "geoip_dat", Path: PathGeoIPDat, URL: "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geoip.dat", Kind: KindIPDat, MinEntries: 10, OnDemand: true},
+}
+
+// Presets 是常用的替代数据源，可以用名字代替完整 URL
+var Presets = map[string]map[string]string{
+	"geosite_cn": {
+		"loyalsoldier": "https://raw.githubusercontent.com/Loyalsoldier/v2ray-rules-dat/release/direct-list.txt",
+		"felixonmars":  "https://raw.githubusercontent.com/felixonmars/dnsmasq-china-list/master/accelerated-domains.china.conf",
+	},
+	"geoip_cn": {
+		"loyalsoldier": "https://raw.githubusercontent.com/Loyalsoldier/geoip/release/text/cn.txt",
+		"17mon":        "https://raw.githubusercontent.com/17mon/china_ip_list/master/china_ip_list.txt",
+	},
+	"geosite_dat": {
+		"loyalsoldier": "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geosite.dat",
+		"v2fly":        "https://github.com/v2fly/domain-list-community/releases/latest/download/dlc.dat",
+	},
+	"geoip_dat": {
+		"loyalsoldier": "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geoip.dat",
+		"v2fly":        "https://github.com/v2fly/geoip/releases/latest/download/geoip.dat",
+	},
+}
+
+// settings 是 geo_sources.json 的内容
+type settings struct {
+	Mirrors []string          `json:"mirrors,omitempty"` // 按顺序尝试的加速前缀，空字符串表示直连；nil 时使用默认顺序
+	Proxy   string            `json:"proxy,omitempty"`   // 下载使用的代理，为空时读取 HTTP_PROXY 等环境变量
+	Region  string            `json:"region,omitempty"`  // 本地地区代码，为空表示 cn
+	Sources map[string]string `json:"sources,omitempty"`
+}
+
+func loadSettings() (settings, error) {
+	var s settings
+	data, err := os.ReadFile(SettingsPath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("解析 %s 失败: %v", SettingsPath, err)
+	}
+	return s, nil
+}
+
+func saveSettings(s settings) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll("/etc/mosdns", 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(SettingsPath, append(data, '\n'), 0644)
+}
+
+// Sources 返回当前生效的数据源 (默认值叠加用户配置)
+func Sources() ([]Source, error) {
+	s, err := loadSettings()
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]Source, len(defaultSources))
+	copy(sources, defaultSources)
+	region := regionSources(s.Region)
+	for i, src := range sources {
+		if url, ok := s.Sources[src.Name]; ok {
+			sources[i].URL = url
+		} else if url, ok := region[src.Name]; ok {
+			// 其他地区的列表规模差异很大，只要求非空
+			sources[i].URL = url
+			sources[i].MinEntries = 1
+		}
+		if isDerived(sources[i].URL) {
+			sources[i].MinEntries = 1
+		}
+		if sources[i].URL == noneSource {
+			sources[i].MinEntries = 0
+		}
+	}
+	return sources, nil
+}
+
+// IsCustom 判断数据源是否被用户修改过
+func IsCustom(name string) bool {
+	s, err := loadSettings()
+	if err != nil {
+		return false
+	}
+	_, ok := s.Sources[name]
+	return ok
+}
+
+// SetSource 修改某个 Geo 文件的下载地址，value 可以是 URL、预设名，
+// 或者 geosite:<分类> / geoip:<代码> (从 dat 文件导出，类型需与列表一致)
+func SetSource(name, value string) (string, error) {
+	src, ok := findSource(name)
+	if !ok {
+		return "", fmt.Errorf("未知的数据源 %s (可选: %s)", name, strings.Join(sourceNames(), ", "))
+	}
+	url := value
+	if preset, ok := Presets[name][value]; ok {
+		url = preset
+	}
+	switch {
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+	case isDerived(url) && !src.Kind.isDat():
+		c, err := ParseCategory(url)
+		if err != nil {
+			return "", err
+		}
+		if (c.Dat == DatGeoIP) != (src.Kind == KindCIDR) {
+			return "", fmt.Errorf("%s 是 %s 列表，不能使用 %s 分类", name, src.Kind, c.Dat)
+		}
+		url = c.String()
+	default:
+		return "", fmt.Errorf("%q 既不是 URL 也不是 %s 的预设名", value, name)
+	}
+
+	s, err := loadSettings()
+	if err != nil {
+		return "", err
+	}
+	if s.Sources == nil {
+		s.Sources = map[string]string{}
+	}
+	s.Sources[name] = url
+	return url, saveSettings(s)
+}
+
+// ResetSource 恢复默认地址，name 为空时恢复全部数据源
+func ResetSource(name string) error {
+	if name != "" && !knownSource(name) {
+		return fmt.Errorf("未知的数据源 %s (可选: %s)", name, strings.Join(sourceNames(), ", "))
+	}
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		s.Sources = nil
+	} else {
+		delete(s.Sources, name)
+	}
+	return saveSettings(s)
+}
+
+// Mirrors 返回 GitHub 加速前缀的尝试顺序，空字符串表示直连
+func Mirrors() []string {
+	s, err := loadSettings()
+	if err != nil || s.Mirrors == nil {
+		return service.DefaultMirrors
+	}
+	return s.Mirrors
+}
+
+// SetMirrors 设置加速前缀的尝试顺序
+// "direct" 表示直连 GitHub；单独的 "off" 表示只直连，"default" 恢复默认顺序
+func SetMirrors(prefixes []string) error {
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	if len(prefixes) == 1 && prefixes[0] == "default" {
+		s.Mirrors = nil
+		return saveSettings(s)
+	}
+
+	var mirrors []string
+	for _, prefix := range prefixes {
+		switch prefix {
+		case "off", "direct", "none":
+			prefix = ""
+		default:
+			if !strings.HasPrefix(prefix, "http://") && !strings.HasPrefix(prefix, "https://") {
+				return fmt.Errorf("镜像前缀 %q 必须以 http:// 或 https:// 开头", prefix)
+			}
+			if !strings.HasSuffix(prefix, "/") {
+				prefix += "/"
+			}
+		}
+		if !slices.Contains(mirrors, prefix) {
+			mirrors = append(mirrors, prefix)
+		}
+	}
+	if len(mirrors) == 0 {
+		return fmt.Errorf("至少需要一个镜像")
+	}
+	s.Mirrors = mirrors
+	return saveSettings(s)
+}
+
+// Proxy 返回保存的下载代理
+func Proxy() string {
+	s, err := loadSettings()
+	if err != nil {
+		return ""
+	}
+	return s.Proxy
+}
+
+// SetProxy 保存下载代理 (http://、socks5:// 等)，"off" 或空字符串表示清除
+func SetProxy(proxy string) error {
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	if proxy == "off" || proxy == "none" {
+		proxy = ""
+	}
+	if proxy != "" {
+		if _, err := service.ParseProxy(proxy); err != nil {
+			return err
+		}
+	}
+	s.Proxy = proxy
+	return saveSettings(s)
+}
+
+func findSource(name string) (Source, bool) {
+	for _, src := range defaultSources {
+		if src.Name == name {
+			return src, true
+		}
+	}
+	return Source{}, false
+}
+
+func knownSource(name string) bool {
+	_, ok := findSource(name)
+	return ok
+}
+
+func sourceNames() []string {
+	names := make([]string, len(defaultSources))
+	for i, src := range defaultSources {
+		names[i] = src.Name
+	}
+	return names
+}
+
+// PresetNames 返回某个数据源可用的预设名
+func PresetNames(name string) []string {
+	var names []string
+	for n := range Presets[name] {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
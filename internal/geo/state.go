@@ -0,0 +1,65 @@
+package geo
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+)
+
+// StatePath 记录上次可用的镜像，以及每个数据源上次下载时服务器返回的缓存验证信息
+const StatePath = "/etc/mosdns/geo_state.json"
+
+type state struct {
+	LastMirror *string              `json:"last_mirror,omitempty"` // 上次成功的镜像，空字符串表示直连
+	Sources    map[string]validator `json:"sources,omitempty"`
+}
+
+// validator 用于下次发送条件请求 (If-None-Match / If-Modified-Since)
+type validator struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func loadState() state {
+	var st state
+	data, err := os.ReadFile(StatePath)
+	if err == nil && json.Unmarshal(data, &st) != nil {
+		// 文件损坏时当作没有缓存，下次全量下载即可
+		st = state{}
+	}
+	if st.Sources == nil {
+		st.Sources = map[string]validator{}
+	}
+	return st
+}
+
+func saveState(st state) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(StatePath, append(data, '\n'), 0644)
+}
+
+// LastMirror 返回上次成功的镜像
+func LastMirror() (string, bool) {
+	st := loadState()
+	if st.LastMirror == nil {
+		return "", false
+	}
+	return *st.LastMirror, true
+}
+
+// orderMirrors 把上次成功的镜像排到最前面
+func orderMirrors(mirrors []string, st state) []string {
+	if st.LastMirror == nil {
+		return mirrors
+	}
+	i := slices.Index(mirrors, *st.LastMirror)
+	if i <= 0 {
+		return mirrors
+	}
+	ordered := append([]string{mirrors[i]}, mirrors[:i]...)
+	return append(ordered, mirrors[i+1:]...)
+}
@@ -0,0 +1,570 @@
+package geo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/core"
+	"github.com/KyleYu2024/mosctl/internal/rule"
+	"github.com/KyleYu2024/mosctl/internal/service"
+)
+
+// Options 控制一次更新的行为
+type Options struct {
+	Force bool   // 忽略 ETag 缓存并跳过缩水比例检查，例如切换到条目更少的数据源时
+	Proxy string // 本次下载使用的代理，为空时使用 mosctl geo proxy 的设置或环境变量
+}
+
+// 每个文件最多尝试 maxAttempts 次，第 n 次失败后等待 retryDelay * 2^(n-1)
+const (
+	maxAttempts = 3
+	retryDelay  = 2 * time.Second
+)
+
+// Result 是单个文件的更新结果
+type Result struct {
+	Source   Source
+	URL      string
+	Mirror   string // 成功下载所用的镜像，空字符串表示直连
+	Changed  bool   // 文件内容发生了变化
+	Entries  int
+	Bytes    int64
+	SHA256   string // 当前文件内容的 SHA-256
+	Added    int    // 相比上一版本新增的条目数
+	Removed  int    // 相比上一版本删除的条目数
+	Attempts int
+	Err      error
+	// RolledBack 表示更新后健康检查失败，文件已恢复为上一版本
+	RolledBack bool
+
+	etag, lastModified string
+}
+
+// permanentError 表示重试也无济于事的错误 (例如 404、条目数骤降)
+type permanentError struct{ error }
+
+// Update 并行下载全部 Geo 列表，随后刷新拦截订阅；只有文件实际变化时才重启 MosDNS
+// 每个文件都经过校验后才替换旧文件，失败的文件保持原样；任一文件失败时返回错误
+func Update(opts Options) error {
+	start := time.Now()
+	// 确保目录存在
+	os.MkdirAll("/etc/mosdns/rules", 0755)
+
+	all, err := Sources()
+	if err != nil {
+		return err
+	}
+	bindings, err := Bindings()
+	if err != nil {
+		return err
+	}
+	// dat 文件较大，只有存在分类绑定或派生数据源时才更新
+	// 派生数据源依赖 dat 文件，等下载全部完成后再生成
+	needed := neededDats(all, bindings)
+	var sources, derived []Source
+	for _, src := range all {
+		switch {
+		case isDerived(src.URL):
+			derived = append(derived, src)
+		case !src.OnDemand || needed[src.Kind]:
+			sources = append(sources, src)
+		}
+	}
+	os.MkdirAll(filepath.Dir(PathGeoSiteDat), 0755)
+	if err := useProxy(opts.Proxy); err != nil {
+		return err
+	}
+	st := loadState()
+	mirrors := orderMirrors(Mirrors(), st)
+
+	total := len(sources) + len(derived)
+	results := fetchAll(sources, mirrors, st.Sources, opts.Force, total)
+	results = append(results, deriveAll(derived, opts.Force, len(results), total)...)
+
+	rememberedMirror := false
+	for _, res := range results {
+		if res.Err == nil && !isDerived(res.URL) {
+			st.Sources[res.Source.Name] = validator{URL: res.URL, ETag: res.etag, LastModified: res.lastModified}
+			if service.IsGitHubURL(res.Source.URL) && !rememberedMirror {
+				st.LastMirror = &res.Mirror
+				rememberedMirror = true
+			}
+		}
+	}
+	if err := saveState(st); err != nil {
+		fmt.Printf("⚠️  无法保存下载缓存信息: %v\n", err)
+	}
+
+	blockRes := refreshBlocklists(mirrors)
+	if blockRes.Err != nil {
+		fmt.Printf("❌ 拦截列表更新失败: %v\n", blockRes.Err)
+	}
+	return finish(Run{Time: start}, append(results, blockRes), len(bindings) > 0)
+}
+
+// healthWait 是重启后等待解析恢复的最长时间
+const healthWait = 20 * time.Second
+
+// finish 重新导出分类绑定，记录本次更新，有文件变化时重启 MosDNS 并做健康检查；任一文件失败时返回错误
+// 在线更新与离线包共用
+func finish(run Run, results []Result, rebind bool) error {
+	if rebind {
+		files, err := applyBindings()
+		if err != nil {
+			fmt.Printf("❌ 分类绑定导出失败: %v\n", err)
+			results = append(results, Result{Source: Source{Name: "geo_bind"}, Err: err})
+		} else if len(files) > 0 {
+			fmt.Println("🧩 分类绑定已重新导出")
+		}
+		for _, src := range files {
+			results = append(results, Result{Source: src, Changed: true, Entries: countEntries(src.Path, src.Kind), SHA256: fileSHA256(src.Path)})
+		}
+	}
+
+	failCount, changed := 0, 0
+	for _, res := range results {
+		switch {
+		case res.Err != nil:
+			failCount++
+		case res.Changed:
+			changed++
+		}
+	}
+	run.OK = failCount == 0
+	if failCount > 0 {
+		fmt.Printf("⚠️  更新完成，但有 %d 个文件更新失败。\n", failCount)
+		run.Error = fmt.Sprintf("%d 个文件更新失败", failCount)
+	}
+
+	if changed == 0 {
+		fmt.Println("✨ 所有规则均无变化，无需重启 MosDNS")
+	} else {
+		fmt.Printf("🔄 %d 个文件有变化，重启 MosDNS 服务...\n", changed)
+		restarted, err := restartChecked(results)
+		run.Restarted = restarted
+		if err != nil {
+			run.OK = false
+			run.Error = err.Error()
+		}
+	}
+	if run.OK {
+		config.SetLastUpdate()
+	}
+
+	for _, res := range results {
+		run.Files = append(run.Files, res.record())
+	}
+	if err := appendHistory(run); err != nil {
+		fmt.Printf("⚠️  无法写入更新记录: %v\n", err)
+	}
+	if run.Error != "" {
+		return errors.New(run.Error)
+	}
+	return nil
+}
+
+// restartChecked 重启 MosDNS 并探测国内、国外域名的解析
+// 重启失败或探测失败时把本次变化的文件恢复为上一版本并再次重启，返回描述回滚情况的错误
+// 只检查更新前能够解析的域名，避免把上游本身的故障当成规则问题
+func restartChecked(results []Result) (bool, error) {
+	baseline := config.Healthy(config.ProbeDomains, 2*time.Second)
+
+	err := service.RestartService()
+	if err != nil {
+		err = fmt.Errorf("重启失败: %v", err)
+	} else if len(baseline) == 0 {
+		fmt.Println("⚠️  更新前 MosDNS 已无法解析，跳过健康检查")
+		return true, nil
+	} else {
+		fmt.Printf("🩺 正在检查解析 (%s)...\n", strings.Join(baseline, ", "))
+		err = config.HealthCheck(baseline, healthWait)
+	}
+	if err == nil {
+		fmt.Println("✅ 解析正常")
+		return true, nil
+	}
+
+	fmt.Printf("❌ 更新后 MosDNS 异常: %v\n", err)
+	fmt.Println("↩️  正在恢复上一版本...")
+	rolled := rollback(results)
+	if len(rolled) == 0 {
+		return false, fmt.Errorf("更新后健康检查失败 (%v)，且没有可回滚的文件", err)
+	}
+	fmt.Printf("↩️  已回滚: %s\n", strings.Join(rolled, ", "))
+
+	restartErr := service.RestartService()
+	if restartErr == nil && len(baseline) > 0 {
+		restartErr = config.HealthCheck(baseline, healthWait)
+	}
+	if restartErr != nil {
+		fmt.Printf("❌ 回滚后仍然异常: %v\n", restartErr)
+		return false, fmt.Errorf("更新后健康检查失败 (%v)，已回滚 %s，但服务仍然异常: %v", err, strings.Join(rolled, ", "), restartErr)
+	}
+	fmt.Println("✅ 回滚后解析恢复正常")
+	return true, fmt.Errorf("更新后健康检查失败 (%v)，已回滚 %s", err, strings.Join(rolled, ", "))
+}
+
+// rollback 把 results 中本次发生变化的文件恢复为上一版本，返回成功回滚的文件名
+// 被回滚的数据源同时清除缓存验证信息，否则下次更新会因 304 而一直保留旧文件
+func rollback(results []Result) []string {
+	var rolled []string
+	st := loadState()
+	for i := range results {
+		res := &results[i]
+		if !res.Changed || res.Err != nil {
+			continue
+		}
+		var err error
+		if res.Source.Name == coreFileName {
+			var data []byte
+			if data, err = os.ReadFile(core.BackupPath); err == nil {
+				err = replaceFile(res.Source.Path, data, 0755)
+			}
+		} else {
+			err = restorePrevious(res.Source.Name, res.Source.Path)
+		}
+		if err != nil {
+			fmt.Printf("⚠️  %s 无法回滚: %v\n", res.Source.Name, err)
+			continue
+		}
+		res.RolledBack = true
+		delete(st.Sources, res.Source.Name)
+		rolled = append(rolled, res.Source.Name)
+	}
+	if err := saveState(st); err != nil {
+		fmt.Printf("⚠️  无法保存下载缓存信息: %v\n", err)
+	}
+	return rolled
+}
+
+// useProxy 设置本次下载使用的代理，proxy 为空时使用 mosctl geo proxy 的设置
+func useProxy(proxy string) error {
+	if proxy == "" {
+		proxy = Proxy()
+	}
+	if err := service.SetProxy(proxy); err != nil {
+		return err
+	}
+	if proxy != "" {
+		fmt.Printf("🌐 通过代理 %s 下载\n", proxy)
+	}
+	return nil
+}
+
+// fetchAll 并行下载 sources，结果与 sources 一一对应；total 用于进度显示
+func fetchAll(sources []Source, mirrors []string, prev map[string]validator, force bool, total int) []Result {
+	var mu sync.Mutex
+	logf := func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Printf(format, args...)
+	}
+
+	fmt.Printf("⬇️  并行下载 %d 个文件...\n", len(sources))
+	results := make([]Result, len(sources))
+	done := 0
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := fetchWithRetry(src, mirrors, prev[src.Name], force, logf)
+			mu.Lock()
+			done++
+			results[i] = res
+			printResult(done, total, res)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// deriveAll 依次生成派生数据源，done 为此前已完成的文件数
+func deriveAll(derived []Source, force bool, done, total int) []Result {
+	var results []Result
+	for _, src := range derived {
+		res := deriveSource(src, force)
+		done++
+		results = append(results, res)
+		printResult(done, total, res)
+	}
+	return results
+}
+
+// blockSource 描述由拦截订阅合并生成的 geosite_block.txt，只用于记录与 geo diff
+var blockSource = Source{Name: "geosite_block", Path: rule.PathGeoSiteBlock, Kind: KindDomain}
+
+// refreshBlocklists 刷新拦截订阅，并把结果整理成与其他文件一致的更新记录
+func refreshBlocklists(mirrors []string) Result {
+	res := Result{Source: blockSource, URL: strings.Join(rule.BlockSources(), " ")}
+	before := readListLines(blockSource.Path)
+	res.Changed, res.Err = rule.RefreshBlocklists(mirrors)
+
+	after := readListLines(blockSource.Path)
+	res.Entries = len(after)
+	res.SHA256 = fileSHA256(blockSource.Path)
+	if res.Changed {
+		if err := os.MkdirAll(PrevDir, 0755); err == nil {
+			prev := strings.Join(before, "\n")
+			if prev != "" {
+				prev += "\n"
+			}
+			os.WriteFile(prevPath(blockSource.Name, blockSource.Path), []byte(prev), 0644)
+		}
+		added, removed := diffSets(toSet(before), toSet(after))
+		res.Added, res.Removed = len(added), len(removed)
+	}
+	return res
+}
+
+func toSet(lines []string) map[string]bool {
+	set := make(map[string]bool, len(lines))
+	for _, l := range lines {
+		set[l] = true
+	}
+	return set
+}
+
+// neededDats 返回本次需要更新的 dat 类型
+func neededDats(sources []Source, bindings []Binding) map[Kind]bool {
+	needed := map[Kind]bool{}
+	for _, b := range bindings {
+		if strings.HasPrefix(b.Category, DatGeoIP+":") {
+			needed[KindIPDat] = true
+		} else {
+			needed[KindSiteDat] = true
+		}
+	}
+	for _, src := range sources {
+		switch {
+		case strings.HasPrefix(src.URL, DatGeoIP+":"):
+			needed[KindIPDat] = true
+		case isDerived(src.URL):
+			needed[KindSiteDat] = true
+		}
+	}
+	return needed
+}
+
+// EnsureDat 确保 geosite.dat / geoip.dat 存在，refresh 为 true 时总是检查更新
+func EnsureDat(dat string, refresh bool) error {
+	name := "geosite_dat"
+	if dat == DatGeoIP {
+		name = "geoip_dat"
+	}
+	sources, err := Sources()
+	if err != nil {
+		return err
+	}
+	var src Source
+	for _, s := range sources {
+		if s.Name == name {
+			src = s
+		}
+	}
+	if _, err := os.Stat(src.Path); err == nil && !refresh {
+		return nil
+	}
+	if err := service.SetProxy(Proxy()); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(src.Path), 0755); err != nil {
+		return err
+	}
+
+	fmt.Printf("⬇️  正在下载 %s ...\n", filepath.Base(src.Path))
+	st := loadState()
+	logf := func(format string, args ...any) { fmt.Printf(format, args...) }
+	res := fetchWithRetry(src, orderMirrors(Mirrors(), st), st.Sources[src.Name], false, logf)
+	printResult(1, 1, res)
+	if res.Err != nil {
+		return res.Err
+	}
+	st.Sources[src.Name] = validator{URL: res.URL, ETag: res.etag, LastModified: res.lastModified}
+	return saveState(st)
+}
+
+// printResult 输出单个文件的完成情况，调用方需持有输出锁
+func printResult(done, total int, res Result) {
+	prefix := fmt.Sprintf("[%d/%d] %s", done, total, res.Source.Name)
+	switch {
+	case res.Err != nil:
+		fmt.Printf("%s ❌ 失败 (尝试 %d 次): %v (已保留旧文件)\n", prefix, res.Attempts, res.Err)
+	case res.Changed && res.Bytes > 0:
+		fmt.Printf("%s ✅ 已更新 (%d 条, +%d -%d, %s, %s)\n", prefix, res.Entries, res.Added, res.Removed, config.FormatSize(res.Bytes), service.MirrorName(res.Mirror))
+	case res.Changed:
+		fmt.Printf("%s ✅ 已更新 (%d 条, +%d -%d)\n", prefix, res.Entries, res.Added, res.Removed)
+	default:
+		fmt.Printf("%s 💤 无变化\n", prefix)
+	}
+}
+
+// fetchWithRetry 依次尝试各个镜像，全部失败时按指数退避重试整条镜像链
+func fetchWithRetry(src Source, mirrors []string, prev validator, force bool, logf func(string, ...any)) Result {
+	var res Result
+	for attempt := 1; ; attempt++ {
+		res = fetchVia(src, mirrors, prev, force, logf)
+		res.Attempts = attempt
+		if res.Err == nil || attempt == maxAttempts {
+			return res
+		}
+		if _, ok := res.Err.(permanentError); ok {
+			return res
+		}
+		// 最后一个镜像 (通常是直连) 明确返回 404 等错误时，重试也没有意义
+		if httpErr, ok := res.Err.(service.HTTPError); ok && !httpErr.Temporary() {
+			return res
+		}
+		delay := retryDelay << (attempt - 1)
+		logf("⚠️  %s 第 %d 次下载失败: %v，%s 后重试\n", src.Name, attempt, res.Err, delay)
+		time.Sleep(delay)
+	}
+}
+
+// fetchVia 按顺序尝试镜像，镜像返回错误页或校验失败时换下一个
+func fetchVia(src Source, mirrors []string, prev validator, force bool, logf func(string, ...any)) Result {
+	candidates := service.MirrorCandidates(mirrors, src.URL)
+	var res Result
+	for i, mirror := range candidates {
+		res = fetch(src, service.MirrorURL(mirror, src.URL), prev, force, logf)
+		res.Mirror = mirror
+		if res.Err == nil {
+			return res
+		}
+		if _, ok := res.Err.(permanentError); ok {
+			return res
+		}
+		if i < len(candidates)-1 {
+			logf("⚠️  %s 通过 %s 下载失败: %v，尝试下一个镜像\n", src.Name, service.MirrorName(mirror), res.Err)
+		}
+	}
+	return res
+}
+
+// fetch 以条件请求下载单个文件到临时文件，依次做 SHA-256 校验、dnsmasq 格式转换和内容校验，
+// 全部通过且内容确有变化时才原子替换 src.Path
+func fetch(src Source, url string, prev validator, force bool, logf func(string, ...any)) Result {
+	res := Result{Source: src, URL: url}
+
+	// 地址变了或本地文件丢失时不能使用旧的验证信息
+	var etag, lastModified string
+	if _, err := os.Stat(src.Path); err == nil && !force && prev.URL == url {
+		etag, lastModified = prev.ETag, prev.LastModified
+	}
+	f, err := service.DownloadIfChanged(url, src.Path, etag, lastModified)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.etag, res.lastModified = f.ETag, f.LastModified
+	if f.NotModified {
+		if res.etag == "" {
+			res.etag = etag
+		}
+		if res.lastModified == "" {
+			res.lastModified = lastModified
+		}
+		res.SHA256 = fileSHA256(src.Path)
+		res.Entries = countEntries(src.Path, src.Kind)
+		return res
+	}
+	defer os.Remove(f.Temp) // 替换成功后临时文件已不存在
+	res.Bytes = f.Bytes
+
+	want, err := service.FetchChecksum(url)
+	switch {
+	case err != nil:
+		logf("⚠️  %s 无法获取校验文件，跳过 SHA-256 校验: %v\n", src.Name, err)
+	case want != "" && want != f.SHA256:
+		res.Err = fmt.Errorf("SHA-256 不匹配 (期望 %s，实际 %s)", want, f.SHA256)
+		return res
+	}
+
+	return install(src, res, f.Temp, force, logf)
+}
+
+// install 对已经下载或解包到 tmp 的文件做 dnsmasq 格式转换和内容校验，
+// 通过后保留上一版本并原子替换 src.Path；tmp 必须与 src.Path 位于同一文件系统
+func install(src Source, res Result, tmp string, force bool, logf func(string, ...any)) Result {
+	data, err := os.ReadFile(tmp)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	// dat 是二进制文件，不做格式转换
+	if !src.Kind.isDat() {
+		if converted, ok := convertDnsmasq(string(data)); ok {
+			data = []byte(converted)
+			if err := os.WriteFile(tmp, data, 0644); err != nil {
+				res.Err = err
+				return res
+			}
+		}
+	}
+
+	n, err := Validate(tmp, src.Kind)
+	if err != nil {
+		res.Err = fmt.Errorf("内容校验失败: %v", err)
+		return res
+	}
+	res.Entries = n
+	if err := checkSize(src, n, force); err != nil {
+		res.Err = permanentError{err}
+		return res
+	}
+
+	res.SHA256 = sha256Hex(data)
+
+	// 服务器不支持条件请求时，内容相同也不替换，避免无谓的重启
+	if old, err := os.ReadFile(src.Path); err == nil && bytes.Equal(old, data) {
+		return res
+	}
+	before, after := entrySet(src.Path, src.Kind), entrySet(tmp, src.Kind)
+	if err := keepPrevious(src.Name, src.Path); err != nil {
+		logf("⚠️  %s 无法保留上一版本: %v\n", src.Name, err)
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		res.Err = err
+		return res
+	}
+	if err := os.Rename(tmp, src.Path); err != nil {
+		res.Err = err
+		return res
+	}
+	added, removed := diffSets(before, after)
+	res.Added, res.Removed = len(added), len(removed)
+	res.Changed = true
+	return res
+}
+
+// convertDnsmasq 把 server=/example.com/114.114.114.114 形式的列表转为 domain: 规则
+// 例如 felixonmars/dnsmasq-china-list；不是 dnsmasq 格式时返回 false
+func convertDnsmasq(data string) (string, bool) {
+	var b strings.Builder
+	found := false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rest, ok := strings.CutPrefix(line, "server=/")
+		if !ok {
+			return "", false
+		}
+		domain, _, ok := strings.Cut(rest, "/")
+		if !ok || domain == "" {
+			continue
+		}
+		found = true
+		b.WriteString("domain:" + domain + "\n")
+	}
+	return b.String(), found
+}
@@ -0,0 +1,128 @@
+package geo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func quiet(string, ...any) {}
+
+// fakeMirror 模拟上游：body 可以随时替换，sum 非空时发布 .sha256sum
+type fakeMirror struct {
+	mu   sync.Mutex
+	body string
+	etag string
+	sum  string
+}
+
+func (m *fakeMirror) set(body, etag, sum string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.body, m.etag, m.sum = body, etag, sum
+}
+
+func (m *fakeMirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if strings.HasSuffix(r.URL.Path, ".sha256sum") {
+		if m.sum == "" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "%s  list.txt\n", m.sum)
+		return
+	}
+	if m.etag != "" && r.Header.Get("If-None-Match") == m.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if m.etag != "" {
+		w.Header().Set("ETag", m.etag)
+	}
+	w.Write([]byte(m.body))
+}
+
+func domainList(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "site%d.example.cn\n", i)
+	}
+	return b.String()
+}
+
+func TestFetch(t *testing.T) {
+	mirror := &fakeMirror{}
+	srv := httptest.NewServer(mirror)
+	defer srv.Close()
+	url := srv.URL + "/list.txt"
+	src := Source{Name: "geosite_cn", Path: filepath.Join(t.TempDir(), "geosite_cn.txt"), URL: url, Kind: KindDomain, MinEntries: 10}
+
+	body := domainList(20)
+	sum := sha256.Sum256([]byte(body))
+	mirror.set(body, `"v1"`, hex.EncodeToString(sum[:]))
+	res := fetch(src, url, validator{}, false, quiet)
+	if res.Err != nil || !res.Changed || res.Entries != 20 {
+		t.Fatalf("first fetch = %+v", res)
+	}
+	if data, _ := os.ReadFile(src.Path); string(data) != body {
+		t.Errorf("installed content differs")
+	}
+
+	// 带上 ETag 的条件请求返回 304，文件不变
+	res = fetch(src, url, validator{URL: url, ETag: res.etag}, false, quiet)
+	if res.Err != nil || res.Changed || res.Entries != 20 {
+		t.Errorf("conditional fetch = %+v", res)
+	}
+
+	// SHA-256 不匹配、错误页、条目数不足时都不替换
+	mirror.set(domainList(30), `"v2"`, strings.Repeat("0", 64))
+	if res := fetch(src, url, validator{}, false, quiet); res.Err == nil || !strings.Contains(res.Err.Error(), "SHA-256") {
+		t.Errorf("checksum mismatch: %v", res.Err)
+	}
+	mirror.set("<!DOCTYPE html>\n<html><body>rate limited</body></html>\n", `"v3"`, "")
+	if res := fetch(src, url, validator{}, false, quiet); res.Err == nil {
+		t.Error("HTML error page accepted")
+	}
+	mirror.set(domainList(5), `"v4"`, "")
+	if res := fetch(src, url, validator{}, true, quiet); res.Err == nil {
+		t.Error("list below MinEntries accepted even with force")
+	}
+	if data, _ := os.ReadFile(src.Path); string(data) != body {
+		t.Errorf("failed fetches replaced the installed list")
+	}
+
+	// 内容相同时不替换 (服务器不支持条件请求)
+	mirror.set(body, "", "")
+	if res := fetch(src, url, validator{}, false, quiet); res.Err != nil || res.Changed {
+		t.Errorf("identical content: %+v", res)
+	}
+}
+
+func TestFetchConvertsDnsmasq(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 12; i++ {
+		fmt.Fprintf(&b, "server=/site%d.cn/114.114.114.114\n", i)
+	}
+	mirror := &fakeMirror{}
+	mirror.set(b.String(), "", "")
+	srv := httptest.NewServer(mirror)
+	defer srv.Close()
+
+	src := Source{Name: "geosite_cn", Path: filepath.Join(t.TempDir(), "geosite_cn.txt"), URL: srv.URL + "/list.txt", Kind: KindDomain, MinEntries: 10}
+	res := fetch(src, src.URL, validator{}, false, quiet)
+	if res.Err != nil || res.Entries != 12 {
+		t.Fatalf("fetch = %+v", res)
+	}
+	data, _ := os.ReadFile(src.Path)
+	if !strings.HasPrefix(string(data), "domain:site0.cn\n") {
+		t.Errorf("dnsmasq list not converted: %q", data)
+	}
+}
@@ -0,0 +1,135 @@
+package geo
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/rule"
+)
+
+// Kind 是 Geo 列表的内容类型
+type Kind string
+
+const (
+	KindDomain  Kind = "domain"      // 每行一条域名规则 (domain_set)
+	KindCIDR    Kind = "cidr"        // 每行一个 IP 或 CIDR (ip_set)
+	KindSiteDat Kind = "geosite.dat" // v2ray geosite.dat，条目数按分类计
+	KindIPDat   Kind = "geoip.dat"   // v2ray geoip.dat，条目数按分类计
+)
+
+// isDat 判断是否为 protobuf 格式的 dat 文件
+func (k Kind) isDat() bool {
+	return k == KindSiteDat || k == KindIPDat
+}
+
+// countCategories 统计 dat 文件中的分类数
+func countCategories(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = eachEntry(data, func(string, []byte) (bool, error) {
+		count++
+		return true, nil
+	})
+	return count, err
+}
+
+// MaxShrinkRatio 新列表相比旧列表最多允许减少的比例，超过则认为下载的内容不完整
+const MaxShrinkRatio = 0.5
+
+// checkLine 校验单行内容是否符合列表类型
+func checkLine(kind Kind, line string) error {
+	switch kind {
+	case KindCIDR:
+		if net.ParseIP(line) != nil {
+			return nil
+		}
+		if _, _, err := net.ParseCIDR(line); err != nil {
+			return fmt.Errorf("%q 不是有效的 IP 或 CIDR", truncate(line, 60))
+		}
+		return nil
+	default:
+		if err := rule.ParseMatcher(line).Validate(); err != nil {
+			return fmt.Errorf("%q 不是有效的域名规则", truncate(line, 60))
+		}
+		return nil
+	}
+}
+
+// Validate 逐行校验文件内容，返回有效条目数；出现任何无效行即失败
+// 镜像返回的 HTML 错误页、被截断的行都会在这里被拦下
+func Validate(path string, kind Kind) (int, error) {
+	if kind.isDat() {
+		return countCategories(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := checkLine(kind, line); err != nil {
+			return count, fmt.Errorf("第 %d 行 %v", n, err)
+		}
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// countEntries 统计现有文件的有效条目数，文件不存在时返回 0
+func countEntries(path string, kind Kind) int {
+	if kind.isDat() {
+		n, _ := countCategories(path)
+		return n
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") && checkLine(kind, line) == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// checkSize 检查最小条目数和相对旧文件的缩水比例
+func checkSize(src Source, count int, force bool) error {
+	if count < src.MinEntries {
+		return fmt.Errorf("只有 %d 条记录 (至少需要 %d 条)，疑似下载异常", count, src.MinEntries)
+	}
+	if force {
+		return nil
+	}
+	old := countEntries(src.Path, src.Kind)
+	if old > 0 && float64(count) < float64(old)*(1-MaxShrinkRatio) {
+		return fmt.Errorf("条目数从 %d 骤降到 %d，疑似内容不完整 (确认无误可使用 --force 强制更新)", old, count)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
@@ -0,0 +1,100 @@
+package geo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckLine(t *testing.T) {
+	tests := []struct {
+		kind Kind
+		line string
+		ok   bool
+	}{
+		{KindDomain, "example.com", true},
+		{KindDomain, "full:www.example.com", true},
+		{KindDomain, "domain:example.cn", true},
+		{KindDomain, "keyword:google", true},
+		{KindDomain, `regexp:^ad\d+\.`, true},
+		{KindDomain, "regexp:(", false},
+		{KindDomain, "<html>", false},
+		{KindDomain, "exa mple.com", false},
+		{KindCIDR, "1.0.1.0/24", true},
+		{KindCIDR, "2001:db8::/32", true},
+		{KindCIDR, "8.8.8.8", true},
+		{KindCIDR, "1.0.1.0/33", false},
+		{KindCIDR, "example.com", false},
+	}
+	for _, tt := range tests {
+		err := checkLine(tt.kind, tt.line)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkLine(%s, %q) = %v, want ok=%v", tt.kind, tt.line, err, tt.ok)
+		}
+	}
+}
+
+func writeList(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	path := writeList(t, "# comment", "", "example.com", "  full:a.example.cn  ", "keyword:qq")
+	n, err := Validate(path, KindDomain)
+	if err != nil || n != 3 {
+		t.Errorf("Validate = %d, %v, want 3, nil", n, err)
+	}
+
+	// 镜像返回的错误页应在第一处无效行失败并报告行号
+	path = writeList(t, "example.com", "<!DOCTYPE html>", "example.cn")
+	n, err = Validate(path, KindDomain)
+	if err == nil || !strings.Contains(err.Error(), "第 2 行") {
+		t.Errorf("Validate error = %v, want line 2", err)
+	}
+	if n != 1 {
+		t.Errorf("Validate count = %d, want 1", n)
+	}
+
+	if _, err := Validate(filepath.Join(t.TempDir(), "missing"), KindCIDR); err == nil {
+		t.Error("Validate on missing file should fail")
+	}
+}
+
+func TestCheckSize(t *testing.T) {
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("10.0.%d.0/24", i)
+	}
+	src := Source{Name: "geoip_cn", Path: writeList(t, lines...), Kind: KindCIDR, MinEntries: 10}
+
+	tests := []struct {
+		count int
+		force bool
+		ok    bool
+	}{
+		{100, false, true},
+		{50, false, true},  // 正好缩水一半仍允许
+		{49, false, false}, // 超过 MaxShrinkRatio
+		{49, true, true},   // --force 跳过缩水检查
+		{9, true, false},   // 最小条目数不受 --force 影响
+	}
+	for _, tt := range tests {
+		err := checkSize(src, tt.count, tt.force)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkSize(%d, force=%v) = %v, want ok=%v", tt.count, tt.force, err, tt.ok)
+		}
+	}
+
+	// 旧文件不存在时只检查最小条目数
+	src.Path = filepath.Join(t.TempDir(), "missing")
+	if err := checkSize(src, 10, false); err != nil {
+		t.Errorf("checkSize without old file = %v", err)
+	}
+}
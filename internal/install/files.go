@@ -0,0 +1,190 @@
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/geo"
+	"github.com/KyleYu2024/mosctl/internal/rule"
+	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/KyleYu2024/mosctl/internal/watchdog"
+	"github.com/KyleYu2024/mosctl/templates"
+)
+
+// 安装过程中写入的系统文件
+const (
+	ResolvConf    = "/etc/resolv.conf"
+	PVEIgnore     = "/etc/.pve-ignore.resolv.conf"
+	SysctlConf    = "/etc/sysctl.d/99-mosdns.conf"
+	LogrotateConf = "/etc/logrotate.d/mosdns"
+	SystemdDir    = "/etc/systemd/system"
+	OpenRCScript  = "/etc/init.d/mosdns"
+	S6SvDir       = "/etc/s6/sv"
+	RulesV4       = "/etc/iptables/rules.v4"
+	ipForwardProc = "/proc/sys/net/ipv4/ip_forward"
+)
+
+// writeIfChanged 内容不同时原子替换 path，返回是否写入
+func writeIfChanged(path string, data []byte, perm os.FileMode) (bool, error) {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		if info, err := os.Stat(path); err == nil && info.Mode().Perm() != perm {
+			return true, os.Chmod(path, perm)
+		}
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	tmp.Close()
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), path)
+}
+
+// ensureConfig 在 config.yaml 不存在或缺少 mosctl 的标记时写入内置模板，损坏的文件会先备份
+func ensureConfig() error {
+	content, err := os.ReadFile(config.ConfigPath)
+	if err == nil && bytes.Contains(content, []byte("TAG_LOCAL")) && bytes.Contains(content, []byte("TAG_REMOTE")) {
+		fmt.Println("✔️  config.yaml 已存在，保留现有配置")
+		return nil
+	}
+	if err == nil {
+		backup := config.ConfigPath + ".broken-" + time.Now().Format("20060102-150405")
+		if err := os.WriteFile(backup, content, 0644); err != nil {
+			return fmt.Errorf("备份损坏的配置失败: %v", err)
+		}
+		fmt.Printf("⚠️  config.yaml 缺少 mosctl 的标记，已备份为 %s 并重新生成\n", backup)
+	}
+	if _, err := writeIfChanged(config.ConfigPath, templates.Read("config.yaml"), 0644); err != nil {
+		return err
+	}
+	fmt.Println("✅ 已写入默认 config.yaml")
+	return nil
+}
+
+// installUnits 按初始化系统写入服务文件与日志轮转配置
+func installUnits(initSys string) error {
+	switch initSys {
+	case "systemd":
+		changed := false
+		for _, name := range []string{"mosdns.service", "mosdns-rescue.service", watchdog.Unit} {
+			c, err := writeIfChanged(filepath.Join(SystemdDir, name), templates.Read(name), 0644)
+			if err != nil {
+				return err
+			}
+			changed = changed || c
+		}
+		if changed {
+			exec.Command("systemctl", "daemon-reload").Run()
+			fmt.Println("✅ 已写入 mosdns.service、mosdns-rescue.service 与 " + watchdog.Unit)
+		} else {
+			fmt.Println("✔️  systemd 服务文件无需修改")
+		}
+		// 之前多次启动失败会触发 StartLimit，重置后才能再次启动
+		exec.Command("systemctl", "reset-failed", "mosdns").Run()
+	case "openrc":
+		if err := reportWrite(OpenRCScript, templates.Read("mosdns.openrc"), 0755); err != nil {
+			return err
+		}
+	case "runit":
+		dirs := service.RunitServiceDirs()
+		if err := installSuperviseDir(filepath.Join(service.RunitSvDir, service.ServiceName), dirs); err != nil {
+			return err
+		}
+	case "s6":
+		if err := installSuperviseDir(filepath.Join(S6SvDir, service.ServiceName), []string{"/run/service"}); err != nil {
+			return err
+		}
+		exec.Command("s6-svscanctl", "-a", "/run/service").Run()
+	default:
+		fmt.Println("📦 未检测到初始化系统 (容器环境)，由 mosctl 直接管理 mosdns 进程")
+	}
+
+	if _, err := os.Stat(filepath.Dir(LogrotateConf)); err == nil {
+		recordIfChanging(LogrotateConf, templates.Read("mosdns.logrotate"), func(st *state) **fileBackup { return &st.Logrotate })
+		if err := reportWrite(LogrotateConf, templates.Read("mosdns.logrotate"), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installSuperviseDir 写入 runit/s6 的 run 脚本，并链接到第一个存在的扫描目录
+func installSuperviseDir(svDir string, scanDirs []string) error {
+	if err := reportWrite(filepath.Join(svDir, "run"), templates.Read("mosdns.run"), 0755); err != nil {
+		return err
+	}
+	for _, dir := range scanDirs {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		link := filepath.Join(dir, service.ServiceName)
+		if _, err := os.Lstat(link); err == nil {
+			return nil
+		}
+		if err := os.Symlink(svDir, link); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 已启用 %s -> %s\n", link, svDir)
+		return nil
+	}
+	fmt.Printf("⚠️  未找到服务扫描目录，请手动将 %s 链接到监督进程的服务目录\n", svDir)
+	return nil
+}
+
+func reportWrite(path string, data []byte, perm os.FileMode) error {
+	changed, err := writeIfChanged(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if changed {
+		fmt.Printf("✅ 已写入 %s\n", path)
+	} else {
+		fmt.Printf("✔️  %s 无需修改\n", path)
+	}
+	return nil
+}
+
+// seedRules 创建空的自定义列表，并下载缺失的 Geo 列表 (已有的规则不会被覆盖)
+func seedRules() {
+	for _, path := range rule.Lists {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			os.WriteFile(path, nil, 0644)
+		}
+	}
+
+	sources, err := geo.Sources()
+	if err != nil {
+		fmt.Printf("⚠️  读取 Geo 数据源失败: %v\n", err)
+		return
+	}
+	var missing []string
+	for _, src := range sources {
+		if info, err := os.Stat(src.Path); err != nil || info.Size() == 0 {
+			missing = append(missing, src.Name)
+		}
+	}
+	if len(missing) == 0 {
+		fmt.Println("✔️  Geo 规则已存在，跳过下载")
+		return
+	}
+	fmt.Printf("⬇️  下载缺失的 Geo 规则: %v\n", missing)
+	if err := geo.Update(geo.Options{}); err != nil {
+		fmt.Printf("⚠️  部分规则下载失败，稍后可执行 mosctl update 重试: %v\n", err)
+	}
+}
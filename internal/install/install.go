@@ -0,0 +1,240 @@
+// Package install 实现 mosctl install：部署 MosDNS、服务文件、规则与配置
+// 每一步都会先检查现状，可以重复执行来修复损坏的安装
+package install
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/core"
+	"github.com/KyleYu2024/mosctl/internal/geo"
+	"github.com/KyleYu2024/mosctl/internal/schedule"
+	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/KyleYu2024/mosctl/internal/watchdog"
+)
+
+// MosctlBin 是 mosctl 的安装位置
+const MosctlBin = "/usr/local/bin/mosctl"
+
+// gcCronMarker 用于识别 crontab 中的过期规则清理任务
+const gcCronMarker = "mosctl rule gc"
+
+// Options 是 mosctl install 的参数
+type Options struct {
+	MosDNSVersion string   // 指定 mosdns 版本，为空时使用最新版本 (已安装且可运行时不会升级)
+	Remote        string   // 国外上游，非空时跳过向导
+	Yes           bool     // 不进行交互，保留配置中的上游
+	Mirrors       []string // GitHub 加速前缀，保存后供 mosctl update 使用
+	Proxy         string   // 下载代理，保存后供 mosctl update 使用
+	SkipPackages  bool     // 不通过包管理器安装依赖
+	NoWatchdog    bool     // 不启用 mosctl watchdog
+}
+
+// totalSteps 是安装步骤数，用于 [n/N] 进度显示
+const totalSteps = 8
+
+func step(n int, title string) {
+	fmt.Printf("\033[1;33m[%d/%d] %s...\033[0m\n", n, totalSteps, title)
+}
+
+// Run 执行安装，已完成的步骤会被跳过
+func Run(opts Options) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("必须使用 root 权限运行")
+	}
+	initSys := service.InitSystem()
+	fmt.Printf("\033[0;32m🚀 开始部署 MosDNS (初始化系统: %s，架构: %s)\033[0m\n", initSys, runtime.GOARCH)
+
+	// 旧版安装脚本没有留下记录，先按它的行为补上，之后的修改在此基础上记录
+	if _, ok := loadState(); !ok && anyExists([]string{config.MosDNSBin}) {
+		saveState(legacyState())
+	}
+
+	step(1, "安装依赖")
+	if opts.SkipPackages {
+		fmt.Println("⏭️  已跳过依赖安装")
+	} else if err := installPackages(initSys); err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+	}
+
+	step(2, "释放 53 端口并开放防火墙")
+	prepareNetwork(initSys)
+
+	if err := os.MkdirAll(config.RuleDir, 0755); err != nil {
+		return err
+	}
+	if err := applyDownloadSettings(opts); err != nil {
+		return err
+	}
+
+	step(3, "安装 MosDNS 核心")
+	if err := installCore(opts.MosDNSVersion); err != nil {
+		return err
+	}
+
+	step(4, "安装 mosctl")
+	if err := installSelf(); err != nil {
+		return err
+	}
+
+	step(5, "写入配置文件")
+	if err := ensureConfig(); err != nil {
+		return err
+	}
+	if err := upstreamWizard(opts); err != nil {
+		return err
+	}
+
+	step(6, "配置系统服务")
+	if err := installUnits(initSys); err != nil {
+		return err
+	}
+
+	step(7, "初始化规则与自动更新")
+	seedRules()
+	setupSchedule()
+
+	step(8, "启动服务")
+	if err := start(initSys); err != nil {
+		return err
+	}
+	if initSys == "systemd" && !opts.NoWatchdog {
+		startWatchdog()
+	}
+	fmt.Println("\033[0;32m✅ 部署完成！\033[0m")
+	fmt.Println("👉 输入 mosctl 即可打开管理菜单")
+	return nil
+}
+
+// applyDownloadSettings 保存加速前缀与代理，之后的下载都会使用
+func applyDownloadSettings(opts Options) error {
+	if len(opts.Mirrors) > 0 {
+		if err := geo.SetMirrors(opts.Mirrors); err != nil {
+			return err
+		}
+	}
+	proxy := opts.Proxy
+	if proxy != "" {
+		if err := geo.SetProxy(proxy); err != nil {
+			return err
+		}
+	} else {
+		proxy = geo.Proxy()
+	}
+	if err := service.SetProxy(proxy); err != nil {
+		return err
+	}
+	if proxy != "" {
+		fmt.Printf("🌐 通过代理 %s 下载\n", proxy)
+	}
+	return nil
+}
+
+// installCore 安装 mosdns，已安装且能运行时跳过 (指定了其他版本时除外)
+func installCore(version string) error {
+	if current, err := core.Version(config.MosDNSBin); err == nil {
+		if version == "" || version == "latest" || version == current || "v"+current == version {
+			fmt.Printf("✔️  mosdns %s 已安装，跳过下载\n", current)
+			return nil
+		}
+	} else if _, statErr := os.Stat(config.MosDNSBin); statErr == nil {
+		fmt.Printf("🔧 现有的 mosdns 无法运行 (%v)，重新下载\n", err)
+	}
+
+	rel, err := core.Resolve(version)
+	if err != nil {
+		fmt.Printf("⚠️  %v，将使用 %s\n", err, rel.Tag)
+	}
+	fmt.Printf("⬇️  正在下载 mosdns %s (%s)...\n", rel.Tag, core.AssetName())
+	data, err := core.Download(rel, geo.Mirrors())
+	if err != nil {
+		return fmt.Errorf("%v，请检查网络或使用 --proxy / --mirror 后重试", err)
+	}
+	installed, _, err := core.Install(data)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ mosdns %s 安装完成\n", installed)
+	return nil
+}
+
+// installSelf 把正在运行的 mosctl 复制到 MosctlBin
+func installSelf() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		return err
+	}
+	return reportWrite(MosctlBin, data, 0755)
+}
+
+// setupSchedule 启用每日自动更新与每小时的过期规则清理，已有计划时保留原来的时间
+func setupSchedule() {
+	if st, err := schedule.Show(); err == nil && st.Enabled {
+		fmt.Printf("✔️  已有自动更新计划 (%s %s)\n", st.Backend, st.Calendar)
+	} else if err := schedule.Set(schedule.DefaultCalendar); err != nil {
+		fmt.Printf("⚠️  设置自动更新失败: %v\n", err)
+	} else {
+		fmt.Println("✅ 已添加每日自动更新")
+	}
+
+	added, err := schedule.EnsureCron(gcCronMarker, "5 * * * * "+MosctlBin+" rule gc > /dev/null 2>&1")
+	switch {
+	case err != nil:
+		fmt.Printf("⚠️  添加过期规则清理任务失败: %v\n", err)
+	case added:
+		record(func(st *state) { st.CronMarkers = addUnique(st.CronMarkers, gcCronMarker) })
+		fmt.Println("✅ 已添加每小时的过期规则清理")
+	}
+}
+
+// start 设置开机自启并 (重新) 启动服务，最后确认能够解析
+func start(initSys string) error {
+	if initSys != "pid" {
+		if err := service.EnableService(true); err != nil {
+			fmt.Printf("⚠️  设置开机自启失败: %v\n", err)
+		}
+	}
+	var err error
+	if st, statusErr := service.GetStatus(); statusErr == nil && st.Active() {
+		err = service.RestartService()
+	} else {
+		err = service.StartService()
+	}
+	if err == nil {
+		err = config.HealthCheck([]string{config.ProbeDomestic}, 20*time.Second)
+	}
+	if err != nil {
+		fmt.Printf("\033[0;31m❌ 启动失败: %v\033[0m\n", err)
+		fmt.Println("可能原因: 1. 配置文件格式错误  2. 53 端口仍被占用")
+		if initSys == "systemd" {
+			fmt.Println("👉 请执行 journalctl -u mosdns -n 20 查看详情")
+		} else {
+			fmt.Println("👉 请查看 /var/log/mosdns.log")
+		}
+		fmt.Println("👉 修复后可以再次执行 mosctl install")
+		return fmt.Errorf("mosdns 未能正常启动")
+	}
+	return nil
+}
+
+// startWatchdog 启用并 (重新) 启动看门狗，使其运行新安装的 mosctl
+func startWatchdog() {
+	if out, err := exec.Command("systemctl", "enable", watchdog.Unit).CombinedOutput(); err != nil {
+		fmt.Printf("⚠️  启用看门狗失败: %s\n", strings.TrimSpace(string(out)))
+		return
+	}
+	if out, err := exec.Command("systemctl", "restart", watchdog.Unit).CombinedOutput(); err != nil {
+		fmt.Printf("⚠️  启动看门狗失败: %s\n", strings.TrimSpace(string(out)))
+		return
+	}
+	fmt.Println("🐕 看门狗已启动，解析持续失败时自动开启救援模式")
+}
@@ -0,0 +1,115 @@
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// StatePath 记录安装时对系统所做的修改及修改前的原状，mosctl uninstall 据此逐项还原
+const StatePath = "/var/lib/mosctl/install.json"
+
+// state 只记录第一次修改前的原状，重复安装不会覆盖
+type state struct {
+	ResolvedDisabled bool        `json:"resolved_disabled,omitempty"` // 安装时停用了 systemd-resolved
+	ResolvConf       *fileBackup `json:"resolv_conf,omitempty"`       // 修改前的 /etc/resolv.conf
+	PVEIgnoreCreated bool        `json:"pve_ignore_created,omitempty"`
+	Sysctl           *fileBackup `json:"sysctl,omitempty"`      // 修改前的 99-mosdns.conf
+	IPForward        string      `json:"ip_forward,omitempty"`  // 修改前的 net.ipv4.ip_forward
+	InputRules       []string    `json:"input_rules,omitempty"` // 安装时放行 53 端口的协议
+	RulesV4          *fileBackup `json:"rules_v4,omitempty"`    // 修改前的 /etc/iptables/rules.v4
+	Logrotate        *fileBackup `json:"logrotate,omitempty"`
+	CronMarkers      []string    `json:"cron_markers,omitempty"` // 安装时添加的 crontab 任务
+}
+
+// fileBackup 是文件修改前的状态；Missing 表示原来不存在，Link 表示原来是指向该路径的符号链接
+type fileBackup struct {
+	Missing bool   `json:"missing,omitempty"`
+	Link    string `json:"link,omitempty"`
+	Data    []byte `json:"data,omitempty"`
+	Mode    uint32 `json:"mode,omitempty"`
+}
+
+func loadState() (state, bool) {
+	var st state
+	data, err := os.ReadFile(StatePath)
+	if err != nil || json.Unmarshal(data, &st) != nil {
+		return state{}, false
+	}
+	return st, true
+}
+
+func saveState(st state) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(StatePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(StatePath, append(data, '\n'), 0644)
+}
+
+// record 在修改系统之前调用，把修改写入状态文件；写入失败不影响安装
+func record(change func(*state)) {
+	st, _ := loadState()
+	change(&st)
+	saveState(st)
+}
+
+// backupFile 读取 path 当前的状态
+func backupFile(path string) *fileBackup {
+	if target, err := os.Readlink(path); err == nil {
+		return &fileBackup{Link: target}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return &fileBackup{Missing: true}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return &fileBackup{Missing: true}
+	}
+	return &fileBackup{Data: data, Mode: uint32(info.Mode().Perm())}
+}
+
+// recordFile 在第一次修改 path 之前保存它的原状，field 选择状态中对应的字段
+func recordFile(path string, field func(*state) **fileBackup) {
+	record(func(st *state) {
+		if *field(st) == nil {
+			*field(st) = backupFile(path)
+		}
+	})
+}
+
+// recordIfChanging 在 path 的内容将被改为 data 时保存它的原状
+func recordIfChanging(path string, data []byte, field func(*state) **fileBackup) {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return
+	}
+	recordFile(path, field)
+}
+
+// restore 把 path 恢复为备份时的状态
+func (b *fileBackup) restore(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	switch {
+	case b.Missing:
+		return nil
+	case b.Link != "":
+		return os.Symlink(b.Link, path)
+	default:
+		return os.WriteFile(path, b.Data, os.FileMode(b.Mode))
+	}
+}
+
+func addUnique(list []string, v string) []string {
+	if slices.Contains(list, v) {
+		return list
+	}
+	return append(list, v)
+}
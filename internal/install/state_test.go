@@ -0,0 +1,116 @@
+package install
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// roundTrip 模拟写入状态文件再读回，确保备份经过 JSON 后仍能还原
+func roundTrip(t *testing.T, b *fileBackup) *fileBackup {
+	t.Helper()
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out fileBackup
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return &out
+}
+
+func TestRestoreRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	if err := os.WriteFile(path, []byte("nameserver 1.1.1.1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b := roundTrip(t, backupFile(path))
+	if b.Missing || b.Link != "" {
+		t.Fatalf("backupFile = %+v, want regular file", b)
+	}
+
+	if err := os.WriteFile(path, []byte("nameserver 127.0.0.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.restore(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "nameserver 1.1.1.1\n" {
+		t.Errorf("content = %q", data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestRestoreMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "99-mosdns.conf")
+	b := roundTrip(t, backupFile(path))
+	if !b.Missing {
+		t.Fatalf("backupFile = %+v, want Missing", b)
+	}
+
+	if err := os.WriteFile(path, []byte("net.ipv4.ip_forward = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.restore(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("file still exists after restore: %v", err)
+	}
+	// 再次还原不应报错
+	if err := b.restore(path); err != nil {
+		t.Errorf("second restore: %v", err)
+	}
+}
+
+func TestRestoreSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := "../run/systemd/resolve/stub-resolv.conf"
+	path := filepath.Join(dir, "resolv.conf")
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+	b := roundTrip(t, backupFile(path))
+	if b.Link != target {
+		t.Fatalf("backupFile = %+v, want Link %q", b, target)
+	}
+
+	// 安装时符号链接被替换成普通文件
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("nameserver 127.0.0.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.restore(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.Readlink(path)
+	if err != nil {
+		t.Fatalf("restore did not recreate symlink: %v", err)
+	}
+	if got != target {
+		t.Errorf("link = %q, want %q", got, target)
+	}
+}
+
+func TestAddUnique(t *testing.T) {
+	list := addUnique(nil, "tcp")
+	list = addUnique(list, "udp")
+	list = addUnique(list, "tcp")
+	if len(list) != 2 || list[0] != "tcp" || list[1] != "udp" {
+		t.Errorf("addUnique = %v", list)
+	}
+}
@@ -0,0 +1,187 @@
+package install
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// packageManager 描述一个发行版的包管理器
+type packageManager struct {
+	name    string
+	update  []string // 安装前刷新索引，为空表示不需要
+	install []string
+	// packages 把需要的命令映射为包名，空字符串表示系统自带 (如 busybox 提供)
+	packages map[string]string
+}
+
+var packageManagers = []packageManager{
+	{"apt-get", []string{"apt-get", "update"}, []string{"apt-get", "install", "-y"}, map[string]string{
+		"iptables": "iptables", "nslookup": "dnsutils", "nano": "nano", "crontab": "cron", "logrotate": "logrotate", "ca-certificates": "ca-certificates"}},
+	{"dnf", nil, []string{"dnf", "install", "-y"}, map[string]string{
+		"iptables": "iptables", "nslookup": "bind-utils", "nano": "nano", "crontab": "cronie", "logrotate": "logrotate", "ca-certificates": "ca-certificates"}},
+	{"yum", nil, []string{"yum", "install", "-y"}, map[string]string{
+		"iptables": "iptables", "nslookup": "bind-utils", "nano": "nano", "crontab": "cronie", "logrotate": "logrotate", "ca-certificates": "ca-certificates"}},
+	{"apk", []string{"apk", "update"}, []string{"apk", "add"}, map[string]string{
+		"iptables": "iptables", "nslookup": "bind-tools", "nano": "nano", "crontab": "", "logrotate": "logrotate", "ca-certificates": "ca-certificates"}},
+	{"pacman", nil, []string{"pacman", "-Sy", "--noconfirm", "--needed"}, map[string]string{
+		"iptables": "iptables", "nslookup": "bind", "nano": "nano", "crontab": "cronie", "logrotate": "logrotate", "ca-certificates": "ca-certificates"}},
+	{"zypper", nil, []string{"zypper", "--non-interactive", "install"}, map[string]string{
+		"iptables": "iptables", "nslookup": "bind-utils", "nano": "nano", "crontab": "cronie", "logrotate": "logrotate", "ca-certificates": "ca-certificates"}},
+	{"opkg", []string{"opkg", "update"}, []string{"opkg", "install"}, map[string]string{
+		"iptables": "iptables", "nslookup": "", "nano": "nano", "crontab": "", "logrotate": "logrotate", "ca-certificates": "ca-certificates"}},
+}
+
+// caBundles 是常见发行版的 CA 证书位置，任意一个存在即认为已安装
+var caBundles = []string{"/etc/ssl/certs/ca-certificates.crt", "/etc/pki/tls/certs/ca-bundle.crt", "/etc/ssl/ca-bundle.pem", "/etc/ssl/cert.pem"}
+
+func detectPackageManager() (packageManager, bool) {
+	for _, pm := range packageManagers {
+		if _, err := exec.LookPath(pm.name); err == nil {
+			return pm, true
+		}
+	}
+	return packageManager{}, false
+}
+
+// missingCommands 返回本机缺少的依赖
+// iptables 用于救援模式与防火墙，nslookup 用于解析测试，nano 用于编辑规则，
+// 没有 systemd 时自动更新依赖 crontab
+func missingCommands(initSys string) []string {
+	need := []string{"iptables", "nslookup", "nano", "logrotate"}
+	if initSys != "systemd" {
+		need = append(need, "crontab")
+	}
+	var missing []string
+	for _, cmd := range need {
+		if _, err := exec.LookPath(cmd); err != nil {
+			missing = append(missing, cmd)
+		}
+	}
+	if !anyExists(caBundles) {
+		missing = append(missing, "ca-certificates")
+	}
+	return missing
+}
+
+// installPackages 通过包管理器安装缺少的依赖
+func installPackages(initSys string) error {
+	missing := missingCommands(initSys)
+	if len(missing) == 0 {
+		fmt.Println("✔️  依赖已齐全")
+		return nil
+	}
+	pm, ok := detectPackageManager()
+	if !ok {
+		return fmt.Errorf("未识别的包管理器，请手动安装: %s", strings.Join(missing, " "))
+	}
+	var pkgs []string
+	for _, cmd := range missing {
+		if pkg := pm.packages[cmd]; pkg != "" {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	if len(pkgs) == 0 {
+		return nil
+	}
+	fmt.Printf("📦 通过 %s 安装: %s\n", pm.name, strings.Join(pkgs, " "))
+	if len(pm.update) > 0 {
+		if err := runVisible(pm.update...); err != nil {
+			fmt.Printf("⚠️  刷新软件源失败: %v\n", err)
+		}
+	}
+	if err := runVisible(append(pm.install, pkgs...)...); err != nil {
+		return fmt.Errorf("安装 %s 失败: %v", strings.Join(pkgs, " "), err)
+	}
+	return nil
+}
+
+// prepareNetwork 释放 53 端口、固定 resolv.conf、开启转发并放行 53 端口
+func prepareNetwork(initSys string) {
+	// Ubuntu 默认的 systemd-resolved 会占用 53 端口
+	if initSys == "systemd" && exec.Command("systemctl", "is-active", "--quiet", "systemd-resolved").Run() == nil {
+		record(func(st *state) { st.ResolvedDisabled = true })
+		exec.Command("systemctl", "disable", "--now", "systemd-resolved").Run()
+		fmt.Println("🛑 已停用 systemd-resolved")
+	}
+
+	// 下载过程中需要可用的 DNS；PVE 的 LXC 在重启时会覆盖 resolv.conf，需要 .pve-ignore 标记
+	resolv := []byte("nameserver 223.5.5.5\n")
+	recordIfChanging(ResolvConf, resolv, func(st *state) **fileBackup { return &st.ResolvConf })
+	if changed, err := writeIfChanged(ResolvConf, resolv, 0644); err != nil {
+		fmt.Printf("⚠️  写入 %s 失败: %v\n", ResolvConf, err)
+	} else if changed {
+		fmt.Printf("✅ %s 已指向 223.5.5.5\n", ResolvConf)
+	}
+	if _, err := os.Stat(PVEIgnore); os.IsNotExist(err) {
+		if os.WriteFile(PVEIgnore, nil, 0644) == nil {
+			record(func(st *state) { st.PVEIgnoreCreated = true })
+		}
+	}
+
+	forward := []byte("net.ipv4.ip_forward=1\n")
+	recordIfChanging(SysctlConf, forward, func(st *state) **fileBackup { return &st.Sysctl })
+	if changed, err := writeIfChanged(SysctlConf, forward, 0644); err != nil {
+		fmt.Printf("⚠️  写入 %s 失败: %v\n", SysctlConf, err)
+	} else if changed {
+		fmt.Println("✅ 已开启 IPv4 转发")
+	}
+	if data, err := os.ReadFile(ipForwardProc); err == nil && strings.TrimSpace(string(data)) != "1" {
+		record(func(st *state) {
+			if st.IPForward == "" {
+				st.IPForward = strings.TrimSpace(string(data))
+			}
+		})
+	}
+	exec.Command("sysctl", "-w", "net.ipv4.ip_forward=1").Run()
+
+	if _, err := exec.LookPath("iptables"); err != nil {
+		fmt.Println("⚠️  未找到 iptables，跳过防火墙设置")
+		return
+	}
+	added := false
+	for _, proto := range []string{"udp", "tcp"} {
+		rule := []string{"INPUT", "-p", proto, "--dport", "53", "-j", "ACCEPT"}
+		if exec.Command("iptables", append([]string{"-C"}, rule...)...).Run() == nil {
+			continue
+		}
+		if err := exec.Command("iptables", append([]string{"-I"}, rule...)...).Run(); err != nil {
+			fmt.Printf("⚠️  放行 %s/53 失败: %v\n", proto, err)
+			continue
+		}
+		record(func(st *state) { st.InputRules = addUnique(st.InputRules, proto) })
+		added = true
+	}
+	if !added {
+		fmt.Println("✔️  防火墙已放行 53 端口")
+		return
+	}
+	fmt.Println("✅ 防火墙已放行 53 端口")
+	// Debian/Ubuntu 的 iptables-persistent 从该文件恢复规则
+	if _, err := exec.LookPath("iptables-save"); err == nil {
+		if out, err := exec.Command("iptables-save").Output(); err == nil {
+			recordFile(RulesV4, func(st *state) **fileBackup { return &st.RulesV4 })
+			os.MkdirAll(filepath.Dir(RulesV4), 0755)
+			os.WriteFile(RulesV4, out, 0644)
+		}
+	}
+}
+
+// runVisible 执行命令并把输出直接显示给用户
+func runVisible(args ...string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func anyExists(paths []string) bool {
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
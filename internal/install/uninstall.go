@@ -0,0 +1,322 @@
+package install
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/core"
+	"github.com/KyleYu2024/mosctl/internal/schedule"
+	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/KyleYu2024/mosctl/internal/watchdog"
+)
+
+// UninstallOptions 是 mosctl uninstall 的参数
+type UninstallOptions struct {
+	KeepConfig bool   // 保留配置与规则目录
+	Backup     string // 卸载前把配置与规则目录打包到此路径 (tar.gz)
+	Yes        bool   // 不再确认
+}
+
+// action 是卸载中的一步，desc 用于预览
+type action struct {
+	desc  string
+	run   func() error
+	fatal bool // 失败时中止卸载
+}
+
+// Uninstall 预览并依次撤销安装时对系统的修改；单个步骤失败不影响其他步骤
+func Uninstall(opts UninstallOptions) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("必须使用 root 权限运行")
+	}
+	st, ok := loadState()
+	if !ok {
+		st = legacyState()
+		fmt.Println("⚠️  未找到安装记录，将按旧版安装脚本所做的修改进行还原")
+	}
+	actions := plan(st, opts)
+
+	fmt.Println("📋 将执行以下操作:")
+	for i, a := range actions {
+		fmt.Printf("  %2d. %s\n", i+1, a.desc)
+	}
+	if opts.KeepConfig {
+		fmt.Printf("  保留 %s\n", service.MosDNSDir)
+	}
+	if !opts.Yes {
+		fmt.Print("⚠️  确定要卸载 MosDNS 吗？(y/n): ")
+		if strings.ToLower(readLine()) != "y" {
+			return fmt.Errorf("已取消")
+		}
+	}
+
+	failed := 0
+	for _, a := range actions {
+		if err := a.run(); err != nil {
+			if a.fatal {
+				return fmt.Errorf("%s失败: %v", a.desc, err)
+			}
+			fmt.Printf("⚠️  %s失败: %v\n", a.desc, err)
+			failed++
+			continue
+		}
+		fmt.Printf("✅ %s\n", a.desc)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 项操作失败，请按上面的提示手动处理", failed)
+	}
+	fmt.Println("✅ 卸载完成。")
+	return nil
+}
+
+// plan 根据安装记录生成卸载步骤，只包含需要执行的操作
+func plan(st state, opts UninstallOptions) []action {
+	var actions []action
+	add := func(desc string, run func() error) {
+		actions = append(actions, action{desc: desc, run: run})
+	}
+
+	if opts.Backup != "" {
+		actions = append(actions, action{desc: fmt.Sprintf("备份 %s 到 %s", service.MosDNSDir, opts.Backup), run: func() error {
+			return backupConfig(opts.Backup)
+		}, fatal: true})
+	}
+
+	units := serviceFiles()
+	// 看门狗会重新拉起 mosdns，需要先停止
+	if slices.Contains(units, filepath.Join(SystemdDir, watchdog.Unit)) {
+		add("停止 "+watchdog.Unit+" 并取消开机自启", func() error {
+			if out, err := exec.Command("systemctl", "disable", "--now", watchdog.Unit).CombinedOutput(); err != nil {
+				return fmt.Errorf("%s", strings.TrimSpace(string(out)))
+			}
+			return nil
+		})
+	}
+	add("停止 mosdns 并取消开机自启", func() error {
+		service.StopService()
+		if err := service.EnableService(false); err != nil && len(units) > 0 {
+			return err
+		}
+		return nil
+	})
+	if _, err := exec.LookPath("iptables"); err == nil && rescueChainsExist() {
+		add("关闭救援模式并删除 MOSCTL_RESCUE 链", service.DisableRescue)
+	}
+	add("删除自动更新计划", schedule.Disable)
+	for _, marker := range st.CronMarkers {
+		add(fmt.Sprintf("删除 crontab 中的 %s 任务", marker), func() error {
+			_, err := schedule.RemoveCron(marker)
+			return err
+		})
+	}
+
+	if len(units) > 0 {
+		add("删除服务文件 "+strings.Join(units, " "), func() error {
+			for _, path := range units {
+				if err := os.RemoveAll(path); err != nil {
+					return err
+				}
+			}
+			if service.InitSystem() == "systemd" {
+				exec.Command("systemctl", "daemon-reload").Run()
+			}
+			return nil
+		})
+	}
+
+	if st.Logrotate != nil {
+		add(restoreDesc(LogrotateConf, st.Logrotate), func() error { return st.Logrotate.restore(LogrotateConf) })
+	}
+	if st.Sysctl != nil {
+		add(restoreDesc(SysctlConf, st.Sysctl), func() error { return st.Sysctl.restore(SysctlConf) })
+	}
+	if st.IPForward != "" {
+		add("恢复 net.ipv4.ip_forward="+st.IPForward, func() error {
+			return exec.Command("sysctl", "-w", "net.ipv4.ip_forward="+st.IPForward).Run()
+		})
+	}
+	for _, proto := range st.InputRules {
+		add(fmt.Sprintf("删除 INPUT 链中放行 %s/53 的规则", proto), func() error {
+			return deleteInputRule(proto)
+		})
+	}
+	if st.RulesV4 != nil {
+		if st.RulesV4.Missing {
+			add("删除 "+RulesV4, func() error { return st.RulesV4.restore(RulesV4) })
+		} else {
+			add("将当前防火墙规则保存到 "+RulesV4, func() error {
+				out, err := exec.Command("iptables-save").Output()
+				if err != nil {
+					return err
+				}
+				return os.WriteFile(RulesV4, out, 0644)
+			})
+		}
+	}
+
+	if st.ResolvConf != nil {
+		add(restoreDesc(ResolvConf, st.ResolvConf), func() error { return st.ResolvConf.restore(ResolvConf) })
+	}
+	if st.PVEIgnoreCreated {
+		add("删除 "+PVEIgnore, func() error { return removeIfExists(PVEIgnore) })
+	}
+	if st.ResolvedDisabled {
+		add("重新启用 systemd-resolved", func() error {
+			if out, err := exec.Command("systemctl", "enable", "--now", "systemd-resolved").CombinedOutput(); err != nil {
+				return fmt.Errorf("%s", strings.TrimSpace(string(out)))
+			}
+			return nil
+		})
+	}
+
+	if !opts.KeepConfig {
+		add(fmt.Sprintf("删除 %s (配置与规则)", service.MosDNSDir), func() error { return os.RemoveAll(service.MosDNSDir) })
+	}
+	add(fmt.Sprintf("删除 %s %s %s", config.MosDNSBin, core.BackupPath, MosctlBin), func() error {
+		for _, path := range []string{config.MosDNSBin, core.BackupPath, MosctlBin} {
+			if err := removeIfExists(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	add("删除安装记录 "+filepath.Dir(StatePath), func() error { return os.RemoveAll(filepath.Dir(StatePath)) })
+	return actions
+}
+
+// legacyState 推测旧版安装脚本 (install_cli.sh) 所做的修改：它停用了 systemd-resolved、
+// 把 resolv.conf 改为 223.5.5.5，并写入 sysctl、logrotate 与 INPUT 规则
+func legacyState() state {
+	st := state{
+		Sysctl:     &fileBackup{Missing: true},
+		Logrotate:  &fileBackup{Missing: true},
+		InputRules: []string{"udp", "tcp"},
+	}
+	if exec.Command("systemctl", "cat", "systemd-resolved").Run() == nil &&
+		exec.Command("systemctl", "is-enabled", "--quiet", "systemd-resolved").Run() != nil {
+		st.ResolvedDisabled = true
+		// 只在 resolv.conf 仍是安装脚本写入的内容时改回 systemd-resolved 的链接
+		if data, err := os.ReadFile(ResolvConf); err == nil && strings.TrimSpace(string(data)) == "nameserver 223.5.5.5" {
+			st.ResolvConf = &fileBackup{Link: "../run/systemd/resolve/stub-resolv.conf"}
+		}
+	}
+	return st
+}
+
+func restoreDesc(path string, b *fileBackup) string {
+	switch {
+	case b.Missing:
+		return "删除 " + path
+	case b.Link != "":
+		return fmt.Sprintf("恢复 %s -> %s", path, b.Link)
+	default:
+		return "恢复 " + path + " 的原内容"
+	}
+}
+
+// serviceFiles 返回已存在的 mosdns 服务文件与服务目录链接
+func serviceFiles() []string {
+	candidates := []string{
+		filepath.Join(SystemdDir, "mosdns.service"),
+		filepath.Join(SystemdDir, "mosdns-rescue.service"),
+		filepath.Join(SystemdDir, watchdog.Unit),
+		OpenRCScript,
+		filepath.Join(service.RunitSvDir, service.ServiceName),
+		filepath.Join(S6SvDir, service.ServiceName),
+		filepath.Join("/run/service", service.ServiceName),
+	}
+	for _, dir := range service.RunitServiceDirs() {
+		candidates = append(candidates, filepath.Join(dir, service.ServiceName))
+	}
+	var existing []string
+	for _, path := range candidates {
+		if _, err := os.Lstat(path); err == nil && !slices.Contains(existing, path) {
+			existing = append(existing, path)
+		}
+	}
+	return existing
+}
+
+func rescueChainsExist() bool {
+	return exec.Command("iptables", "-t", "nat", "-L", "MOSCTL_RESCUE", "-n").Run() == nil ||
+		exec.Command("iptables", "-t", "nat", "-L", "MOSCTL_RESCUE_POST", "-n").Run() == nil
+}
+
+// deleteInputRule 删除放行 proto/53 的规则；旧版救援模式每次开启都会重复添加，因此删除所有副本
+func deleteInputRule(proto string) error {
+	rule := []string{"INPUT", "-p", proto, "--dport", "53", "-j", "ACCEPT"}
+	for i := 0; i < 100 && exec.Command("iptables", append([]string{"-C"}, rule...)...).Run() == nil; i++ {
+		if out, err := exec.Command("iptables", append([]string{"-D"}, rule...)...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s", strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// backupConfig 把配置与规则目录打包为 tar.gz，包内路径以 mosdns/ 开头
+func backupConfig(out string) error {
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	walkErr := filepath.Walk(service.MosDNSDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(filepath.Dir(service.MosDNSDir), path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		hdr.Uname, hdr.Gname = "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	for _, closeErr := range []error{tw.Close(), gz.Close(), f.Close()} {
+		if walkErr == nil {
+			walkErr = closeErr
+		}
+	}
+	if walkErr != nil {
+		os.Remove(out)
+	}
+	return walkErr
+}
@@ -0,0 +1,44 @@
+package install
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+)
+
+// upstreamWizard 设置国外上游：--remote 优先，-y 时保留配置中的值，否则询问用户
+func upstreamWizard(opts Options) error {
+	remote := strings.TrimSpace(opts.Remote)
+	if remote == "" && !opts.Yes {
+		_, current := config.GetCurrentUpstreams()
+		fmt.Println("请配置国外 DNS 上游（按回车跳过并保留当前配置）")
+		fmt.Printf("mihomo或其他代理工具的dns监听地址 (例如 10.10.2.252:53，当前: %s): ", current)
+		remote = readLine()
+	}
+	if remote == "" {
+		fmt.Println("  - 国外 DNS 未修改 (保留当前配置)")
+	} else {
+		if err := config.WriteUpstream(false, remote); err != nil {
+			return fmt.Errorf("设置国外 DNS 失败: %v", err)
+		}
+		_, remote = config.GetCurrentUpstreams()
+		fmt.Printf("  - 国外 DNS 已设为: %s\n", remote)
+	}
+	local, _ := config.GetCurrentUpstreams()
+	fmt.Printf("  - 国内 DNS: %s\n", local)
+	return nil
+}
+
+// readLine 从终端读取一行；通过 curl | bash 运行时 stdin 是脚本本身，因此优先读取 /dev/tty
+func readLine() string {
+	in := os.Stdin
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		in = tty
+	}
+	line, _ := bufio.NewReader(in).ReadString('\n')
+	return strings.TrimSpace(line)
+}
@@ -0,0 +1,383 @@
+package rule
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// FindingKind 审计结果的类别
+type FindingKind int
+
+const (
+	FindingConflict  FindingKind = iota // 冲突：规则不会按预期生效
+	FindingRedundant                    // 冗余：已被其他规则覆盖
+	FindingOverlap                      // IoT 网段重叠
+)
+
+func (k FindingKind) String() string {
+	switch k {
+	case FindingConflict:
+		return "冲突"
+	case FindingRedundant:
+		return "冗余"
+	case FindingOverlap:
+		return "重叠"
+	}
+	return "未知"
+}
+
+// Fix 表示一种修复方式：从某个列表删除某条规则
+type Fix struct {
+	Label string
+	Type  RuleType
+	Entry string
+}
+
+// Finding 是一条审计结果
+type Finding struct {
+	Kind   FindingKind
+	Type   RuleType
+	Entry  string
+	Other  string
+	Reason string
+	Fixes  []Fix
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("[%s] %s: %s -> %s", f.Kind, ListName(f.Type), f.Entry, f.Reason)
+}
+
+// ListName 返回规则类型对应的列表名称
+func ListName(rType RuleType) string {
+	switch rType {
+	case TypeForceCN:
+		return "强制国内 (Force CN)"
+	case TypeForceNoCN:
+		return "强制国外 (Force NoCN)"
+	case TypeIoT:
+		return "智能家居直连 (IoT)"
+	case TypeBlock:
+		return "广告拦截 (Block)"
+	case TypeAllow:
+		return "拦截白名单 (Allow)"
+	}
+	return "未知列表"
+}
+
+// listPath 返回规则类型对应的文件路径
+func listPath(rType RuleType) string {
+	switch rType {
+	case TypeForceCN:
+		return PathForceCN
+	case TypeForceNoCN:
+		return PathForceNoCN
+	case TypeIoT:
+		return PathIoT
+	case TypeBlock:
+		return PathBlock
+	case TypeAllow:
+		return PathAllow
+	}
+	return ""
+}
+
+// auditInput 是一次审计所需的全部数据
+type auditInput struct {
+	cn, nocn, iot []string
+	block, allow  []string
+	geoCN         *DomainSet
+	geoApple      *DomainSet
+	geoNoCN       *DomainSet
+	geoBlock      *DomainSet
+}
+
+func loadAuditInput() (*auditInput, error) {
+	in := &auditInput{}
+	var err error
+	for _, item := range []struct {
+		dst  *[]string
+		path string
+	}{
+		{&in.cn, PathForceCN}, {&in.nocn, PathForceNoCN}, {&in.iot, PathIoT},
+		{&in.block, PathBlock}, {&in.allow, PathAllow},
+	} {
+		*item.dst, err = readEntries(item.path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("读取 %s 失败: %v", item.path, err)
+		}
+	}
+	for _, item := range []struct {
+		dst  **DomainSet
+		path string
+	}{
+		{&in.geoCN, PathGeoSiteCN}, {&in.geoApple, PathGeoSiteApple},
+		{&in.geoNoCN, PathGeoSiteNoCN}, {&in.geoBlock, PathGeoSiteBlock},
+	} {
+		if *item.dst, err = LoadDomainSet(item.path); err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %v", item.path, err)
+		}
+	}
+	return in, nil
+}
+
+// Audit 检查自定义列表之间、以及与 Geo 列表之间的冲突和冗余
+func Audit() ([]Finding, error) {
+	in, err := loadAuditInput()
+	if err != nil {
+		return nil, err
+	}
+	return in.run(), nil
+}
+
+// CheckEntry 检查即将添加的规则会引入哪些冲突，用于 rule add 时提示
+func CheckEntry(content string, rType RuleType) []Finding {
+	return checkEntries(map[RuleType][]string{rType: {content}})
+}
+
+// checkEntries 检查一批待添加规则引入的冲突，Geo 列表只加载一次
+func checkEntries(adds map[RuleType][]string) []Finding {
+	in, err := loadAuditInput()
+	if err != nil {
+		return nil
+	}
+	added := map[string]bool{}
+	for rType, entries := range adds {
+		for _, content := range entries {
+			added[content] = true
+		}
+		switch rType {
+		case TypeForceCN:
+			in.cn = append(in.cn, entries...)
+		case TypeForceNoCN:
+			in.nocn = append(in.nocn, entries...)
+		case TypeIoT:
+			in.iot = append(in.iot, entries...)
+		case TypeBlock:
+			in.block = append(in.block, entries...)
+		case TypeAllow:
+			in.allow = append(in.allow, entries...)
+		}
+	}
+
+	var related []Finding
+	for _, f := range in.run() {
+		if added[f.Entry] || added[f.Other] {
+			related = append(related, f)
+		}
+	}
+	return related
+}
+
+func (in *auditInput) run() []Finding {
+	var findings []Finding
+
+	cnMatchers := parseAll(in.cn)
+	nocnMatchers := parseAll(in.nocn)
+	cnSet := NewDomainSet(cnMatchers)
+
+	// main_sequence 的顺序为 apple -> 国内 -> 国外，排在前面的列表优先
+	for i, m := range nocnMatchers {
+		entry := in.nocn[i]
+		removeSelf := Fix{Label: "从强制国外删除 " + entry, Type: TypeForceNoCN, Entry: entry}
+
+		if hit, ok := in.geoApple.Covers(m); ok {
+			findings = append(findings, Finding{
+				Kind: FindingConflict, Type: TypeForceNoCN, Entry: entry, Other: hit.String(),
+				Reason: fmt.Sprintf("已被 geosite_apple.txt 中的 %s 抢先匹配，强制国外不会生效", hit),
+				Fixes:  []Fix{removeSelf},
+			})
+			continue
+		}
+		if hit, ok := in.geoCN.Covers(m); ok {
+			findings = append(findings, Finding{
+				Kind: FindingConflict, Type: TypeForceNoCN, Entry: entry, Other: hit.String(),
+				Reason: fmt.Sprintf("已被 geosite_cn.txt 中的 %s 抢先匹配，强制国外不会生效", hit),
+				Fixes:  []Fix{removeSelf},
+			})
+			continue
+		}
+		if hit, ok := cnSet.Covers(m); ok {
+			other := findRaw(in.cn, cnMatchers, hit)
+			findings = append(findings, Finding{
+				Kind: FindingConflict, Type: TypeForceNoCN, Entry: entry, Other: other,
+				Reason: fmt.Sprintf("与强制国内中的 %s 冲突，当前强制国内优先", other),
+				Fixes: []Fix{
+					{Label: "保留强制国内，删除强制国外中的 " + entry, Type: TypeForceNoCN, Entry: entry},
+					{Label: "保留强制国外，删除强制国内中的 " + other, Type: TypeForceCN, Entry: other},
+				},
+			})
+			continue
+		}
+		if f, ok := parentInList(TypeForceNoCN, in.nocn, nocnMatchers, i); ok {
+			findings = append(findings, f)
+			continue
+		}
+		if hit, ok := in.geoNoCN.Covers(m); ok {
+			findings = append(findings, Finding{
+				Kind: FindingRedundant, Type: TypeForceNoCN, Entry: entry, Other: hit.String(),
+				Reason: fmt.Sprintf("已被 geosite_no_cn.txt 中的 %s 覆盖", hit),
+				Fixes:  []Fix{removeSelf},
+			})
+		}
+	}
+
+	for i, m := range cnMatchers {
+		entry := in.cn[i]
+		if hit, ok := in.geoApple.Covers(m); ok {
+			// apple 分支带 ECS 查询国内上游，并丢弃非国内 IP，与强制国内的直接转发不同
+			findings = append(findings, Finding{
+				Kind: FindingConflict, Type: TypeForceCN, Entry: entry, Other: hit.String(),
+				Reason: fmt.Sprintf("已被 geosite_apple.txt 中的 %s 抢先匹配，按 Apple 分流解析，强制国内不会生效", hit),
+				Fixes:  []Fix{{Label: "从强制国内删除 " + entry, Type: TypeForceCN, Entry: entry}},
+			})
+			continue
+		}
+		if f, ok := parentInList(TypeForceCN, in.cn, cnMatchers, i); ok {
+			findings = append(findings, f)
+			continue
+		}
+		if hit, ok := in.geoCN.Covers(m); ok {
+			findings = append(findings, Finding{
+				Kind: FindingRedundant, Type: TypeForceCN, Entry: entry, Other: hit.String(),
+				Reason: fmt.Sprintf("已被 geosite_cn.txt 中的 %s 覆盖", hit),
+				Fixes:  []Fix{{Label: "从强制国内删除 " + entry, Type: TypeForceCN, Entry: entry}},
+			})
+		}
+	}
+
+	findings = append(findings, in.auditBlock()...)
+	findings = append(findings, auditIoT(in.iot)...)
+	return findings
+}
+
+// auditBlock 检查拦截名单：被白名单放行的拦截规则永远不会生效
+func (in *auditInput) auditBlock() []Finding {
+	var findings []Finding
+	blockMatchers := parseAll(in.block)
+	allowMatchers := parseAll(in.allow)
+	allowSet := NewDomainSet(allowMatchers)
+
+	for i, m := range blockMatchers {
+		entry := in.block[i]
+		if hit, ok := allowSet.Covers(m); ok {
+			other := findRaw(in.allow, allowMatchers, hit)
+			findings = append(findings, Finding{
+				Kind: FindingConflict, Type: TypeBlock, Entry: entry, Other: other,
+				Reason: fmt.Sprintf("已被拦截白名单中的 %s 放行，拦截不会生效", other),
+				Fixes: []Fix{
+					{Label: "从拦截名单删除 " + entry, Type: TypeBlock, Entry: entry},
+					{Label: "从拦截白名单删除 " + other, Type: TypeAllow, Entry: other},
+				},
+			})
+			continue
+		}
+		if f, ok := parentInList(TypeBlock, in.block, blockMatchers, i); ok {
+			findings = append(findings, f)
+			continue
+		}
+		if hit, ok := in.geoBlock.Covers(m); ok {
+			findings = append(findings, Finding{
+				Kind: FindingRedundant, Type: TypeBlock, Entry: entry, Other: hit.String(),
+				Reason: fmt.Sprintf("已被拦截订阅中的 %s 覆盖", hit),
+				Fixes:  []Fix{{Label: "从拦截名单删除 " + entry, Type: TypeBlock, Entry: entry}},
+			})
+		}
+	}
+	for i := range allowMatchers {
+		if f, ok := parentInList(TypeAllow, in.allow, allowMatchers, i); ok {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// parentInList 检查同一列表中是否已有覆盖第 i 条的规则 (父域名或重复项)
+func parentInList(rType RuleType, raw []string, matchers []Matcher, i int) (Finding, bool) {
+	for j, other := range matchers {
+		if j == i || !other.Covers(matchers[i]) {
+			continue
+		}
+		// 完全相同的两条只报告后出现的那条
+		if matchers[i].Covers(other) && j > i {
+			continue
+		}
+		reason := fmt.Sprintf("已被同一列表中的 %s 覆盖", raw[j])
+		if matchers[i] == other {
+			reason = "与同一列表中的条目重复"
+		}
+		return Finding{
+			Kind: FindingRedundant, Type: rType, Entry: raw[i], Other: raw[j],
+			Reason: reason,
+			Fixes:  []Fix{{Label: "删除 " + raw[i], Type: rType, Entry: raw[i]}},
+		}, true
+	}
+	return Finding{}, false
+}
+
+// auditIoT 检查 IoT 列表中相互重叠的网段
+func auditIoT(entries []string) []Finding {
+	var findings []Finding
+	nets := make([]*net.IPNet, len(entries))
+	for i, e := range entries {
+		nets[i] = parseNetwork(e)
+	}
+	for i, a := range nets {
+		if a == nil {
+			continue
+		}
+		for j, b := range nets {
+			if i == j || b == nil {
+				continue
+			}
+			aOnes, _ := a.Mask.Size()
+			bOnes, _ := b.Mask.Size()
+			if !b.Contains(a.IP) || bOnes > aOnes {
+				continue
+			}
+			if aOnes == bOnes && j > i {
+				continue
+			}
+			findings = append(findings, Finding{
+				Kind: FindingOverlap, Type: TypeIoT, Entry: entries[i], Other: entries[j],
+				Reason: fmt.Sprintf("已包含在网段 %s 中", entries[j]),
+				Fixes:  []Fix{{Label: "删除 " + entries[i], Type: TypeIoT, Entry: entries[i]}},
+			})
+			break
+		}
+	}
+	return findings
+}
+
+// parseNetwork 将 IP 或 CIDR 统一解析为网段
+func parseNetwork(s string) *net.IPNet {
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func parseAll(lines []string) []Matcher {
+	matchers := make([]Matcher, len(lines))
+	for i, l := range lines {
+		matchers[i] = ParseMatcher(l)
+	}
+	return matchers
+}
+
+// findRaw 根据匹配器找回原始行，便于删除
+func findRaw(raw []string, matchers []Matcher, m Matcher) string {
+	for i, x := range matchers {
+		if x == m {
+			return raw[i]
+		}
+	}
+	return m.String()
+}
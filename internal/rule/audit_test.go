@@ -0,0 +1,63 @@
+package rule
+
+import "testing"
+
+func TestAuditRun(t *testing.T) {
+	in := &auditInput{
+		cn:       []string{"icloud.com", "a.example.cn", "example.cn", "qq.com"},
+		nocn:     []string{"apple.com", "baidu.com", "example.cn", "google.com", "www.google.com", "twitter.com"},
+		iot:      []string{"192.168.1.0/24", "192.168.1.10", "10.0.0.1"},
+		block:    []string{"ads.example.com", "track.example.com", "doubleclick.net"},
+		allow:    []string{"ads.example.com", "ads.example.com"},
+		geoCN:    NewDomainSet(parseAll([]string{"baidu.com", "qq.com"})),
+		geoApple: NewDomainSet(parseAll([]string{"apple.com", "icloud.com"})),
+		geoNoCN:  NewDomainSet(parseAll([]string{"twitter.com"})),
+		geoBlock: NewDomainSet(parseAll([]string{"doubleclick.net"})),
+	}
+	type key struct {
+		kind  FindingKind
+		rType RuleType
+		entry string
+	}
+	want := map[key]string{
+		{FindingConflict, TypeForceNoCN, "apple.com"}:       "domain:apple.com",
+		{FindingConflict, TypeForceNoCN, "baidu.com"}:       "domain:baidu.com",
+		{FindingConflict, TypeForceNoCN, "example.cn"}:      "example.cn",
+		{FindingRedundant, TypeForceNoCN, "www.google.com"}: "google.com",
+		{FindingRedundant, TypeForceNoCN, "twitter.com"}:    "domain:twitter.com",
+		{FindingConflict, TypeForceCN, "icloud.com"}:        "domain:icloud.com",
+		{FindingRedundant, TypeForceCN, "a.example.cn"}:     "example.cn",
+		{FindingRedundant, TypeForceCN, "qq.com"}:           "domain:qq.com",
+		{FindingConflict, TypeBlock, "ads.example.com"}:     "ads.example.com",
+		{FindingRedundant, TypeBlock, "doubleclick.net"}:    "domain:doubleclick.net",
+		{FindingRedundant, TypeAllow, "ads.example.com"}:    "ads.example.com",
+		{FindingOverlap, TypeIoT, "192.168.1.10"}:           "192.168.1.0/24",
+	}
+
+	got := map[key]string{}
+	for _, f := range in.run() {
+		k := key{f.Kind, f.Type, f.Entry}
+		if _, dup := got[k]; dup {
+			t.Errorf("duplicate finding %v", f)
+		}
+		got[k] = f.Other
+		if len(f.Fixes) == 0 {
+			t.Errorf("finding without fixes: %v", f)
+		}
+	}
+	for k, other := range want {
+		g, ok := got[k]
+		if !ok {
+			t.Errorf("missing finding %v", k)
+			continue
+		}
+		if g != other {
+			t.Errorf("finding %v: other = %q, want %q", k, g, other)
+		}
+	}
+	for k := range got {
+		if _, ok := want[k]; !ok {
+			t.Errorf("unexpected finding %v", k)
+		}
+	}
+}
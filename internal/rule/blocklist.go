@@ -0,0 +1,197 @@
+package rule
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/service"
+)
+
+// PathBlockSources 保存拦截订阅地址，每行一个 URL
+const PathBlockSources = "/etc/mosdns/block_sources.txt"
+
+// DefaultBlockSource 未配置订阅时使用的默认拦截列表
+const DefaultBlockSource = "https://raw.githubusercontent.com/Loyalsoldier/v2ray-rules-dat/release/reject-list.txt"
+
+// BlockSources 返回当前的拦截订阅列表
+func BlockSources() []string {
+	lines, err := readEntries(PathBlockSources)
+	if os.IsNotExist(err) {
+		return []string{DefaultBlockSource}
+	}
+	return lines
+}
+
+// AddBlockSource 添加拦截订阅
+func AddBlockSource(url string) error {
+	url = strings.TrimSpace(url)
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return fmt.Errorf("订阅地址必须以 http:// 或 https:// 开头")
+	}
+	sources := BlockSources()
+	for _, s := range sources {
+		if s == url {
+			return fmt.Errorf("订阅已存在")
+		}
+	}
+	return writeLines(PathBlockSources, append(sources, url))
+}
+
+// RemoveBlockSource 删除拦截订阅
+func RemoveBlockSource(url string) error {
+	sources := BlockSources()
+	var kept []string
+	for _, s := range sources {
+		if s != strings.TrimSpace(url) {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == len(sources) {
+		return fmt.Errorf("没有找到订阅 %s", url)
+	}
+	// 写入空文件表示用户明确不需要任何订阅，不再回退到默认列表
+	return writeLines(PathBlockSources, kept)
+}
+
+// RefreshBlocklists 下载所有拦截订阅，转换并合并写入 geosite_block.txt
+// 托管在 GitHub 上的订阅会依次尝试 mirrors 中的加速前缀；由 UpdateGeoRules 调用，不负责重启服务
+// 返回值表示 geosite_block.txt 的内容是否发生变化
+func RefreshBlocklists(mirrors []string) (bool, error) {
+	rules, fetchErr := FetchBlocklists(mirrors)
+	// 全部失败时保留旧文件，避免把拦截列表清空
+	if rules == nil && fetchErr != nil {
+		return false, fetchErr
+	}
+	changed := !sameLines(PathGeoSiteBlock, rules)
+	if changed {
+		if err := writeLines(PathGeoSiteBlock, rules); err != nil {
+			return false, err
+		}
+		fmt.Printf("🛡️  拦截列表已更新，共 %d 条规则\n", len(rules))
+	} else {
+		fmt.Printf("🛡️  拦截列表无变化，共 %d 条规则\n", len(rules))
+	}
+	return changed, fetchErr
+}
+
+// FetchBlocklists 下载所有拦截订阅并合并为排序后的规则，不写入任何文件
+// 部分订阅失败时同时返回已合并的规则与错误；全部失败时规则为 nil
+func FetchBlocklists(mirrors []string) ([]string, error) {
+	sources := BlockSources()
+	merged := map[string]bool{}
+	failCount := 0
+
+	tmpDir, err := os.MkdirTemp("", "mosctl-block-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, url := range sources {
+		fmt.Printf("Downloading blocklist %s ...\n", url)
+		tmp := filepath.Join(tmpDir, fmt.Sprintf("%d.txt", i))
+		if _, err := service.DownloadFileVia(mirrors, url, tmp); err != nil {
+			fmt.Printf("❌ 下载失败 %s: %v\n", url, err)
+			failCount++
+			continue
+		}
+		data, err := os.ReadFile(tmp)
+		if err != nil {
+			failCount++
+			continue
+		}
+		rules, invalid := ConvertBlocklist(string(data))
+		if invalid > 0 {
+			fmt.Printf("⚠️  %s 中有 %d 条无效规则，已跳过\n", url, invalid)
+		}
+		for _, rule := range rules {
+			merged[rule] = true
+		}
+	}
+
+	if failCount > 0 && failCount == len(sources) {
+		return nil, fmt.Errorf("所有拦截订阅均下载失败")
+	}
+
+	rules := make([]string, 0, len(merged))
+	for r := range merged {
+		rules = append(rules, r)
+	}
+	sort.Strings(rules)
+	if failCount > 0 {
+		return rules, fmt.Errorf("%d 个拦截订阅下载失败", failCount)
+	}
+	return rules, nil
+}
+
+// sameLines 判断文件内容是否与 lines 完全一致
+func sameLines(path string, lines []string) bool {
+	existing, err := readLines(path)
+	if err != nil || len(existing) != len(lines) {
+		return false
+	}
+	for i := range lines {
+		if existing[i] != lines[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ConvertBlocklist 将常见的拦截列表格式转换为 MosDNS domain_set 规则
+// 支持 v2ray 域名列表、AdGuard/ABP 的 ||domain^ 写法以及 hosts 格式 (0.0.0.0 domain)
+// 带修饰符、通配符或例外 (@@) 的 AdGuard 规则无法等价表示，直接跳过；
+// 转换结果无法被 MosDNS 加载的行 (例如错误的正则) 会被丢弃，invalid 返回其数量
+func ConvertBlocklist(data string) (rules []string, invalid int) {
+	add := func(m Matcher) {
+		// 单级名称 (hosts 中的 broadcasthost、ip6-localhost 等) 不是拦截目标，也避免把 "com" 当成整个顶级域名拦截
+		if (m.Kind == MatchDomain || m.Kind == MatchFull) && !strings.Contains(m.Value, ".") {
+			return
+		}
+		if err := m.Validate(); err != nil {
+			invalid++
+			return
+		}
+		rules = append(rules, m.String())
+	}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == '!' || line[0] == '[' {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			continue
+		case strings.HasPrefix(line, "||"):
+			name, ok := strings.CutSuffix(strings.TrimPrefix(line, "||"), "^")
+			if !ok || strings.ContainsAny(name, "/*$^|") {
+				continue
+			}
+			add(Matcher{Kind: MatchDomain, Value: normalizeValue(MatchDomain, name)})
+		default:
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && net.ParseIP(fields[0]) != nil {
+				for _, name := range fields[1:] {
+					if name == "localhost" || strings.HasPrefix(name, "#") {
+						break
+					}
+					add(Matcher{Kind: MatchFull, Value: normalizeValue(MatchFull, name)})
+				}
+				continue
+			}
+			if len(fields) != 1 {
+				continue
+			}
+			m := ParseMatcher(line)
+			if m.Kind == MatchRegexp || m.Kind == MatchKeyword || !strings.ContainsAny(line, "/$|^") {
+				add(m)
+			}
+		}
+	}
+	return rules, invalid
+}
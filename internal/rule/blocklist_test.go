@@ -0,0 +1,57 @@
+package rule
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertBlocklist(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		invalid int
+	}{
+		{
+			name: "plain domains and prefixed rules",
+			data: "ads.example.com\ndomain:Track.Example.com.\nfull:pixel.example.com\nkeyword:doubleclick\nregexp:^ad[0-9]+\\.\n",
+			want: []string{"domain:ads.example.com", "domain:track.example.com", "full:pixel.example.com", "keyword:doubleclick", "regexp:^ad[0-9]+\\."},
+		},
+		{
+			name: "comments and headers",
+			data: "# comment\n! adblock comment\n[Adblock Plus 2.0]\n\n   \nads.example.com\n",
+			want: []string{"domain:ads.example.com"},
+		},
+		{
+			name: "adblock syntax",
+			data: "||ads.example.com^\n||tracker.example.net^\n@@||good.example.com^\n||ads.example.com^$third-party\n||example.com/banner/*\n|https://x.example.com|\n/banner/ad.\n",
+			want: []string{"domain:ads.example.com", "domain:tracker.example.net"},
+		},
+		{
+			name: "hosts format",
+			data: "127.0.0.1 localhost\n255.255.255.255 broadcasthost\n0.0.0.0 ads.example.com tracker.example.com # inline\n:: ip6.example.com\n0.0.0.0 com\n",
+			want: []string{"full:ads.example.com", "full:tracker.example.com", "full:ip6.example.com"},
+		},
+		{
+			name:    "invalid rules are dropped and counted",
+			data:    "regexp:(\nkeyword:\nbad..example.com\n||bad_-.example.com^\n0.0.0.0 -bad.example.com\nok.example.com\n",
+			want:    []string{"domain:ok.example.com"},
+			invalid: 5,
+		},
+		{
+			name: "single label names are skipped silently",
+			data: "localhost\nfull:router\nlan\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, invalid := ConvertBlocklist(tt.data)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rules = %q, want %q", got, tt.want)
+			}
+			if invalid != tt.invalid {
+				t.Errorf("invalid = %d, want %d", invalid, tt.invalid)
+			}
+		})
+	}
+}
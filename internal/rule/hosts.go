@@ -0,0 +1,327 @@
+package rule
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/service"
+)
+
+// PathHosts 对应 config.yaml 中 hosts 插件的文件
+const PathHosts = "/etc/mosdns/rules/hosts.txt"
+
+// HostEntry 是 hosts.txt 中的一条记录: <域名匹配器> <IP> [IP...]
+type HostEntry struct {
+	Line int // 在文件中的行号 (从 1 开始)
+	Name Matcher
+	IPs  []string
+}
+
+func (h HostEntry) String() string {
+	return h.Name.String() + " " + strings.Join(h.IPs, " ")
+}
+
+// HostsError 描述 hosts.txt 中无法被 MosDNS 解析的一行
+type HostsError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e HostsError) Error() string {
+	return fmt.Sprintf("第 %d 行 %q: %v", e.Line, e.Text, e.Err)
+}
+
+// ParseHostLine 按 MosDNS hosts 语法解析一行
+func ParseHostLine(line string) (HostEntry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return HostEntry{}, fmt.Errorf("缺少 IP 地址 (格式: 域名 IP [IP...])")
+	}
+	name, err := parseHostName(fields[0])
+	if err != nil {
+		return HostEntry{}, err
+	}
+	entry := HostEntry{Name: name}
+	for _, f := range fields[1:] {
+		ip := net.ParseIP(f)
+		if ip == nil {
+			return HostEntry{}, fmt.Errorf("%q 不是有效的 IPv4/IPv6 地址", f)
+		}
+		entry.IPs = appendUnique(entry.IPs, ip.String())
+	}
+	return entry, nil
+}
+
+func parseHostName(s string) (Matcher, error) {
+	if net.ParseIP(s) != nil {
+		return Matcher{}, fmt.Errorf("第一列应为域名而不是 IP (%s)", s)
+	}
+	m := ParseMatcher(s)
+	if err := m.Validate(); err != nil {
+		return Matcher{}, err
+	}
+	return m, nil
+}
+
+// LoadHosts 读取并校验 hosts.txt，返回有效记录和所有格式错误
+func LoadHosts() ([]HostEntry, []HostsError, error) {
+	f, err := os.Open(PathHosts)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var entries []HostEntry
+	var problems []HostsError
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := ParseHostLine(line)
+		if err != nil {
+			problems = append(problems, HostsError{Line: n, Text: line, Err: err})
+			continue
+		}
+		entry.Line = n
+		entries = append(entries, entry)
+	}
+	return entries, problems, scanner.Err()
+}
+
+// ValidateHosts 只返回格式错误，供手动编辑后检查使用
+func ValidateHosts() ([]HostsError, error) {
+	_, problems, err := LoadHosts()
+	return problems, err
+}
+
+// ShadowedHosts 找出被同名记录覆盖的条目，返回 "被覆盖条目下标 -> 生效条目下标"
+// MosDNS 按 full/domain 名称把记录存入 map，同名记录后加载的生效；
+// keyword 与 regexp 之间没有确定的先后顺序，不作判断
+func ShadowedHosts(entries []HostEntry) map[int]int {
+	shadowed := map[int]int{}
+	last := map[Matcher]int{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		name := entries[i].Name
+		if name.Kind != MatchFull && name.Kind != MatchDomain {
+			continue
+		}
+		if j, ok := last[name]; ok {
+			shadowed[i] = j
+			continue
+		}
+		last[name] = i
+	}
+	return shadowed
+}
+
+// AddHost 添加 hosts 记录，同名记录会合并 IP
+func AddHost(name string, ips []string) error {
+	entry, err := ParseHostLine(name + " " + strings.Join(ips, " "))
+	if err != nil {
+		return err
+	}
+	merged, err := mergeHosts([]HostEntry{entry})
+	if err != nil {
+		return err
+	}
+	if merged == 0 {
+		fmt.Printf("⚠️  %s 已存在相同记录，跳过添加。\n", entry.Name)
+		return nil
+	}
+	fmt.Printf("✅ 已写入 hosts: %s\n", entry)
+	return restartForHosts()
+}
+
+// RemoveHost 删除记录；指定 IP 时只删除这些地址，地址删空则删除整条记录
+func RemoveHost(name string, ips []string) error {
+	target, err := parseHostName(name)
+	if err != nil {
+		return err
+	}
+	drop := map[string]bool{}
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return fmt.Errorf("%q 不是有效的 IP 地址", ip)
+		}
+		drop[parsed.String()] = true
+	}
+
+	lines, err := readLines(PathHosts)
+	if err != nil {
+		return err
+	}
+	found := false
+	var out []string
+	for _, line := range lines {
+		entry, err := ParseHostLine(line)
+		if err != nil || entry.Name != target {
+			out = append(out, line)
+			continue
+		}
+		found = true
+		if len(drop) == 0 {
+			continue
+		}
+		var kept []string
+		for _, ip := range entry.IPs {
+			if !drop[ip] {
+				kept = append(kept, ip)
+			}
+		}
+		if len(kept) > 0 {
+			entry.IPs = kept
+			out = append(out, entry.String())
+		}
+	}
+	if !found {
+		return fmt.Errorf("hosts 中没有 %s 的记录", target)
+	}
+	if err := writeLines(PathHosts, out); err != nil {
+		return err
+	}
+	fmt.Printf("🗑️  已从 hosts 删除 %s\n", target)
+	return restartForHosts()
+}
+
+// ImportHosts 从 /etc/hosts 格式的文件导入记录 (IP 在前、域名在后)
+// 本机回环和 localhost 相关条目会被跳过，每个名称按 full: 精确匹配导入
+func ImportHosts(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var imported []HostEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() {
+			continue
+		}
+		for _, name := range fields[1:] {
+			lower := strings.ToLower(name)
+			if lower == "localhost" || strings.HasPrefix(lower, "ip6-") || !strings.Contains(lower, ".") {
+				continue
+			}
+			entry, err := ParseHostLine("full:" + lower + " " + ip.String())
+			if err != nil {
+				fmt.Printf("⚠️  跳过 %s: %v\n", name, err)
+				continue
+			}
+			imported = append(imported, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := mergeHosts(imported)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, restartForHosts()
+}
+
+// mergeHosts 将记录合并写入 hosts.txt，返回实际发生变化的记录数
+func mergeHosts(entries []HostEntry) (int, error) {
+	if err := os.MkdirAll("/etc/mosdns/rules", 0755); err != nil {
+		return 0, fmt.Errorf("无法创建目录: %v", err)
+	}
+	lines, err := readLines(PathHosts)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	changed := 0
+	for _, add := range entries {
+		merged := false
+		for i, line := range lines {
+			existing, err := ParseHostLine(line)
+			if err != nil || existing.Name != add.Name {
+				continue
+			}
+			before := len(existing.IPs)
+			for _, ip := range add.IPs {
+				existing.IPs = appendUnique(existing.IPs, ip)
+			}
+			if len(existing.IPs) != before {
+				lines[i] = existing.String()
+				changed++
+			}
+			merged = true
+			break
+		}
+		if !merged {
+			lines = append(lines, add.String())
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	return changed, writeLines(PathHosts, lines)
+}
+
+func restartForHosts() error {
+	fmt.Println("🔄 正在重载服务以生效 hosts...")
+	if err := service.RestartService(); err != nil {
+		fmt.Printf("❌ hosts 已写入但服务重启失败: %v\n", err)
+		return err
+	}
+	fmt.Println("🎉 服务重载成功，hosts 已生效！")
+	return nil
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, x := range list {
+		if x == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// readLines 读取文件的全部行 (保留注释)
+func readLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+// writeLines 按行写回文件 (先写临时文件再替换，避免写到一半的文件被 MosDNS 读取)
+func writeLines(path string, lines []string) error {
+	tmp, err := writeTemp(path, lines)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
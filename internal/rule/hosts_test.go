@@ -0,0 +1,65 @@
+package rule
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHostLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want string // HostEntry.String()，为空表示应当报错
+		ips  []string
+	}{
+		{"nas.lan 192.168.1.10", "domain:nas.lan 192.168.1.10", []string{"192.168.1.10"}},
+		{"full:nas.lan 192.168.1.10 fd00::10", "full:nas.lan 192.168.1.10 fd00::10", []string{"192.168.1.10", "fd00::10"}},
+		{"NAS.lan\t192.168.1.10   192.168.1.10", "domain:nas.lan 192.168.1.10", []string{"192.168.1.10"}},
+		{"keyword:printer 10.0.0.5", "keyword:printer 10.0.0.5", []string{"10.0.0.5"}},
+		{"fd00:0::10 x.lan", "", nil},
+		{"192.168.1.10 nas.lan", "", nil},
+		{"nas.lan", "", nil},
+		{"nas.lan 192.168.1.300", "", nil},
+		{"bad..lan 192.168.1.10", "", nil},
+		{"regexp:( 192.168.1.10", "", nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseHostLine(tt.line)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseHostLine(%q) = %v, want error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseHostLine(%q) error: %v", tt.line, err)
+			continue
+		}
+		if got.String() != tt.want || !reflect.DeepEqual(got.IPs, tt.ips) {
+			t.Errorf("ParseHostLine(%q) = %q %v, want %q %v", tt.line, got, got.IPs, tt.want, tt.ips)
+		}
+	}
+}
+
+func TestShadowedHosts(t *testing.T) {
+	var entries []HostEntry
+	for _, line := range []string{
+		"nas.lan 192.168.1.10",
+		"keyword:printer 10.0.0.5",
+		"nas.lan 192.168.1.11",
+		"keyword:office-printer 10.0.0.6",
+		"full:nas.lan 192.168.1.12",
+		"keyword:printer 10.0.0.7",
+		"nas.lan 192.168.1.13",
+	} {
+		e, err := ParseHostLine(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	// 同名的 full/domain 记录只有最后一条生效；keyword 没有先后顺序，不报告
+	want := map[int]int{0: 6, 2: 6}
+	if got := ShadowedHosts(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("ShadowedHosts = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,228 @@
+package rule
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// 匹配器类型，与 MosDNS domain_set 的前缀一致
+const (
+	MatchDomain  = "domain"
+	MatchFull    = "full"
+	MatchKeyword = "keyword"
+	MatchRegexp  = "regexp"
+)
+
+// Matcher 表示一条 MosDNS 域名匹配规则 (例如 domain:example.com)
+type Matcher struct {
+	Kind  string
+	Value string
+}
+
+// ParseMatcher 解析一行域名规则，不带前缀时视为 domain:
+func ParseMatcher(line string) Matcher {
+	line = strings.TrimSpace(line)
+	if kind, value, ok := strings.Cut(line, ":"); ok {
+		switch kind {
+		case MatchDomain, MatchFull, MatchKeyword, MatchRegexp:
+			return Matcher{Kind: kind, Value: normalizeValue(kind, value)}
+		}
+	}
+	return Matcher{Kind: MatchDomain, Value: normalizeValue(MatchDomain, line)}
+}
+
+func normalizeValue(kind, value string) string {
+	value = strings.TrimSpace(value)
+	if kind == MatchRegexp {
+		return value
+	}
+	return strings.TrimSuffix(strings.ToLower(value), ".")
+}
+
+func (m Matcher) String() string {
+	return m.Kind + ":" + m.Value
+}
+
+var domainLabelRegex = regexp.MustCompile(`^[a-z0-9_*]([a-z0-9_*-]*[a-z0-9_*])?$`)
+
+// Validate 检查规则能否被 MosDNS 加载
+func (m Matcher) Validate() error {
+	switch m.Kind {
+	case MatchRegexp:
+		if _, err := regexp.Compile(m.Value); err != nil {
+			return fmt.Errorf("正则表达式无效: %v", err)
+		}
+	case MatchKeyword:
+		if m.Value == "" {
+			return fmt.Errorf("keyword 不能为空")
+		}
+	default:
+		if m.Value == "" {
+			return fmt.Errorf("域名不能为空")
+		}
+		for _, label := range strings.Split(m.Value, ".") {
+			if !domainLabelRegex.MatchString(label) {
+				return fmt.Errorf("%q 不是有效的域名", m.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// Match 判断域名是否被该规则命中
+func (m Matcher) Match(domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	switch m.Kind {
+	case MatchFull:
+		return domain == m.Value
+	case MatchDomain:
+		return domain == m.Value || strings.HasSuffix(domain, "."+m.Value)
+	case MatchKeyword:
+		return strings.Contains(domain, m.Value)
+	case MatchRegexp:
+		re, err := regexp.Compile(m.Value)
+		return err == nil && re.MatchString(domain)
+	}
+	return false
+}
+
+// Covers 判断 m 是否覆盖 other 能命中的所有域名
+// regexp 与 keyword 只做保守判断，无法确定时返回 false
+func (m Matcher) Covers(other Matcher) bool {
+	switch other.Kind {
+	case MatchFull:
+		return m.Match(other.Value)
+	case MatchDomain:
+		switch m.Kind {
+		case MatchDomain, MatchKeyword:
+			return m.Match(other.Value)
+		}
+	case MatchKeyword:
+		return m.Kind == MatchKeyword && strings.Contains(other.Value, m.Value)
+	case MatchRegexp:
+		return m.Kind == MatchRegexp && m.Value == other.Value
+	}
+	return false
+}
+
+// DomainSet 是一组域名规则的索引，用于快速查询覆盖关系
+type DomainSet struct {
+	domains  map[string]bool
+	fulls    map[string]bool
+	keywords []string
+	regexps  []*regexp.Regexp
+	raw      []Matcher
+}
+
+// NewDomainSet 从规则列表构建索引
+func NewDomainSet(matchers []Matcher) *DomainSet {
+	s := &DomainSet{domains: map[string]bool{}, fulls: map[string]bool{}}
+	for _, m := range matchers {
+		s.raw = append(s.raw, m)
+		switch m.Kind {
+		case MatchDomain:
+			s.domains[m.Value] = true
+		case MatchFull:
+			s.fulls[m.Value] = true
+		case MatchKeyword:
+			s.keywords = append(s.keywords, m.Value)
+		case MatchRegexp:
+			if re, err := regexp.Compile(m.Value); err == nil {
+				s.regexps = append(s.regexps, re)
+			}
+		}
+	}
+	return s
+}
+
+// LoadDomainSet 读取 domain_set 文本文件，文件不存在时返回空集合
+func LoadDomainSet(path string) (*DomainSet, error) {
+	lines, err := readEntries(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	matchers := make([]Matcher, 0, len(lines))
+	for _, l := range lines {
+		matchers = append(matchers, ParseMatcher(l))
+	}
+	return NewDomainSet(matchers), nil
+}
+
+// Len 返回规则条数
+func (s *DomainSet) Len() int {
+	return len(s.raw)
+}
+
+// Covers 判断集合中是否存在覆盖 m 的规则，返回命中的那一条
+func (s *DomainSet) Covers(m Matcher) (Matcher, bool) {
+	switch m.Kind {
+	case MatchFull, MatchDomain:
+		if m.Kind == MatchFull && s.fulls[m.Value] {
+			return Matcher{Kind: MatchFull, Value: m.Value}, true
+		}
+		// 逐级查找父域名
+		name := m.Value
+		for {
+			if s.domains[name] {
+				return Matcher{Kind: MatchDomain, Value: name}, true
+			}
+			i := strings.IndexByte(name, '.')
+			if i < 0 {
+				break
+			}
+			name = name[i+1:]
+		}
+		for _, k := range s.keywords {
+			if strings.Contains(m.Value, k) {
+				return Matcher{Kind: MatchKeyword, Value: k}, true
+			}
+		}
+		if m.Kind == MatchFull {
+			for _, re := range s.regexps {
+				if re.MatchString(m.Value) {
+					return Matcher{Kind: MatchRegexp, Value: re.String()}, true
+				}
+			}
+		}
+	default:
+		for _, r := range s.raw {
+			if r.Covers(m) {
+				return r, true
+			}
+		}
+	}
+	return Matcher{}, false
+}
+
+// readEntries 读取规则文件中的有效行 (跳过空行与注释)
+func readEntries(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// CountEntries 返回规则文件中的有效条目数 (不含空行与注释)，文件不存在时为 0
+func CountEntries(path string) (int, error) {
+	lines, err := readEntries(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return len(lines), err
+}
@@ -0,0 +1,123 @@
+package rule
+
+import "testing"
+
+func TestParseMatcher(t *testing.T) {
+	tests := []struct {
+		line string
+		want Matcher
+	}{
+		{"example.com", Matcher{MatchDomain, "example.com"}},
+		{"  Example.COM. ", Matcher{MatchDomain, "example.com"}},
+		{"domain:a.example.com", Matcher{MatchDomain, "a.example.com"}},
+		{"full:WWW.example.com", Matcher{MatchFull, "www.example.com"}},
+		{"keyword:Ads", Matcher{MatchKeyword, "ads"}},
+		{"regexp:^A\\.example\\.com$", Matcher{MatchRegexp, "^A\\.example\\.com$"}},
+		// 未知前缀按普通域名处理
+		{"geosite:cn", Matcher{MatchDomain, "geosite:cn"}},
+	}
+	for _, tt := range tests {
+		if got := ParseMatcher(tt.line); got != tt.want {
+			t.Errorf("ParseMatcher(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestMatcherValidate(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+	}{
+		{"example.com", true},
+		{"xn--p1ai.example", true},
+		{"_dmarc.example.com", true},
+		{"full:a.example.com", true},
+		{"keyword:ads", true},
+		{"regexp:^ad[0-9]+\\.", true},
+		{"regexp:(", false},
+		{"keyword:", false},
+		{"domain:", false},
+		{"a..example.com", false},
+		{"-bad.example.com", false},
+		{"bad-.example.com", false},
+		{"exa$mple.com", false},
+	}
+	for _, tt := range tests {
+		err := ParseMatcher(tt.line).Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("Validate(%q) = %v, want ok=%v", tt.line, err, tt.ok)
+		}
+	}
+}
+
+func TestMatcherMatch(t *testing.T) {
+	tests := []struct {
+		rule, domain string
+		want         bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "a.b.example.com.", true},
+		{"example.com", "badexample.com", false},
+		{"full:example.com", "EXAMPLE.com", true},
+		{"full:example.com", "a.example.com", false},
+		{"keyword:ads", "myads.example.com", true},
+		{"regexp:^ad[0-9]+\\.", "ad12.example.com", true},
+		{"regexp:^ad[0-9]+\\.", "ads.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := ParseMatcher(tt.rule).Match(tt.domain); got != tt.want {
+			t.Errorf("%q.Match(%q) = %v, want %v", tt.rule, tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestMatcherCovers(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"example.com", "a.example.com", true},
+		{"example.com", "full:example.com", true},
+		{"a.example.com", "example.com", false},
+		{"full:example.com", "example.com", false},
+		{"full:example.com", "full:example.com", true},
+		{"keyword:ads", "ads.example.com", true},
+		{"keyword:ad", "keyword:ads", true},
+		{"keyword:ads", "keyword:ad", false},
+		{"regexp:^a", "regexp:^a", true},
+		// regexp 无法判断是否覆盖整个域名后缀，保守返回 false
+		{"regexp:.*", "example.com", false},
+		{"regexp:.*", "full:example.com", true},
+		{"example.com", "keyword:example", false},
+	}
+	for _, tt := range tests {
+		if got := ParseMatcher(tt.a).Covers(ParseMatcher(tt.b)); got != tt.want {
+			t.Errorf("%q.Covers(%q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDomainSetCovers(t *testing.T) {
+	set := NewDomainSet(parseAll([]string{"example.com", "full:www.test.com", "keyword:tracker", "regexp:^ad[0-9]+\\."}))
+	tests := []struct {
+		entry string
+		hit   string
+		ok    bool
+	}{
+		{"a.b.example.com", "domain:example.com", true},
+		{"example.com", "domain:example.com", true},
+		{"full:www.test.com", "full:www.test.com", true},
+		{"www.test.com", "", false},
+		{"x.tracker.net", "keyword:tracker", true},
+		{"full:ad1.foo.com", "regexp:^ad[0-9]+\\.", true},
+		{"ad1.foo.com", "", false},
+		{"keyword:mytracker", "keyword:tracker", true},
+		{"other.org", "", false},
+	}
+	for _, tt := range tests {
+		hit, ok := set.Covers(ParseMatcher(tt.entry))
+		if ok != tt.ok || (ok && hit.String() != tt.hit) {
+			t.Errorf("Covers(%q) = %v, %v, want %q, %v", tt.entry, hit, ok, tt.hit, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package rule
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KyleYu2024/mosctl/internal/service"
+)
+
+// metaPrefix 标记 mosctl 写入的元数据注释，MosDNS 会把它当作普通注释忽略
+const metaPrefix = "# mosctl:"
+
+// Meta 记录一条规则的来历：添加时间、操作人、备注与过期时间
+type Meta struct {
+	Added   time.Time
+	By      string
+	Note    string
+	Expires time.Time
+}
+
+// NewMeta 生成带当前时间和操作人的元数据
+func NewMeta(note string, expires time.Time) Meta {
+	return Meta{Added: time.Now(), By: currentUser(), Note: note, Expires: expires}
+}
+
+// Expired 判断规则是否已过期
+func (m Meta) Expired(now time.Time) bool {
+	return !m.Expires.IsZero() && now.After(m.Expires)
+}
+
+// String 生成写入规则文件的注释行
+func (m Meta) String() string {
+	parts := []string{metaPrefix}
+	if !m.Added.IsZero() {
+		parts = append(parts, "added="+m.Added.Format(time.RFC3339))
+	}
+	if m.By != "" {
+		parts = append(parts, "by="+strconv.Quote(m.By))
+	}
+	if !m.Expires.IsZero() {
+		parts = append(parts, "expires="+m.Expires.Format(time.RFC3339))
+	}
+	if m.Note != "" {
+		parts = append(parts, "note="+strconv.Quote(m.Note))
+	}
+	return strings.Join(parts, " ")
+}
+
+// isMetaLine 判断一行是否为 mosctl 元数据注释
+func isMetaLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), metaPrefix)
+}
+
+// parseMeta 解析元数据注释，无法识别的字段会被忽略
+func parseMeta(line string) Meta {
+	var m Meta
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), metaPrefix))
+	for rest != "" {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.TrimSpace(key)
+		if strings.HasPrefix(value, `"`) {
+			quoted, err := strconv.QuotedPrefix(value)
+			if err != nil {
+				break
+			}
+			rest = strings.TrimSpace(value[len(quoted):])
+			value, _ = strconv.Unquote(quoted)
+		} else {
+			value, rest, _ = strings.Cut(value, " ")
+			rest = strings.TrimSpace(rest)
+		}
+
+		switch key {
+		case "added":
+			m.Added, _ = time.Parse(time.RFC3339, value)
+		case "by":
+			m.By = value
+		case "expires":
+			m.Expires, _ = time.Parse(time.RFC3339, value)
+		case "note":
+			m.Note = value
+		}
+	}
+	return m
+}
+
+// ParseExpiry 解析过期时间，支持相对时长 (30m, 12h, 7d, 2w) 和日期 (2026-12-01)
+func ParseExpiry(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			if !t.After(now) {
+				return time.Time{}, fmt.Errorf("过期时间 %s 已经过去", s)
+			}
+			return t, nil
+		}
+	}
+
+	unit := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if mul, ok := unit[s[len(s)-1]]; ok {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil || n <= 0 {
+			return time.Time{}, fmt.Errorf("无法识别的过期时间 %q", s)
+		}
+		return now.Add(time.Duration(n) * mul), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("无法识别的过期时间 %q (例如 7d、12h 或 2026-12-01)", s)
+	}
+	return now.Add(d), nil
+}
+
+// currentUser 返回执行操作的用户，sudo 时取原始用户
+func currentUser() string {
+	if u := os.Getenv("SUDO_USER"); u != "" {
+		return u
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// Entry 是规则文件中的一条规则及其元数据
+type Entry struct {
+	Value   string
+	Meta    Meta
+	HasMeta bool
+}
+
+// ListRules 读取某个列表的全部规则及元数据
+func ListRules(rType RuleType) ([]Entry, error) {
+	lines, err := readLines(listPath(rType))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseEntries(lines), nil
+}
+
+// parseEntries 解析规则文件的各行；元数据注释只属于紧随其后的那一行规则，
+// 中间隔着空行或其他注释时视为孤立的元数据 (例如规则被手动删掉了)
+func parseEntries(lines []string) []Entry {
+	var entries []Entry
+	var pending *Meta
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case isMetaLine(line):
+			m := parseMeta(line)
+			pending = &m
+		case line == "" || strings.HasPrefix(line, "#"):
+			pending = nil
+		default:
+			e := Entry{Value: line}
+			if pending != nil {
+				e.Meta, e.HasMeta = *pending, true
+				pending = nil
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// isRuleLine 判断一行是否为规则 (非空且不是注释)
+func isRuleLine(line string) bool {
+	line = strings.TrimSpace(line)
+	return line != "" && !strings.HasPrefix(line, "#")
+}
+
+// dropExpired 删除已过期的元数据注释及紧随其后的规则，返回剩余的行和被删除的规则
+// 孤立的元数据注释不会牵连其他规则
+func dropExpired(lines []string, now time.Time) ([]string, []Entry) {
+	var kept []string
+	var expired []Entry
+	for i := 0; i < len(lines); i++ {
+		if isMetaLine(lines[i]) && i+1 < len(lines) && isRuleLine(lines[i+1]) {
+			if m := parseMeta(lines[i]); m.Expired(now) {
+				expired = append(expired, Entry{Value: strings.TrimSpace(lines[i+1]), Meta: m, HasMeta: true})
+				i++
+				continue
+			}
+		}
+		kept = append(kept, lines[i])
+	}
+	return kept, expired
+}
+
+// AllTypes 列出所有可管理的规则列表
+func AllTypes() []RuleType {
+	return []RuleType{TypeForceCN, TypeForceNoCN, TypeIoT, TypeBlock, TypeAllow}
+}
+
+// CollectGarbage 删除所有已过期的规则，有改动时只重启一次服务
+func CollectGarbage() (int, error) {
+	now := time.Now()
+	files := map[string][]string{}
+	total := 0
+	for _, rType := range AllTypes() {
+		lines, err := readLines(listPath(rType))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("读取 [%s] 失败: %v", ListName(rType), err)
+		}
+		kept, expired := dropExpired(lines, now)
+		for _, e := range expired {
+			fmt.Printf("⌛ [%s] %s 已于 %s 过期\n", ListName(rType), e.Value, e.Meta.Expires.Format("2006-01-02 15:04"))
+		}
+		if len(expired) > 0 {
+			files[listPath(rType)] = kept
+			total += len(expired)
+		}
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	if err := replaceFiles(files); err != nil {
+		return 0, err
+	}
+
+	fmt.Println("🔄 正在重载服务以生效规则...")
+	if err := service.RestartService(); err != nil {
+		return total, fmt.Errorf("规则已删除但服务重启失败: %v", err)
+	}
+	return total, nil
+}
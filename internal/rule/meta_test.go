@@ -0,0 +1,147 @@
+package rule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetaRoundTrip(t *testing.T) {
+	added := time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)
+	expires := added.Add(7 * 24 * time.Hour)
+	tests := []Meta{
+		{},
+		{Added: added, By: "alice"},
+		{Added: added, By: "root", Note: `vendor API "v2" = ok`, Expires: expires},
+		{Note: "含空格 与 中文"},
+	}
+	for _, m := range tests {
+		line := m.String()
+		if !isMetaLine(line) {
+			t.Errorf("isMetaLine(%q) = false", line)
+		}
+		got := parseMeta(line)
+		if !got.Added.Equal(m.Added) || got.By != m.By || got.Note != m.Note || !got.Expires.Equal(m.Expires) {
+			t.Errorf("parseMeta(%q) = %+v, want %+v", line, got, m)
+		}
+	}
+}
+
+func TestParseMeta(t *testing.T) {
+	tests := []struct {
+		line string
+		want Meta
+	}{
+		{`# mosctl: by="bob" unknown=1 note="x"`, Meta{By: "bob", Note: "x"}},
+		{`  # mosctl:   note="a b"   `, Meta{Note: "a b"}},
+		{`# mosctl: added=not-a-time by="c"`, Meta{By: "c"}},
+		// 引号不完整时停止解析，已解析的字段保留
+		{`# mosctl: by="d" note="broken`, Meta{By: "d"}},
+		{`# mosctl: garbage`, Meta{}},
+	}
+	for _, tt := range tests {
+		if got := parseMeta(tt.line); got != tt.want {
+			t.Errorf("parseMeta(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		in   string
+		want time.Time
+		err  bool
+	}{
+		{"", time.Time{}, false},
+		{"30m", now.Add(30 * time.Minute), false},
+		{"12h", now.Add(12 * time.Hour), false},
+		{"7d", now.Add(7 * 24 * time.Hour), false},
+		{"2w", now.Add(14 * 24 * time.Hour), false},
+		{" 1d ", now.Add(24 * time.Hour), false},
+		{"2026-12-01", time.Date(2026, 12, 1, 0, 0, 0, 0, time.Local), false},
+		{"2026-03-02 08:00", time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local), false},
+		{"2026-01-01", time.Time{}, true},
+		{"0d", time.Time{}, true},
+		{"-5h", time.Time{}, true},
+		{"xd", time.Time{}, true},
+		{"soon", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseExpiry(tt.in, now)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseExpiry(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseExpiry(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	tests := []struct {
+		content string
+		rType   RuleType
+		ok      bool
+	}{
+		{"example.com", TypeForceCN, true},
+		{"regexp:^ad[0-9]+\\.", TypeBlock, true},
+		{"keyword:ads", TypeAllow, true},
+		{"192.168.1.10", TypeIoT, true},
+		{"192.168.1.0/24", TypeIoT, true},
+		{"example.com", TypeIoT, false},
+		{"192.168.1.10", TypeForceNoCN, false},
+		{"10.0.0.0/8", TypeBlock, false},
+		{"regexp:(", TypeForceNoCN, false},
+		{"full:a..b", TypeForceCN, false},
+		{"exa mple.com", TypeForceCN, false},
+		{"example.com#x", TypeForceCN, false},
+		{"", TypeForceCN, false},
+	}
+	for _, tt := range tests {
+		err := validateRule(tt.content, tt.rType)
+		if (err == nil) != tt.ok {
+			t.Errorf("validateRule(%q, %v) = %v, want ok=%v", tt.content, tt.rType, err, tt.ok)
+		}
+	}
+}
+
+func TestParseEntriesOrphanedMeta(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	expired := Meta{Added: now.Add(-48 * time.Hour), Expires: now.Add(-time.Hour)}.String()
+	live := Meta{Added: now.Add(-48 * time.Hour), Expires: now.Add(time.Hour)}.String()
+	lines := []string{
+		expired, // 规则已被手动删除，下一行是空行
+		"",
+		"keep-a.com",
+		expired, // 下一行是普通注释
+		"# 手写的说明",
+		"keep-b.com",
+		expired,
+		"gone.com",
+		live,
+		"later.com",
+		expired, // 文件末尾的孤立元数据
+	}
+
+	entries := parseEntries(lines)
+	want := map[string]bool{"keep-a.com": false, "keep-b.com": false, "gone.com": true, "later.com": true}
+	if len(entries) != len(want) {
+		t.Fatalf("parseEntries returned %d entries, want %d", len(entries), len(want))
+	}
+	for _, e := range entries {
+		if e.HasMeta != want[e.Value] {
+			t.Errorf("%s: HasMeta = %v, want %v", e.Value, e.HasMeta, want[e.Value])
+		}
+	}
+
+	kept, removed := dropExpired(lines, now)
+	if len(removed) != 1 || removed[0].Value != "gone.com" {
+		t.Errorf("dropExpired removed %+v, want only gone.com", removed)
+	}
+	wantKept := []string{expired, "", "keep-a.com", expired, "# 手写的说明", "keep-b.com", live, "later.com", expired}
+	if strings.Join(kept, "\n") != strings.Join(wantKept, "\n") {
+		t.Errorf("dropExpired kept:\n%s\nwant:\n%s", strings.Join(kept, "\n"), strings.Join(wantKept, "\n"))
+	}
+}
@@ -0,0 +1,250 @@
+package rule
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KyleYu2024/mosctl/internal/service"
+)
+
+// Tx 暂存对多个规则列表的增删操作
+// Commit 时统一校验、原子写入，并且只重启一次 MosDNS
+type Tx struct {
+	ops []txOp
+}
+
+type txOp struct {
+	remove  bool
+	rType   RuleType
+	content string
+	meta    Meta
+}
+
+// Result 是事务中单条操作的结果
+type Result struct {
+	Type    RuleType
+	Content string
+	Remove  bool
+	Skipped bool  // 重复添加等无需改动的情况
+	Err     error // 校验失败或条目不存在
+}
+
+func (r Result) String() string {
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("❌ %s: %v", r.Content, r.Err)
+	case r.Skipped && r.Remove:
+		return fmt.Sprintf("⚠️  %s 不在 [%s] 中，跳过删除。", r.Content, ListName(r.Type))
+	case r.Skipped:
+		return fmt.Sprintf("⚠️  内容 %s 已经在 [%s] 中了，跳过添加。", r.Content, ListName(r.Type))
+	case r.Remove:
+		return fmt.Sprintf("🗑️  已从 [%s] 删除 %s", ListName(r.Type), r.Content)
+	}
+	return fmt.Sprintf("✅ 已将 %s 添加到 [%s]", r.Content, ListName(r.Type))
+}
+
+// Begin 开始一个新的规则事务
+func Begin() *Tx {
+	return &Tx{}
+}
+
+// Add 暂存一条添加操作
+func (tx *Tx) Add(content string, rType RuleType, meta Meta) {
+	tx.ops = append(tx.ops, txOp{rType: rType, content: strings.TrimSpace(content), meta: meta})
+}
+
+// Remove 暂存一条删除操作，规则上一行的元数据注释会一并删除
+func (tx *Tx) Remove(content string, rType RuleType) {
+	tx.ops = append(tx.ops, txOp{remove: true, rType: rType, content: strings.TrimSpace(content)})
+}
+
+// Len 返回已暂存的操作数
+func (tx *Tx) Len() int {
+	return len(tx.ops)
+}
+
+// Commit 执行全部操作。所有条目在读写任何文件之前先逐条校验，
+// 单条失败只记录在对应的 Result 中，不影响其他条目；
+// 返回的 error 表示写文件或重启服务失败
+func (tx *Tx) Commit() ([]Result, error) {
+	results := tx.validate()
+	files := map[RuleType][]string{}
+	changed := map[RuleType]bool{}
+	adds := map[RuleType][]string{}
+
+	for i, op := range tx.ops {
+		res := results[i]
+		if res.Err != nil {
+			continue
+		}
+
+		lines, ok := files[op.rType]
+		if !ok {
+			var err error
+			lines, err = readLines(listPath(op.rType))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("读取 [%s] 失败: %v", ListName(op.rType), err)
+			}
+		}
+
+		idx := indexOfEntry(lines, op.content)
+		switch {
+		case op.remove && idx < 0:
+			res.Skipped = true
+		case op.remove:
+			start := idx
+			if start > 0 && isMetaLine(lines[start-1]) {
+				start--
+			}
+			lines = append(lines[:start:start], lines[idx+1:]...)
+			changed[op.rType] = true
+		case idx >= 0:
+			res.Skipped = true
+		default:
+			lines = append(lines, op.meta.String(), op.content)
+			changed[op.rType] = true
+			adds[op.rType] = append(adds[op.rType], op.content)
+		}
+		files[op.rType] = lines
+		results[i] = res
+	}
+
+	// 冲突提示 (仅警告，不阻止添加)
+	if len(adds) > 0 {
+		for _, f := range checkEntries(adds) {
+			fmt.Printf("⚠️  %s\n", f)
+		}
+	}
+
+	err := writeAll(files, changed)
+	if err != nil {
+		// 写入失败时所有改动都没有生效，逐条标记后照常输出
+		for i, r := range results {
+			if r.Err == nil && !r.Skipped {
+				results[i].Err = fmt.Errorf("未写入: %v", err)
+			}
+		}
+	}
+	for _, r := range results {
+		fmt.Println(r)
+	}
+	if err != nil || len(changed) == 0 {
+		return results, err
+	}
+
+	// 重启生效 (使用 Restart 避免 Systemd Reload 报错)
+	fmt.Println("🔄 正在重载服务以生效规则...")
+	if err := service.RestartService(); err != nil {
+		fmt.Printf("❌ 规则已写入但服务重启失败: %v\n", err)
+		return results, err
+	}
+	fmt.Println("🎉 服务重载成功，规则已生效！")
+	return results, nil
+}
+
+// validate 校验全部暂存的操作，返回与 ops 一一对应的初始结果
+func (tx *Tx) validate() []Result {
+	results := make([]Result, len(tx.ops))
+	for i, op := range tx.ops {
+		res := Result{Type: op.rType, Content: op.content, Remove: op.remove}
+		if !op.remove {
+			res.Err = validateRule(op.content, op.rType)
+		} else if listPath(op.rType) == "" {
+			res.Err = fmt.Errorf("未知的规则类型")
+		}
+		results[i] = res
+	}
+	return results
+}
+
+// writeAll 把改动过的列表写回各自的文件
+func writeAll(files map[RuleType][]string, changed map[RuleType]bool) error {
+	if err := os.MkdirAll("/etc/mosdns/rules", 0755); err != nil {
+		return fmt.Errorf("无法创建目录: %v", err)
+	}
+	out := map[string][]string{}
+	for rType := range changed {
+		out[listPath(rType)] = files[rType]
+	}
+	return replaceFiles(out)
+}
+
+// replaceFiles 先把所有内容写入临时文件，全部成功后再逐个替换，尽量保证要么都生效要么都不生效
+func replaceFiles(files map[string][]string) error {
+	staged := map[string]string{}
+	cleanup := func() {
+		for tmp := range staged {
+			os.Remove(tmp)
+		}
+	}
+	for path, lines := range files {
+		tmp, err := writeTemp(path, lines)
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("写入 %s 失败: %v", path, err)
+		}
+		staged[tmp] = path
+	}
+	for tmp, dest := range staged {
+		if err := os.Rename(tmp, dest); err != nil {
+			cleanup()
+			return fmt.Errorf("替换 %s 失败: %v", dest, err)
+		}
+		delete(staged, tmp)
+	}
+	return nil
+}
+
+// writeTemp 在目标文件同目录下写入临时文件，返回临时文件路径
+func writeTemp(path string, lines []string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return "", err
+	}
+	out := strings.Join(lines, "\n")
+	if out != "" {
+		out += "\n"
+	}
+	if _, err := f.WriteString(out); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// indexOfEntry 查找规则所在行 (忽略注释)，不存在时返回 -1
+func indexOfEntry(lines []string, content string) int {
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == content {
+			return i
+		}
+	}
+	return -1
+}
+
+// RemoveRules 从各列表中删除指定规则，全部完成后只重启一次服务
+func RemoveRules(removals map[RuleType][]string) error {
+	tx := Begin()
+	for rType, entries := range removals {
+		for _, e := range entries {
+			tx.Remove(e, rType)
+		}
+	}
+	_, err := tx.Commit()
+	return err
+}
@@ -0,0 +1,71 @@
+package rule
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTxValidate(t *testing.T) {
+	tx := Begin()
+	tx.Add(" example.com ", TypeForceCN, Meta{})
+	tx.Add("regexp:(", TypeForceNoCN, Meta{})
+	tx.Add("192.168.1.10", TypeIoT, Meta{})
+	tx.Add("example.com", TypeIoT, Meta{})
+	tx.Remove("anything", TypeBlock)
+	tx.Remove("anything", RuleType(99))
+
+	wantErr := []bool{false, true, false, true, false, true}
+	results := tx.validate()
+	if len(results) != tx.Len() {
+		t.Fatalf("validate returned %d results for %d ops", len(results), tx.Len())
+	}
+	for i, r := range results {
+		if (r.Err != nil) != wantErr[i] {
+			t.Errorf("op %d (%s): err = %v, want error %v", i, r.Content, r.Err, wantErr[i])
+		}
+	}
+	if results[0].Content != "example.com" {
+		t.Errorf("content not trimmed: %q", results[0].Content)
+	}
+}
+
+func TestReplaceFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("old-a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := replaceFiles(map[string][]string{a: {"x", "y"}, b: nil}); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, a, "x\ny\n")
+	assertFile(t, b, "")
+
+	// 任一文件无法写入时，其他文件保持原样，也不留下临时文件
+	missing := filepath.Join(dir, "no-such-dir", "c.txt")
+	if err := replaceFiles(map[string][]string{a: {"new"}, missing: {"new"}}); err == nil {
+		t.Fatal("replaceFiles succeeded with an unwritable path")
+	}
+	assertFile(t, a, "x\ny\n")
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("temporary file left behind: %s", e.Name())
+		}
+	}
+}
+
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q, want %q", filepath.Base(path), got, want)
+	}
+}
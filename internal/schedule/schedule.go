@@ -0,0 +1,451 @@
+package schedule
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 自动更新由 mosctl-update.timer 触发 mosctl-update.service；没有 systemd 时改写 root 的 crontab
+const (
+	UnitDir     = "/etc/systemd/system"
+	ServiceUnit = "mosctl-update.service"
+	TimerUnit   = "mosctl-update.timer"
+	// DefaultCalendar 与旧版安装脚本的 "0 2 * * *" 一致
+	DefaultCalendar = "*-*-* 02:00:00"
+	// RandomDelay 避免大量机器同时请求 GitHub
+	RandomDelay = "30min"
+	// cronMarker 用于识别 mosctl 写入的 crontab 行 (含旧版安装脚本写入的行)
+	cronMarker = "mosctl update"
+	mosctlBin  = "/usr/local/bin/mosctl"
+)
+
+// Backend 是计划任务的实现方式
+type Backend string
+
+const (
+	BackendSystemd Backend = "systemd"
+	BackendCron    Backend = "crontab"
+)
+
+// Status 是当前的自动更新计划
+type Status struct {
+	Backend  Backend
+	Enabled  bool
+	Calendar string // systemd 为 OnCalendar 表达式，crontab 为前 5 个字段
+	Next     string // 下次触发时间 (仅 systemd)
+	Last     string // 上次触发时间 (仅 systemd)
+}
+
+const serviceTemplate = `[Unit]
+Description=Update MosDNS geo rules
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%s update
+`
+
+const timerTemplate = `[Unit]
+Description=Scheduled MosDNS geo rule update
+
+[Timer]
+OnCalendar=%s
+RandomizedDelaySec=%s
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`
+
+var onCalendarRegex = regexp.MustCompile(`(?m)^OnCalendar=(.+)$`)
+
+// hasSystemd 判断 systemd 是否正在管理本机 (容器里可能有 systemctl 但没有 systemd)
+func hasSystemd() bool {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return false
+	}
+	_, err := os.Stat("/run/systemd/system")
+	return err == nil
+}
+
+// CurrentBackend 返回本机使用的计划任务方式
+func CurrentBackend() Backend {
+	if hasSystemd() {
+		return BackendSystemd
+	}
+	return BackendCron
+}
+
+// Show 返回当前的自动更新计划
+func Show() (Status, error) {
+	if !hasSystemd() {
+		st := Status{Backend: BackendCron}
+		lines, err := cronLines()
+		if err != nil {
+			return st, err
+		}
+		for _, line := range lines {
+			if isUpdateLine(line) {
+				st.Enabled = true
+				st.Calendar = strings.Join(strings.Fields(line)[:5], " ")
+			}
+		}
+		return st, nil
+	}
+
+	st := Status{Backend: BackendSystemd}
+	data, err := os.ReadFile(filepath.Join(UnitDir, TimerUnit))
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if m := onCalendarRegex.FindSubmatch(data); m != nil {
+		st.Calendar = strings.TrimSpace(string(m[1]))
+	}
+	st.Enabled = exec.Command("systemctl", "is-enabled", "--quiet", TimerUnit).Run() == nil
+	out, _ := exec.Command("systemctl", "show", TimerUnit, "--property=NextElapseUSecRealtime", "--property=LastTriggerUSec").Output()
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		if value == "" || value == "n/a" {
+			continue
+		}
+		switch key {
+		case "NextElapseUSecRealtime":
+			st.Next = value
+		case "LastTriggerUSec":
+			st.Last = value
+		}
+	}
+	return st, nil
+}
+
+// Set 设置自动更新时间并启用
+// systemd 下 calendar 为 OnCalendar 表达式；crontab 下也接受常用的 OnCalendar 写法，会转换为 cron 表达式
+func Set(calendar string) error {
+	calendar = strings.TrimSpace(calendar)
+	if calendar == "" {
+		return fmt.Errorf("时间表达式不能为空")
+	}
+	if !hasSystemd() {
+		spec, err := toCron(calendar)
+		if err != nil {
+			return err
+		}
+		return setCron(spec)
+	}
+
+	if _, err := exec.LookPath("systemd-analyze"); err == nil {
+		if out, err := exec.Command("systemd-analyze", "calendar", calendar).CombinedOutput(); err != nil {
+			return fmt.Errorf("无效的 OnCalendar 表达式 %q: %s", calendar, strings.TrimSpace(string(out)))
+		}
+	}
+	if err := writeUnit(ServiceUnit, fmt.Sprintf(serviceTemplate, mosctlBin)); err != nil {
+		return err
+	}
+	if err := writeUnit(TimerUnit, fmt.Sprintf(timerTemplate, calendar, RandomDelay)); err != nil {
+		return err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl("enable", "--now", TimerUnit); err != nil {
+		return err
+	}
+	// 改用 timer 后删除 crontab 中的旧任务，避免每天更新两次
+	if _, err := removeCron(); err != nil {
+		fmt.Printf("⚠️  无法清理 crontab 中的旧任务: %v\n", err)
+	}
+	return nil
+}
+
+// Disable 停用并删除自动更新 (timer 与 crontab 中的任务都会被清理)
+func Disable() error {
+	if hasSystemd() {
+		exec.Command("systemctl", "disable", "--now", TimerUnit).Run()
+		for _, unit := range []string{TimerUnit, ServiceUnit} {
+			if err := os.Remove(filepath.Join(UnitDir, unit)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := systemctl("daemon-reload"); err != nil {
+			return err
+		}
+	}
+	if _, err := removeCron(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Migrate 把旧版安装脚本写入 crontab 的 mosctl update 迁移为 systemd timer，保留原来的时间
+// 没有 systemd、没有 crontab、没有旧任务或 timer 已存在时什么都不做；返回是否进行了迁移。
+// 时间无法转换时保留 crontab 中的任务并返回错误
+func Migrate() (bool, error) {
+	if !hasSystemd() {
+		return false, nil
+	}
+	if !hasCrontab() {
+		return false, nil
+	}
+	lines, err := cronLines()
+	if err != nil {
+		return false, err
+	}
+	spec := ""
+	for _, line := range lines {
+		if isUpdateLine(line) {
+			spec = strings.Join(strings.Fields(line)[:5], " ")
+		}
+	}
+	if spec == "" {
+		return false, nil
+	}
+	if _, err := os.Stat(filepath.Join(UnitDir, TimerUnit)); err == nil {
+		// timer 已经接管，只需要删除重复的 crontab 任务
+		_, err := removeCron()
+		return err == nil, err
+	}
+	calendar, err := fromCron(spec)
+	if err != nil {
+		return false, fmt.Errorf("无法转换 crontab 时间 %q (%v)，已保留 crontab 中的任务，可用 mosctl schedule set 手动设置", spec, err)
+	}
+	return true, Set(calendar)
+}
+
+func writeUnit(name, content string) error {
+	path := filepath.Join(UnitDir, name)
+	if old, err := os.ReadFile(path); err == nil && string(old) == content {
+		return nil
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s 失败: %s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ---------------- crontab ----------------
+
+// isUpdateLine 判断 crontab 行是否为自动更新任务
+func isUpdateLine(line string) bool {
+	line = strings.TrimSpace(line)
+	return line != "" && !strings.HasPrefix(line, "#") && strings.Contains(line, cronMarker) && len(strings.Fields(line)) > 5
+}
+
+// cronLines 读取 root 的 crontab，没有 crontab 时返回空
+// 其他读取失败必须返回错误，否则调用方会用空列表覆盖用户原有的任务
+func cronLines() ([]string, error) {
+	if !hasCrontab() {
+		return nil, fmt.Errorf("未找到 crontab 命令")
+	}
+	out, err := exec.Command("crontab", "-l").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if noCrontab(string(exitErr.Stderr)) {
+				return nil, nil
+			}
+			if msg := strings.TrimSpace(string(exitErr.Stderr)); msg != "" {
+				return nil, fmt.Errorf("读取 crontab 失败: %s", msg)
+			}
+		}
+		return nil, fmt.Errorf("读取 crontab 失败: %v", err)
+	}
+	return strings.Split(strings.TrimRight(string(out), "\n"), "\n"), nil
+}
+
+// noCrontab 根据 crontab -l 的错误输出判断是否只是还没有 crontab
+// cronie/vixie-cron 输出 "no crontab for root"，busybox 输出 "can't open 'root': No such file or directory"
+func noCrontab(stderr string) bool {
+	return strings.Contains(stderr, "no crontab for") ||
+		(strings.Contains(stderr, "can't open") && strings.Contains(stderr, "No such file"))
+}
+
+func hasCrontab() bool {
+	_, err := exec.LookPath("crontab")
+	return err == nil
+}
+
+func writeCron(lines []string) error {
+	cmd := exec.Command("crontab", "-")
+	content := strings.Join(lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	cmd.Stdin = bytes.NewBufferString(content)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("写入 crontab 失败: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// setCron 用 spec 替换 crontab 中的自动更新任务
+func setCron(spec string) error {
+	lines, err := cronLines()
+	if err != nil {
+		return err
+	}
+	var kept []string
+	for _, line := range lines {
+		if !isUpdateLine(line) && line != "" {
+			kept = append(kept, line)
+		}
+	}
+	kept = append(kept, fmt.Sprintf("%s %s update > /dev/null 2>&1", spec, mosctlBin))
+	return writeCron(kept)
+}
+
+// EnsureCron 在 crontab 中没有包含 marker 的任务时追加 line，返回是否追加
+func EnsureCron(marker, line string) (bool, error) {
+	lines, err := cronLines()
+	if err != nil {
+		return false, err
+	}
+	var kept []string
+	for _, l := range lines {
+		if strings.Contains(l, marker) && !strings.HasPrefix(strings.TrimSpace(l), "#") {
+			return false, nil
+		}
+		if l != "" {
+			kept = append(kept, l)
+		}
+	}
+	return true, writeCron(append(kept, line))
+}
+
+// RemoveCron 删除 crontab 中包含 marker 的任务，返回是否删除了任务；没有 crontab 命令时什么都不做
+func RemoveCron(marker string) (bool, error) {
+	if !hasCrontab() {
+		return false, nil
+	}
+	lines, err := cronLines()
+	if err != nil {
+		return false, err
+	}
+	if len(lines) == 0 {
+		return false, nil
+	}
+	var kept []string
+	for _, l := range lines {
+		if !strings.Contains(l, marker) || strings.HasPrefix(strings.TrimSpace(l), "#") {
+			kept = append(kept, l)
+		}
+	}
+	if len(kept) == len(lines) {
+		return false, nil
+	}
+	return true, writeCron(kept)
+}
+
+// removeCron 删除 crontab 中的自动更新任务，返回是否删除了任务
+func removeCron() (bool, error) {
+	if !hasCrontab() {
+		return false, nil
+	}
+	lines, err := cronLines()
+	if err != nil {
+		return false, err
+	}
+	if len(lines) == 0 {
+		return false, nil
+	}
+	var kept []string
+	for _, line := range lines {
+		if !isUpdateLine(line) {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == len(lines) {
+		return false, nil
+	}
+	return true, writeCron(kept)
+}
+
+var (
+	cronSpecRegex = regexp.MustCompile(`^\S+\s+\S+\s+\S+\s+\S+\s+\S+$`)
+	// [星期] [*-*-*] HH:MM[:SS]
+	simpleCalendarRegex = regexp.MustCompile(`^(?:([A-Za-z]{3}(?:,[A-Za-z]{3})*)\s+)?(?:\*-\*-\*\s+)?(\d{1,2}):(\d{2})(?::00)?$`)
+	numberRegex         = regexp.MustCompile(`^\d+$`)
+)
+
+var calendarShortcuts = map[string]string{
+	"hourly":  "0 * * * *",
+	"daily":   "0 0 * * *",
+	"weekly":  "0 0 * * 1",
+	"monthly": "0 0 1 * *",
+}
+
+var weekdays = map[string]string{"sun": "0", "mon": "1", "tue": "2", "wed": "3", "thu": "4", "fri": "5", "sat": "6"}
+
+// toCron 把常用的 OnCalendar 写法转换为 cron 表达式，5 个字段的 cron 表达式原样返回
+func toCron(calendar string) (string, error) {
+	if cronSpecRegex.MatchString(calendar) {
+		return calendar, nil
+	}
+	if spec, ok := calendarShortcuts[strings.ToLower(calendar)]; ok {
+		return spec, nil
+	}
+	m := simpleCalendarRegex.FindStringSubmatch(calendar)
+	if m == nil {
+		return "", fmt.Errorf("没有 systemd 时只支持 [星期] HH:MM、daily/weekly 等写法或 5 个字段的 cron 表达式")
+	}
+	dow := "*"
+	if m[1] != "" {
+		var days []string
+		for _, d := range strings.Split(strings.ToLower(m[1]), ",") {
+			n, ok := weekdays[d]
+			if !ok {
+				return "", fmt.Errorf("未知的星期 %q", d)
+			}
+			days = append(days, n)
+		}
+		dow = strings.Join(days, ",")
+	}
+	hour, _ := strconv.Atoi(m[2])
+	minute, _ := strconv.Atoi(m[3])
+	if hour > 23 || minute > 59 {
+		return "", fmt.Errorf("时间 %s:%s 无效，小时应为 0-23，分钟应为 0-59", m[2], m[3])
+	}
+	return fmt.Sprintf("%d %d * * %s", minute, hour, dow), nil
+}
+
+// fromCron 把 "M H * * *" 或 "M H * * D" 形式的 cron 表达式转换为 OnCalendar
+func fromCron(spec string) (string, error) {
+	f := strings.Fields(spec)
+	if len(f) != 5 || !numberRegex.MatchString(f[0]) || !numberRegex.MatchString(f[1]) || f[2] != "*" || f[3] != "*" {
+		return "", fmt.Errorf("只支持每天或每周固定时间")
+	}
+	minute, _ := strconv.Atoi(f[0])
+	hour, _ := strconv.Atoi(f[1])
+	if hour > 23 || minute > 59 {
+		return "", fmt.Errorf("时间 %s:%s 无效", f[1], f[0])
+	}
+	calendar := fmt.Sprintf("*-*-* %02d:%02d:00", hour, minute)
+	if f[4] == "*" {
+		return calendar, nil
+	}
+	names := map[string]string{"0": "Sun", "7": "Sun", "1": "Mon", "2": "Tue", "3": "Wed", "4": "Thu", "5": "Fri", "6": "Sat"}
+	var days []string
+	for _, d := range strings.Split(f[4], ",") {
+		name, ok := names[d]
+		if !ok {
+			return "", fmt.Errorf("不支持的星期字段 %q", f[4])
+		}
+		days = append(days, name)
+	}
+	return strings.Join(days, ",") + " " + calendar, nil
+}
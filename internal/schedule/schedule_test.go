@@ -0,0 +1,120 @@
+package schedule
+
+import "testing"
+
+func TestToCron(t *testing.T) {
+	tests := []struct {
+		calendar string
+		want     string
+		err      bool
+	}{
+		{"0 2 * * *", "0 2 * * *", false},
+		{"*/15 * * * 1-5", "*/15 * * * 1-5", false},
+		{"daily", "0 0 * * *", false},
+		{"Weekly", "0 0 * * 1", false},
+		{"hourly", "0 * * * *", false},
+		{"monthly", "0 0 1 * *", false},
+		{"02:00", "0 2 * * *", false},
+		{"*-*-* 02:30:00", "30 2 * * *", false},
+		{"4:05", "5 4 * * *", false},
+		{"Mon 03:00", "0 3 * * 1", false},
+		{"Sat,Sun 00:00", "0 0 * * 6,0", false},
+		{"23:59", "59 23 * * *", false},
+		{"25:99", "", true},
+		{"24:00", "", true},
+		{"12:60", "", true},
+		{"Fun 03:00", "", true},
+		{"*-*-01 02:00:00", "", true},
+		{"02:00:30", "", true},
+		{"every night", "", true},
+	}
+	for _, tt := range tests {
+		got, err := toCron(tt.calendar)
+		if (err != nil) != tt.err {
+			t.Errorf("toCron(%q) error = %v, want error %v", tt.calendar, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("toCron(%q) = %q, want %q", tt.calendar, got, tt.want)
+		}
+	}
+}
+
+func TestFromCron(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+		err  bool
+	}{
+		{"0 2 * * *", "*-*-* 02:00:00", false},
+		{"30 4 * * *", "*-*-* 04:30:00", false},
+		{"0 3 * * 1", "Mon *-*-* 03:00:00", false},
+		{"0 3 * * 7", "Sun *-*-* 03:00:00", false},
+		{"15 23 * * 1,3,5", "Mon,Wed,Fri *-*-* 23:15:00", false},
+		{"*/5 * * * *", "", true},
+		{"0 2 1 * *", "", true},
+		{"0 24 * * *", "", true},
+		{"60 2 * * *", "", true},
+		{"0 2 * * 1-5", "", true},
+		{"0 2 * *", "", true},
+	}
+	for _, tt := range tests {
+		got, err := fromCron(tt.spec)
+		if (err != nil) != tt.err {
+			t.Errorf("fromCron(%q) error = %v, want error %v", tt.spec, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("fromCron(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+// 能被 fromCron 转换的表达式再经 toCron 转回时应保持不变
+func TestCronRoundTrip(t *testing.T) {
+	for _, spec := range []string{"0 2 * * *", "5 4 * * 1", "59 23 * * 6,0"} {
+		calendar, err := fromCron(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := toCron(calendar)
+		if err != nil {
+			t.Errorf("toCron(%q): %v", calendar, err)
+			continue
+		}
+		if back != spec {
+			t.Errorf("%q -> %q -> %q", spec, calendar, back)
+		}
+	}
+}
+
+func TestIsUpdateLine(t *testing.T) {
+	tests := map[string]bool{
+		"0 2 * * * /usr/local/bin/mosctl update > /dev/null 2>&1": true,
+		"  0 2 * * * mosctl update":                               true,
+		"# 0 2 * * * /usr/local/bin/mosctl update":                false,
+		"0 3 * * * /usr/local/bin/mosctl self-update":             false,
+		"mosctl update": false,
+		"":              false,
+	}
+	for line, want := range tests {
+		if got := isUpdateLine(line); got != want {
+			t.Errorf("isUpdateLine(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestNoCrontab(t *testing.T) {
+	tests := map[string]bool{
+		"no crontab for root\n":                                   true,
+		"crontab: can't open 'root': No such file or directory\n": true,
+		"crontab: your UID isn't in the passwd file.\n":           false,
+		"/var/spool/cron: Permission denied\n":                    false,
+		"":                                                        false,
+	}
+	for stderr, want := range tests {
+		if got := noCrontab(stderr); got != want {
+			t.Errorf("noCrontab(%q) = %v, want %v", stderr, got, want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package selfupdate 从 GitHub Releases 更新 mosctl 自身
+package selfupdate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/KyleYu2024/mosctl/internal/service"
+	"github.com/KyleYu2024/mosctl/internal/version"
+)
+
+const (
+	// Repo 是 mosctl 的 GitHub 仓库
+	Repo = "KyleYu2024/mosctl"
+	// CachePath 保存最近一次查询到的最新版本，菜单据此提示升级
+	CachePath = "/var/lib/mosctl/latest.json"
+	// cacheTTL 是缓存的有效期，过期后在后台重新查询
+	cacheTTL = 24 * time.Hour
+)
+
+// AssetName 返回本机对应的发布文件名，与 release.yml 中的命名一致
+func AssetName() string {
+	name := "mosctl-" + runtime.GOOS + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func downloadURL(tag, file string) string {
+	return "https://github.com/" + Repo + "/releases/download/" + tag + "/" + file
+}
+
+// Latest 查询最新发布的版本号，并刷新缓存
+func Latest() (string, error) {
+	var rel struct {
+		Tag string `json:"tag_name"`
+	}
+	if err := service.FetchJSON("https://api.github.com/repos/"+Repo+"/releases/latest", &rel); err != nil {
+		return "", fmt.Errorf("无法查询 mosctl 最新版本: %v", err)
+	}
+	if rel.Tag == "" {
+		return "", fmt.Errorf("GitHub API 没有返回版本号")
+	}
+	saveCache(rel.Tag)
+	return rel.Tag, nil
+}
+
+// Newer 判断 latest 是否比 current 新；未注入版本号的开发构建不参与比较
+func Newer(latest, current string) bool {
+	if latest == "" || current == "" || current == "dev" {
+		return false
+	}
+	return version.Compare(latest, current) > 0
+}
+
+// Update 下载 tag 对应的 mosctl (为空表示最新版本)，按 checksums.txt 校验并试运行后原子替换正在运行的可执行文件
+// 返回安装的版本号
+func Update(tag, current string, mirrors []string) (string, error) {
+	if tag == "" {
+		latest, err := Latest()
+		if err != nil {
+			return "", err
+		}
+		tag = latest
+	}
+	if current != "dev" && version.Compare(tag, current) == 0 {
+		fmt.Printf("✔️  mosctl 已是 %s\n", current)
+		return tag, nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	dir := filepath.Dir(exe)
+	asset := AssetName()
+
+	fmt.Printf("⬇️  正在下载 %s %s...\n", asset, tag)
+	sums := filepath.Join(dir, ".mosctl-checksums.txt")
+	defer os.Remove(sums)
+	if _, err := service.DownloadFileVia(mirrors, downloadURL(tag, "checksums.txt"), sums); err != nil {
+		return "", fmt.Errorf("下载 checksums.txt 失败: %v", err)
+	}
+	want, err := checksumFor(sums, asset)
+	if err != nil {
+		return "", err
+	}
+
+	var fetched string
+	var sum string
+	for _, mirror := range service.MirrorCandidates(mirrors, downloadURL(tag, asset)) {
+		tmp, got, dlErr := service.DownloadTemp(service.MirrorURL(mirror, downloadURL(tag, asset)), exe)
+		if dlErr != nil {
+			err = fmt.Errorf("%s: %v", service.MirrorName(mirror), dlErr)
+			continue
+		}
+		fetched, sum = tmp, got
+		break
+	}
+	if fetched == "" {
+		return "", fmt.Errorf("下载 %s 失败: %v", asset, err)
+	}
+	defer os.Remove(fetched)
+	if !strings.EqualFold(sum, want) {
+		return "", fmt.Errorf("%s 的 SHA-256 与 checksums.txt 不符 (期望 %s，实际 %s)", asset, want, sum)
+	}
+	fmt.Printf("🔒 SHA-256 校验通过 (%s)\n", sum[:12])
+
+	if err := os.Chmod(fetched, 0755); err != nil {
+		return "", err
+	}
+	out, err := exec.Command(fetched, "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("新版本无法运行: %v", err)
+	}
+	installed := strings.TrimSpace(string(out))
+	if runtime.GOOS == "windows" {
+		// Windows 不能覆盖正在运行的可执行文件，但可以把它改名
+		os.Remove(exe + ".old")
+		os.Rename(exe, exe+".old")
+	}
+	if err := os.Rename(fetched, exe); err != nil {
+		return "", fmt.Errorf("替换 %s 失败: %v", exe, err)
+	}
+	saveCache(tag)
+	return installed, nil
+}
+
+// checksumFor 在 sha256sum 格式的 checksums.txt 中查找 asset
+func checksumFor(path, asset string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// 二进制模式下文件名前有 '*'
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset && len(fields[0]) == 64 {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("checksums.txt 中没有 %s", asset)
+}
+
+type cache struct {
+	Checked time.Time `json:"checked"`
+	Latest  string    `json:"latest"`
+}
+
+func saveCache(tag string) {
+	data, _ := json.Marshal(cache{Checked: time.Now(), Latest: tag})
+	if err := os.MkdirAll(filepath.Dir(CachePath), 0755); err == nil {
+		os.WriteFile(CachePath, data, 0644)
+	}
+}
+
+// Cached 返回缓存中的最新版本；stale 表示缓存不存在或已过期，需要重新查询
+func Cached() (latest string, stale bool) {
+	data, err := os.ReadFile(CachePath)
+	if err != nil {
+		return "", true
+	}
+	var c cache
+	if json.Unmarshal(data, &c) != nil {
+		return "", true
+	}
+	return c.Latest, time.Since(c.Checked) > cacheTTL
+}
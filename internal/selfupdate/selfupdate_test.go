@@ -0,0 +1,74 @@
+package selfupdate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChecksumFor(t *testing.T) {
+	sumA := strings.Repeat("a", 64)
+	sumB := strings.Repeat("B", 64)
+	content := strings.Join([]string{
+		sumA + "  mosctl-linux-amd64",
+		sumB + " *mosctl-linux-arm64",
+		strings.Repeat("c", 63) + "  mosctl-linux-386",
+		"garbage",
+		"",
+		strings.Repeat("d", 64) + "  mosctl-windows-amd64.exe extra",
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "checksums.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		asset string
+		want  string
+	}{
+		{"mosctl-linux-amd64", sumA},
+		{"mosctl-linux-arm64", strings.ToLower(sumB)},
+		{"mosctl-linux-386", ""},
+		{"mosctl-windows-amd64.exe", ""},
+		{"mosctl-darwin-arm64", ""},
+		{"mosctl-linux", ""},
+	}
+	for _, tt := range tests {
+		got, err := checksumFor(path, tt.asset)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("checksumFor(%q) = %q, want error", tt.asset, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("checksumFor(%q) = %q, %v, want %q", tt.asset, got, err, tt.want)
+		}
+	}
+
+	if _, err := checksumFor(filepath.Join(t.TempDir(), "missing.txt"), "mosctl-linux-amd64"); err == nil {
+		t.Error("missing checksums.txt did not return an error")
+	}
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v0.5.2", "v0.5.1", true},
+		{"v0.5.2", "0.5.2", false},
+		{"v0.5.10", "v0.5.9", true},
+		{"v0.6.0-rc1", "v0.6.0", false},
+		{"v0.6.0", "v0.6.0-rc1", true},
+		{"v0.5.2", "dev", false},
+		{"", "v0.5.1", false},
+		{"v0.5.2", "", false},
+	}
+	for _, tt := range tests {
+		if got := Newer(tt.latest, tt.current); got != tt.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,569 @@
+package service
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 一个只够调用 systemd 的 D-Bus 客户端：EXTERNAL 认证、方法调用与返回值解码，不处理信号
+// 优先连接 systemd 的私有套接字 (不经过 dbus-daemon，仅 root 可用)，其次连接系统总线
+const (
+	systemdPrivateSocket = "/run/systemd/private"
+	systemBusSocket      = "/run/dbus/system_bus_socket"
+	dbusTimeout          = 10 * time.Second
+	// maxDBusMessage 防止损坏的长度字段导致分配过大的内存
+	maxDBusMessage = 64 << 20
+)
+
+// D-Bus 消息类型
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+)
+
+// D-Bus 头部字段
+const (
+	fieldPath        = 1
+	fieldInterface   = 2
+	fieldMember      = 3
+	fieldErrorName   = 4
+	fieldReplySerial = 5
+	fieldDestination = 6
+	fieldSignature   = 8
+)
+
+var errDBusCorrupt = errors.New("D-Bus 消息格式错误")
+
+// DBusError 是对方返回的错误回复，例如 org.freedesktop.systemd1.NoSuchUnit
+type DBusError struct {
+	Name    string
+	Message string
+}
+
+func (e DBusError) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return e.Message
+}
+
+type dbusConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	serial uint32
+}
+
+// dbusVariant 用于编码 v 类型的参数
+type dbusVariant struct {
+	sig   string
+	value any
+}
+
+// dialDBus 连接 systemd
+func dialDBus() (*dbusConn, error) {
+	if c, err := dialDBusSocket(systemdPrivateSocket, false); err == nil {
+		return c, nil
+	}
+	path := systemBusSocket
+	if addr, ok := strings.CutPrefix(os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"), "unix:path="); ok {
+		path, _, _ = strings.Cut(addr, ",")
+	}
+	return dialDBusSocket(path, true)
+}
+
+func dialDBusSocket(path string, hello bool) (*dbusConn, error) {
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &dbusConn{conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(dbusTimeout))
+	if err := c.auth(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// 经过 dbus-daemon 时必须先 Hello 获取唯一名称
+	if hello {
+		if _, err := c.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", ""); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *dbusConn) Close() error {
+	return c.conn.Close()
+}
+
+// auth 使用 EXTERNAL 机制 (以当前 uid 认证)
+func (c *dbusConn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := c.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("D-Bus 认证失败: %s", strings.TrimSpace(line))
+	}
+	_, err = c.conn.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+// call 调用方法并等待回复，返回按签名解码后的返回值
+func (c *dbusConn) call(dest, path, iface, member, sig string, args ...any) ([]any, error) {
+	c.serial++
+	serial := c.serial
+	fields := []any{
+		[]any{byte(fieldPath), dbusVariant{"o", path}},
+		[]any{byte(fieldInterface), dbusVariant{"s", iface}},
+		[]any{byte(fieldMember), dbusVariant{"s", member}},
+	}
+	if dest != "" {
+		fields = append(fields, []any{byte(fieldDestination), dbusVariant{"s", dest}})
+	}
+	msg, err := encodeMessage(dbusMethodCall, serial, fields, sig, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.conn.SetDeadline(time.Now().Add(dbusTimeout))
+	if _, err := c.conn.Write(msg); err != nil {
+		return nil, err
+	}
+	for {
+		typ, fields, values, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if typ != dbusMethodReturn && typ != dbusError {
+			continue
+		}
+		if reply, _ := fields[fieldReplySerial].(uint32); reply != serial {
+			continue
+		}
+		if typ == dbusError {
+			e := DBusError{}
+			e.Name, _ = fields[fieldErrorName].(string)
+			if len(values) > 0 {
+				e.Message, _ = values[0].(string)
+			}
+			return nil, e
+		}
+		return values, nil
+	}
+}
+
+// encodeMessage 以小端序编码一条消息，fields 为 a(yv) 头部字段，签名字段由 sig 自动补上
+func encodeMessage(typ byte, serial uint32, fields []any, sig string, args ...any) ([]byte, error) {
+	body := &dbusEncoder{}
+	types := splitSignature(sig)
+	if len(types) != len(args) {
+		return nil, fmt.Errorf("D-Bus 参数个数与签名 %q 不符", sig)
+	}
+	for i, t := range types {
+		if err := body.value(t, args[i]); err != nil {
+			return nil, err
+		}
+	}
+	if sig != "" {
+		fields = append(fields, []any{byte(fieldSignature), dbusVariant{"g", sig}})
+	}
+
+	msg := &dbusEncoder{}
+	msg.buf = append(msg.buf, 'l', typ, 0, 1)
+	msg.uint32(uint32(len(body.buf)))
+	msg.uint32(serial)
+	if err := msg.value("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	msg.align(8)
+	return append(msg.buf, body.buf...), nil
+}
+
+// read 读取一条消息，返回类型、头部字段与解码后的消息体
+func (c *dbusConn) read() (byte, map[byte]any, []any, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(c.r, fixed); err != nil {
+		return 0, nil, nil, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	switch fixed[0] {
+	case 'l':
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return 0, nil, nil, errDBusCorrupt
+	}
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	if bodyLen > maxDBusMessage || fieldsLen > maxDBusMessage {
+		return 0, nil, nil, errDBusCorrupt
+	}
+	headerLen := (16 + int(fieldsLen) + 7) &^ 7
+	msg := make([]byte, headerLen+int(bodyLen))
+	copy(msg, fixed)
+	if _, err := io.ReadFull(c.r, msg[16:]); err != nil {
+		return 0, nil, nil, err
+	}
+
+	hdr := &dbusDecoder{data: msg[:headerLen], pos: 12, order: order}
+	raw, err := hdr.value("a(yv)")
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	fields := map[byte]any{}
+	for _, f := range raw.([]any) {
+		pair := f.([]any)
+		fields[pair[0].(byte)] = pair[1]
+	}
+
+	sig, _ := fields[fieldSignature].(string)
+	body := &dbusDecoder{data: msg[headerLen:], order: order}
+	var values []any
+	for _, t := range splitSignature(sig) {
+		v, err := body.value(t)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		values = append(values, v)
+	}
+	return fixed[1], fields, values, nil
+}
+
+// splitSignature 把签名拆成单个完整类型，例如 "sa{sv}" -> ["s", "a{sv}"]
+func splitSignature(sig string) []string {
+	var types []string
+	for sig != "" {
+		n := completeType(sig)
+		if n == 0 {
+			break
+		}
+		types = append(types, sig[:n])
+		sig = sig[n:]
+	}
+	return types
+}
+
+// completeType 返回 sig 开头第一个完整类型的长度，格式错误时返回 0
+func completeType(sig string) int {
+	if sig == "" {
+		return 0
+	}
+	switch sig[0] {
+	case 'a':
+		n := completeType(sig[1:])
+		if n == 0 {
+			return 0
+		}
+		return 1 + n
+	case '(', '{':
+		closer := byte(')')
+		if sig[0] == '{' {
+			closer = '}'
+		}
+		i := 1
+		for i < len(sig) && sig[i] != closer {
+			n := completeType(sig[i:])
+			if n == 0 {
+				return 0
+			}
+			i += n
+		}
+		if i >= len(sig) {
+			return 0
+		}
+		return i + 1
+	default:
+		return 1
+	}
+}
+
+func dbusAlignment(t byte) int {
+	switch t {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	default:
+		return 4
+	}
+}
+
+// dbusEncoder 以小端序编码
+type dbusEncoder struct {
+	buf []byte
+}
+
+func (e *dbusEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+func (e *dbusEncoder) value(t string, v any) error {
+	bad := fmt.Errorf("无法把 %T 编码为 D-Bus 类型 %s", v, t)
+	switch t[0] {
+	case 'y':
+		b, ok := v.(byte)
+		if !ok {
+			return bad
+		}
+		e.buf = append(e.buf, b)
+	case 'b':
+		b, ok := v.(bool)
+		if !ok {
+			return bad
+		}
+		if b {
+			e.uint32(1)
+		} else {
+			e.uint32(0)
+		}
+	case 'u':
+		u, ok := v.(uint32)
+		if !ok {
+			return bad
+		}
+		e.uint32(u)
+	case 's', 'o':
+		s, ok := v.(string)
+		if !ok {
+			return bad
+		}
+		e.uint32(uint32(len(s)))
+		e.buf = append(append(e.buf, s...), 0)
+	case 'g':
+		s, ok := v.(string)
+		if !ok {
+			return bad
+		}
+		e.buf = append(append(append(e.buf, byte(len(s))), s...), 0)
+	case 'v':
+		variant, ok := v.(dbusVariant)
+		if !ok {
+			return bad
+		}
+		if err := e.value("g", variant.sig); err != nil {
+			return err
+		}
+		return e.value(variant.sig, variant.value)
+	case 'a':
+		var items []any
+		switch list := v.(type) {
+		case []string:
+			for _, s := range list {
+				items = append(items, s)
+			}
+		case []any:
+			items = list
+		default:
+			return bad
+		}
+		e.uint32(0)
+		lenPos := len(e.buf) - 4
+		elem := t[1:]
+		e.align(dbusAlignment(elem[0]))
+		start := len(e.buf)
+		for _, item := range items {
+			if err := e.value(elem, item); err != nil {
+				return err
+			}
+		}
+		binary.LittleEndian.PutUint32(e.buf[lenPos:], uint32(len(e.buf)-start))
+	case '(':
+		fields, ok := v.([]any)
+		types := splitSignature(t[1 : len(t)-1])
+		if !ok || len(fields) != len(types) {
+			return bad
+		}
+		e.align(8)
+		for i, ft := range types {
+			if err := e.value(ft, fields[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return bad
+	}
+	return nil
+}
+
+type dbusDecoder struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (d *dbusDecoder) align(n int) error {
+	for d.pos%n != 0 {
+		d.pos++
+	}
+	if d.pos > len(d.data) {
+		return errDBusCorrupt
+	}
+	return nil
+}
+
+func (d *dbusDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errDBusCorrupt
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *dbusDecoder) fixed(size int) ([]byte, error) {
+	if err := d.align(size); err != nil {
+		return nil, err
+	}
+	return d.next(size)
+}
+
+// value 解码一个完整类型；v 直接返回其中的值，a{..} 返回 map[string]any，a 与 ( ) 返回 []any
+func (d *dbusDecoder) value(t string) (any, error) {
+	switch t[0] {
+	case 'y':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'n', 'q':
+		b, err := d.fixed(2)
+		if err != nil {
+			return nil, err
+		}
+		if t[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'b', 'i', 'u', 'h':
+		b, err := d.fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		v := d.order.Uint32(b)
+		switch t[0] {
+		case 'b':
+			return v != 0, nil
+		case 'i':
+			return int32(v), nil
+		}
+		return v, nil
+	case 'x', 't', 'd':
+		b, err := d.fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		v := d.order.Uint64(b)
+		switch t[0] {
+		case 'x':
+			return int64(v), nil
+		case 'd':
+			return math.Float64frombits(v), nil
+		}
+		return v, nil
+	case 's', 'o':
+		b, err := d.fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.next(int(d.order.Uint32(b)) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'g':
+		n, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.next(int(n[0]) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'v':
+		sig, err := d.value("g")
+		if err != nil {
+			return nil, err
+		}
+		if n := completeType(sig.(string)); n == 0 || n != len(sig.(string)) {
+			return nil, errDBusCorrupt
+		}
+		return d.value(sig.(string))
+	case 'a':
+		b, err := d.fixed(4)
+		if err != nil {
+			return nil, err
+		}
+		n := int(d.order.Uint32(b))
+		elem := t[1:]
+		if err := d.align(dbusAlignment(elem[0])); err != nil {
+			return nil, err
+		}
+		end := d.pos + n
+		if n > maxDBusMessage || end > len(d.data) {
+			return nil, errDBusCorrupt
+		}
+		if elem[0] == '{' {
+			m := map[string]any{}
+			for d.pos < end {
+				entry, err := d.value(elem)
+				if err != nil {
+					return nil, err
+				}
+				kv := entry.([]any)
+				m[fmt.Sprint(kv[0])] = kv[1]
+			}
+			return m, nil
+		}
+		var items []any
+		for d.pos < end {
+			item, err := d.value(elem)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case '(', '{':
+		if err := d.align(8); err != nil {
+			return nil, err
+		}
+		var fields []any
+		for _, ft := range splitSignature(t[1 : len(t)-1]) {
+			v, err := d.value(ft)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+		}
+		return fields, nil
+	default:
+		return nil, fmt.Errorf("不支持的 D-Bus 类型 %q", t)
+	}
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// readMessage 从字节流解码一条消息
+func readMessage(data []byte) (byte, map[byte]any, []any, error) {
+	c := &dbusConn{r: bufio.NewReader(bytes.NewReader(data))}
+	return c.read()
+}
+
+func TestSplitSignature(t *testing.T) {
+	tests := []struct {
+		sig  string
+		want []string
+	}{
+		{"", nil},
+		{"s", []string{"s"}},
+		{"ssbb", []string{"s", "s", "b", "b"}},
+		{"sa{sv}as", []string{"s", "a{sv}", "as"}},
+		{"a(yv)", []string{"a(yv)"}},
+		{"a(ssssssouso)", []string{"a(ssssssouso)"}},
+		{"aa{s(ut)}u", []string{"aa{s(ut)}", "u"}},
+		{"s(u", []string{"s"}}, // 不完整的类型被丢弃
+		{"a", nil},
+	}
+	for _, tt := range tests {
+		if got := splitSignature(tt.sig); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitSignature(%q) = %q, want %q", tt.sig, got, tt.want)
+		}
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	fields := []any{
+		[]any{byte(fieldPath), dbusVariant{"o", "/org/freedesktop/systemd1"}},
+		[]any{byte(fieldInterface), dbusVariant{"s", "org.freedesktop.systemd1.Manager"}},
+		[]any{byte(fieldMember), dbusVariant{"s", "EnableUnitFiles"}},
+		[]any{byte(fieldDestination), dbusVariant{"s", "org.freedesktop.systemd1"}},
+	}
+	msg, err := encodeMessage(dbusMethodCall, 42, fields, "asbb", []string{"mosdns.service", "a.timer"}, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, got, values, err := readMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != dbusMethodCall {
+		t.Errorf("type = %d, want %d", typ, dbusMethodCall)
+	}
+	wantFields := map[byte]any{
+		fieldPath:        "/org/freedesktop/systemd1",
+		fieldInterface:   "org.freedesktop.systemd1.Manager",
+		fieldMember:      "EnableUnitFiles",
+		fieldDestination: "org.freedesktop.systemd1",
+		fieldSignature:   "asbb",
+	}
+	if !reflect.DeepEqual(got, wantFields) {
+		t.Errorf("fields = %v, want %v", got, wantFields)
+	}
+	wantValues := []any{[]any{"mosdns.service", "a.timer"}, false, true}
+	if !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("values = %#v, want %#v", values, wantValues)
+	}
+}
+
+func TestGetAllReply(t *testing.T) {
+	// a{sv} 与 a(sv) 在线路上的编码相同，编码器只实现了后者
+	props := []any{
+		[]any{"ActiveState", dbusVariant{"s", "active"}},
+		[]any{"SubState", dbusVariant{"s", "running"}},
+		[]any{"NRestarts", dbusVariant{"u", uint32(3)}},
+		[]any{"Triggers", dbusVariant{"as", []string{}}},
+		[]any{"CanReload", dbusVariant{"b", false}},
+	}
+	fields := []any{[]any{byte(fieldReplySerial), dbusVariant{"u", uint32(7)}}}
+	msg, err := encodeMessage(dbusMethodReturn, 9, fields, "a(sv)", props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 把头部中的签名改写为 a{sv}，与 systemd 的真实回复一致
+	msg = bytes.Replace(msg, []byte("\x05a(sv)\x00"), []byte("\x05a{sv}\x00"), 1)
+
+	typ, got, values, err := readMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != dbusMethodReturn || got[fieldReplySerial] != uint32(7) {
+		t.Fatalf("type = %d, reply serial = %v", typ, got[fieldReplySerial])
+	}
+	want := map[string]any{
+		"ActiveState": "active",
+		"SubState":    "running",
+		"NRestarts":   uint32(3),
+		"Triggers":    []any(nil),
+		"CanReload":   false,
+	}
+	if len(values) != 1 || !reflect.DeepEqual(values[0], want) {
+		t.Errorf("values = %#v, want %#v", values, want)
+	}
+}
+
+// bigEndianReply 是手工构造的大端序方法返回：reply_serial=7，签名 "st"，消息体 ("hi", 1<<40)
+var bigEndianReply = []byte{
+	'B', dbusMethodReturn, 0, 1,
+	0, 0, 0, 16, // 消息体长度
+	0, 0, 0, 1, // serial
+	0, 0, 0, 16, // 头部字段数组长度
+	fieldReplySerial, 1, 'u', 0, 0, 0, 0, 7,
+	fieldSignature, 1, 'g', 0, 2, 's', 't', 0,
+	0, 0, 0, 2, 'h', 'i', 0, 0, // "hi" 加 8 字节对齐填充
+	0, 0, 1, 0, 0, 0, 0, 0,
+}
+
+func TestBigEndianMessage(t *testing.T) {
+	typ, fields, values, err := readMessage(bigEndianReply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != dbusMethodReturn || fields[fieldReplySerial] != uint32(7) || fields[fieldSignature] != "st" {
+		t.Errorf("type = %d, fields = %v", typ, fields)
+	}
+	want := []any{"hi", uint64(1 << 40)}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %#v, want %#v", values, want)
+	}
+}
+
+func TestTruncatedMessage(t *testing.T) {
+	msg, err := encodeMessage(dbusMethodReturn, 1,
+		[]any{[]any{byte(fieldReplySerial), dbusVariant{"u", uint32(1)}}},
+		"a(sv)", []any{[]any{"ActiveState", dbusVariant{"s", "active"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{msg, bigEndianReply} {
+		for n := 0; n < len(data); n++ {
+			if _, _, _, err := readMessage(data[:n]); err == nil {
+				t.Errorf("read of %d/%d bytes succeeded", n, len(data))
+			}
+		}
+	}
+}
+
+func TestCorruptMessage(t *testing.T) {
+	corrupt := func(edit func([]byte)) []byte {
+		data := bytes.Clone(bigEndianReply)
+		edit(data)
+		return data
+	}
+	tests := map[string][]byte{
+		"bad endianness": corrupt(func(b []byte) { b[0] = 'x' }),
+		"huge body":      corrupt(func(b []byte) { b[4] = 0xff }),
+		"huge fields":    corrupt(func(b []byte) { b[12] = 0xff }),
+		// 变体签名为空
+		"empty variant": corrupt(func(b []byte) { b[17] = 0; b[18] = 0 }),
+		// 变体签名不是单个完整类型
+		"bad variant": corrupt(func(b []byte) { b[18] = 'a' }),
+		// 字符串长度超出消息体
+		"long string": corrupt(func(b []byte) { b[35] = 0x40 }),
+	}
+	for name, data := range tests {
+		if _, _, _, err := readMessage(data); err == nil {
+			t.Errorf("%s: read succeeded", name)
+		}
+	}
+	if _, _, _, err := readMessage(corrupt(func(b []byte) { b[0] = 'x' })); !errors.Is(err, errDBusCorrupt) {
+		t.Errorf("bad endianness: err = %v, want errDBusCorrupt", err)
+	}
+}
+
+func TestEncodeRejectsMismatch(t *testing.T) {
+	if _, err := encodeMessage(dbusMethodCall, 1, nil, "ss", "only one"); err == nil {
+		t.Error("argument count mismatch accepted")
+	}
+	if _, err := encodeMessage(dbusMethodCall, 1, nil, "u", "not a number"); err == nil {
+		t.Error("type mismatch accepted")
+	}
+}
+
+// fakeBus 在 net.Pipe 的另一端扮演 systemd：完成认证后对每个方法调用执行 handle
+func fakeBus(t *testing.T, handle func(serial uint32, fields map[byte]any, args []any) [][]byte) *dbusConn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+
+	go func() {
+		srv := &dbusConn{conn: server, r: bufio.NewReader(server)}
+		line, err := srv.r.ReadString('\n')
+		uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+		if err != nil || line != "\x00AUTH EXTERNAL "+uid+"\r\n" {
+			server.Write([]byte("REJECTED EXTERNAL\r\n"))
+			return
+		}
+		server.Write([]byte("OK 0123456789abcdef\r\n"))
+		if line, err := srv.r.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+			return
+		}
+		// 客户端的 serial 从 1 开始递增
+		for serial := uint32(1); ; serial++ {
+			_, fields, args, err := srv.read()
+			if err != nil {
+				return
+			}
+			for _, reply := range handle(serial, fields, args) {
+				server.Write(reply)
+			}
+		}
+	}()
+
+	c := &dbusConn{conn: client, r: bufio.NewReader(client)}
+	if err := c.auth(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func reply(t *testing.T, typ byte, serial uint32, fields []any, sig string, args ...any) []byte {
+	t.Helper()
+	fields = append(fields, []any{byte(fieldReplySerial), dbusVariant{"u", serial}})
+	msg, err := encodeMessage(typ, 1000+serial, fields, sig, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestCall(t *testing.T) {
+	c := fakeBus(t, func(serial uint32, fields map[byte]any, args []any) [][]byte {
+		switch fields[fieldMember] {
+		case "GetUnit":
+			// 先发送一条无关的信号和一条回复其他 serial 的消息，call 应跳过它们
+			signal, _ := encodeMessage(4, 1, []any{
+				[]any{byte(fieldPath), dbusVariant{"o", "/"}},
+				[]any{byte(fieldInterface), dbusVariant{"s", "org.freedesktop.DBus"}},
+				[]any{byte(fieldMember), dbusVariant{"s", "NameAcquired"}},
+			}, "s", ":1.1")
+			return [][]byte{
+				signal,
+				reply(t, dbusMethodReturn, serial+100, nil, "o", "/wrong"),
+				reply(t, dbusMethodReturn, serial, nil, "o", "/org/freedesktop/systemd1/unit/"+args[0].(string)),
+			}
+		default:
+			return [][]byte{reply(t, dbusError, serial,
+				[]any{[]any{byte(fieldErrorName), dbusVariant{"s", "org.freedesktop.systemd1.NoSuchUnit"}}},
+				"s", "Unit missing.service not loaded.")}
+		}
+	})
+
+	values, err := c.call("org.freedesktop.systemd1", "/org/freedesktop/systemd1",
+		"org.freedesktop.systemd1.Manager", "GetUnit", "s", "mosdns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values[0] != "/org/freedesktop/systemd1/unit/mosdns" {
+		t.Errorf("GetUnit = %v", values)
+	}
+
+	_, err = c.call("org.freedesktop.systemd1", "/org/freedesktop/systemd1",
+		"org.freedesktop.systemd1.Manager", "LoadUnit", "s", "missing.service")
+	var dbusErr DBusError
+	if !errors.As(err, &dbusErr) || dbusErr.Name != "org.freedesktop.systemd1.NoSuchUnit" ||
+		!strings.Contains(dbusErr.Error(), "not loaded") {
+		t.Errorf("LoadUnit error = %#v", err)
+	}
+}
+
+func TestAuthRejected(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		bufio.NewReader(server).ReadString('\n')
+		server.Write([]byte("REJECTED EXTERNAL\r\n"))
+		server.Close()
+	}()
+	c := &dbusConn{conn: client, r: bufio.NewReader(client)}
+	if err := c.auth(); err == nil {
+		t.Error("auth succeeded after REJECTED")
+	}
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPError 表示服务器返回了非 200 的状态码
+type HTTPError struct {
+	StatusCode int
+}
+
+func (e HTTPError) Error() string {
+	return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+// Temporary 判断该状态码是否值得重试 (服务端错误、限流、超时)
+func (e HTTPError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout
+}
+
+// Fetched 是一次条件下载的结果
+type Fetched struct {
+	Temp         string // 临时文件路径，NotModified 时为空
+	SHA256       string
+	Bytes        int64
+	NotModified  bool // 服务器返回 304，本地文件仍是最新
+	ETag         string
+	LastModified string
+}
+
+// DefaultMirrors 是 GitHub 加速前缀的默认尝试顺序，空字符串表示直连 GitHub
+var DefaultMirrors = []string{"https://gh-proxy.com/", "https://ghproxy.net/", ""}
+
+// MirrorName 返回镜像的显示名称
+func MirrorName(mirror string) string {
+	if mirror == "" {
+		return "直连"
+	}
+	return mirror
+}
+
+// IsGitHubURL 判断地址是否托管在 GitHub 上 (只有这些地址需要加速前缀)
+func IsGitHubURL(url string) bool {
+	return strings.HasPrefix(url, "https://raw.githubusercontent.com/") || strings.HasPrefix(url, "https://github.com/")
+}
+
+// MirrorURL 为 GitHub 上的地址加上加速前缀，mirror 为空或非 GitHub 地址时原样返回
+func MirrorURL(mirror, url string) string {
+	if mirror != "" && IsGitHubURL(url) {
+		return mirror + url
+	}
+	return url
+}
+
+// MirrorCandidates 返回 url 需要依次尝试的镜像；非 GitHub 地址只直连一次
+func MirrorCandidates(mirrors []string, url string) []string {
+	if !IsGitHubURL(url) || len(mirrors) == 0 {
+		return []string{""}
+	}
+	return mirrors
+}
+
+// proxyOverride 由 --proxy 或 mosctl geo proxy 指定，优先于环境变量。
+// 菜单会在后台查询新版本，因此读写需要原子操作
+var proxyOverride atomic.Pointer[neturl.URL]
+
+// SetProxy 指定下载使用的代理 (http://、https://、socks5://)，空字符串表示只看环境变量
+func SetProxy(proxy string) error {
+	if proxy == "" {
+		proxyOverride.Store(nil)
+		return nil
+	}
+	u, err := ParseProxy(proxy)
+	if err != nil {
+		return err
+	}
+	proxyOverride.Store(u)
+	return nil
+}
+
+// ParseProxy 校验代理地址
+func ParseProxy(proxy string) (*neturl.URL, error) {
+	u, err := neturl.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("代理地址无效: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("不支持的代理协议 %q (可选: http、https、socks5)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("代理地址缺少主机和端口")
+	}
+	return u, nil
+}
+
+// proxyFromEnvironment 在标准库的 HTTP_PROXY/HTTPS_PROXY/NO_PROXY 之外补充 ALL_PROXY
+func proxyFromEnvironment(req *http.Request) (*neturl.URL, error) {
+	if u := proxyOverride.Load(); u != nil {
+		return u, nil
+	}
+	if u, err := http.ProxyFromEnvironment(req); u != nil || err != nil {
+		return u, err
+	}
+	for _, key := range []string{"ALL_PROXY", "all_proxy"} {
+		if v := os.Getenv(key); v != "" {
+			host := req.URL.Hostname()
+			if host == "localhost" || strings.HasPrefix(host, "127.") || host == "::1" {
+				return nil, nil
+			}
+			return ParseProxy(v)
+		}
+	}
+	return nil, nil
+}
+
+var transport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = proxyFromEnvironment
+	return t
+}()
+
+// httpClient 返回走代理设置的下载客户端
+func httpClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// DownloadFileVia 依次通过 mirrors 下载 url，返回成功的镜像
+func DownloadFileVia(mirrors []string, url, dest string) (string, error) {
+	var lastErr error
+	for _, mirror := range MirrorCandidates(mirrors, url) {
+		if err := DownloadFile(MirrorURL(mirror, url), dest); err != nil {
+			lastErr = fmt.Errorf("%s: %v", MirrorName(mirror), err)
+			continue
+		}
+		return mirror, nil
+	}
+	return "", lastErr
+}
+
+// DownloadFile downloads a file from URL to dest
+// 先写入同目录的临时文件，下载完整后再替换，中途失败不会破坏原文件
+func DownloadFile(url, dest string) error {
+	tmp, _, err := DownloadTemp(url, dest)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// DownloadTemp 把 URL 下载到 dest 同目录下的临时文件，返回临时文件路径和内容的 SHA-256
+// 调用方校验通过后用 os.Rename 原子替换 dest，失败时需自行删除临时文件
+func DownloadTemp(url, dest string) (string, string, error) {
+	f, err := DownloadIfChanged(url, dest, "", "")
+	return f.Temp, f.SHA256, err
+}
+
+// DownloadIfChanged 与 DownloadTemp 相同，但会带上 If-None-Match / If-Modified-Since，
+// 服务器返回 304 时不创建临时文件并设置 NotModified
+func DownloadIfChanged(url, dest, etag, lastModified string) (Fetched, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return Fetched{}, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := httpClient(60 * time.Second).Do(req)
+	if err != nil {
+		return Fetched{}, err
+	}
+	defer resp.Body.Close()
+
+	result := Fetched{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		return result, nil
+	}
+	if resp.StatusCode != 200 {
+		return Fetched{}, HTTPError{StatusCode: resp.StatusCode}
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".download-")
+	if err != nil {
+		return Fetched{}, err
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(out, hash), resp.Body)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && resp.ContentLength > 0 && written != resp.ContentLength {
+		err = fmt.Errorf("下载不完整 (%d/%d 字节)", written, resp.ContentLength)
+	}
+	if err == nil && written < 10 {
+		err = fmt.Errorf("下载的文件太小，可能是错误的响应")
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0644)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return Fetched{}, err
+	}
+	result.Temp = out.Name()
+	result.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	result.Bytes = written
+	return result, nil
+}
+
+// FetchChecksum 获取上游发布的 <url>.sha256sum，上游没有发布时返回空字符串
+func FetchChecksum(url string) (string, error) {
+	resp, err := httpClient(15 * time.Second).Get(url + ".sha256sum")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != 200 {
+		return "", HTTPError{StatusCode: resp.StatusCode}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	// 格式: <sha256>  <文件名>
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 || !sha256Regex.MatchString(fields[0]) {
+		return "", fmt.Errorf("校验文件格式无效")
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+var sha256Regex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// FetchJSON 请求 url 并把响应解析到 v，用于 GitHub API 等小型接口
+func FetchJSON(url string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient(15 * time.Second).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return HTTPError{StatusCode: resp.StatusCode}
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ServiceName 是 OpenRC / runit / s6 中的服务名
+const ServiceName = "mosdns"
+
+// ManagerEnv 用于强制指定后端: systemd / openrc / runit / s6 / pid
+const ManagerEnv = "MOSCTL_SERVICE_MANAGER"
+
+// ServiceManager 屏蔽不同初始化系统的差异，mosctl 对 MosDNS 服务的操作都经过它
+type ServiceManager interface {
+	// Name 返回后端名称
+	Name() string
+	Start() error
+	Stop() error
+	Restart() error
+	// Reload 重新加载配置，不支持时等同于 Restart
+	Reload() error
+	Status() (UnitStatus, error)
+	// Enable 设置开机自启，enable 为 false 时取消
+	Enable(enable bool) error
+}
+
+var (
+	managerOnce sync.Once
+	manager     ServiceManager
+)
+
+// Manager 返回当前系统使用的服务管理器，首次调用时自动检测
+func Manager() ServiceManager {
+	managerOnce.Do(func() {
+		manager = detectManager()
+	})
+	return manager
+}
+
+// detectManager 根据 InitSystem 选择后端
+func detectManager() ServiceManager {
+	switch InitSystem() {
+	case "systemd":
+		return systemdManager{unit: Unit}
+	case "openrc":
+		return openrcManager{}
+	case "runit":
+		return superviseManager{kind: "runit", dir: firstDir(runitDirs())}
+	case "s6":
+		return superviseManager{kind: "s6", dir: firstDir(s6Dirs)}
+	}
+	return pidManager{}
+}
+
+// InitSystem 依次检测 systemd、OpenRC、runit、s6，都不存在时 (如 Docker 容器) 返回 pid，
+// 表示直接管理 mosdns 进程；ManagerEnv 可以覆盖检测结果
+// 只检查初始化系统本身，不要求 mosdns 的服务文件已经安装
+func InitSystem() string {
+	switch name := os.Getenv(ManagerEnv); name {
+	case "":
+	case "systemd", "openrc", "runit", "s6", "pid":
+		return name
+	default:
+		// 输出到 stderr，避免破坏 status --json 等机器可读的输出
+		fmt.Fprintf(os.Stderr, "⚠️  未知的 %s=%s，改为自动检测\n", ManagerEnv, name)
+	}
+
+	switch {
+	case isDir("/run/systemd/system") && hasCommand(SystemCtl):
+		return "systemd"
+	case hasCommand("rc-service") && (isDir("/run/openrc") || fileExists(openrcScript)):
+		return "openrc"
+	case hasCommand("sv") && (firstDir(runitDirs()) != "" || isDir(RunitSvDir)):
+		return "runit"
+	case hasCommand("s6-svc") && (firstDir(s6Dirs) != "" || isDir("/run/service")):
+		return "s6"
+	}
+	return "pid"
+}
+
+// runService 执行服务管理命令，失败时把命令输出作为错误信息
+func runService(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func firstDir(dirs []string) string {
+	for _, dir := range dirs {
+		if isDir(dir) {
+			return dir
+		}
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"os/exec"
+	"regexp"
+)
+
+// openrcScript 是 OpenRC 的 mosdns 启动脚本
+const openrcScript = "/etc/init.d/mosdns"
+
+var openrcStatusRegex = regexp.MustCompile(`status:\s*(\w+)`)
+
+// openrcManager 通过 rc-service / rc-update 管理服务 (Alpine 等)
+type openrcManager struct{}
+
+func (openrcManager) Name() string { return "openrc" }
+
+func (openrcManager) Start() error { return runService("rc-service", ServiceName, "start") }
+
+func (openrcManager) Stop() error { return runService("rc-service", ServiceName, "stop") }
+
+func (openrcManager) Restart() error { return runService("rc-service", ServiceName, "restart") }
+
+// Reload mosdns 不支持重新加载配置，直接重启
+func (m openrcManager) Reload() error { return m.Restart() }
+
+func (openrcManager) Status() (UnitStatus, error) {
+	st := UnitStatus{Unit: ServiceName, Via: "openrc", LoadState: "loaded"}
+	if !fileExists(openrcScript) {
+		st.LoadState = "not-found"
+		st.fillProcess(0)
+		return st, nil
+	}
+	// rc-service status 在服务未运行时返回非零，只解析输出
+	out, _ := exec.Command("rc-service", ServiceName, "status").CombinedOutput()
+	state := "stopped"
+	if match := openrcStatusRegex.FindSubmatch(out); match != nil {
+		state = string(match[1])
+	}
+	switch state {
+	case "started":
+		st.fillProcess(pidOf())
+		st.ActiveState, st.SubState = "active", "running"
+	case "starting":
+		st.ActiveState, st.SubState = "activating", "start"
+	case "stopping":
+		st.ActiveState, st.SubState = "deactivating", "stop"
+	case "crashed":
+		st.ActiveState, st.SubState, st.Result = "failed", "failed", "crashed"
+	default:
+		st.ActiveState, st.SubState = "inactive", "dead"
+	}
+	return st, nil
+}
+
+func (openrcManager) Enable(enable bool) error {
+	if enable {
+		return runService("rc-update", "add", ServiceName, "default")
+	}
+	return runService("rc-update", "del", ServiceName, "default")
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// MosDNSBin 与 MosDNSDir 是容器中直接启动 mosdns 时使用的程序与工作目录
+	MosDNSBin = "/usr/local/bin/mosdns"
+	MosDNSDir = "/etc/mosdns"
+	// PIDFile 记录由 mosctl 启动的 mosdns 进程
+	PIDFile = "/run/mosdns.pid"
+	// stopTimeout 是 SIGTERM 后等待进程退出的时间，超时改用 SIGKILL
+	stopTimeout = 10 * time.Second
+)
+
+// pidManager 用于没有初始化系统的环境 (如 Docker 容器)，直接向 mosdns 进程发信号
+type pidManager struct{}
+
+func (pidManager) Name() string { return "pid" }
+
+// Start 在后台启动 mosdns，已在运行时什么都不做
+func (pidManager) Start() error {
+	if pidOf() > 0 {
+		return nil
+	}
+	if !fileExists(MosDNSBin) {
+		return fmt.Errorf("未找到 %s", MosDNSBin)
+	}
+	cmd := exec.Command(MosDNSBin, "start", "-d", MosDNSDir)
+	cmd.Dir = MosDNSDir
+	// 脱离 mosctl 的会话，mosctl 退出后 mosdns 继续运行
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("无法启动 mosdns: %v", err)
+	}
+	os.WriteFile(PIDFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644)
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		os.Remove(PIDFile)
+		return fmt.Errorf("mosdns 启动后立即退出: %v", err)
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+// Stop 发送 SIGTERM 并等待 mosdns 退出
+func (pidManager) Stop() error {
+	pid := pidOf()
+	if pid == 0 {
+		return nil
+	}
+	if pid == 1 {
+		return errors.New("mosdns 是容器的 1 号进程，请在宿主机上使用 docker stop 停止")
+	}
+	if err := terminate(pid); err != nil {
+		return err
+	}
+	os.Remove(PIDFile)
+	return nil
+}
+
+// Restart 结束 mosdns 后重新启动
+// 若 mosdns 由入口脚本或容器重启策略拉起，则等待其自行恢复，不重复启动
+func (m pidManager) Restart() error {
+	pid := pidOf()
+	if pid == 1 {
+		if err := signal(1, syscall.SIGTERM); err != nil {
+			return fmt.Errorf("无法向 mosdns 发送 SIGTERM: %v", err)
+		}
+		fmt.Println("🔁 mosdns 是容器的 1 号进程，已发送 SIGTERM，将由容器的重启策略拉起")
+		return nil
+	}
+	if pid > 0 {
+		if err := terminate(pid); err != nil {
+			return err
+		}
+		os.Remove(PIDFile)
+		for i := 0; i < 30; i++ {
+			if pidOf() > 0 {
+				return nil
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	return m.Start()
+}
+
+func (m pidManager) Reload() error { return m.Restart() }
+
+func (pidManager) Status() (UnitStatus, error) {
+	st := UnitStatus{Unit: ServiceName, Via: "pid", LoadState: "loaded"}
+	if !fileExists(MosDNSBin) {
+		st.LoadState = "not-found"
+	}
+	st.fillProcess(pidOf())
+	return st, nil
+}
+
+func (pidManager) Enable(enable bool) error {
+	return errors.New("容器中由入口脚本负责启动 mosdns，不支持设置开机自启")
+}
+
+// fillProcess 根据进程信息填充状态，pid 为 0 表示未运行
+func (s *UnitStatus) fillProcess(pid int) {
+	if pid == 0 {
+		if s.ActiveState == "" {
+			s.ActiveState, s.SubState = "inactive", "dead"
+		}
+		return
+	}
+	s.ActiveState, s.SubState = "active", "running"
+	s.MainPID = pid
+	s.Since = procStart(pid)
+	s.Memory = procRSS(pid)
+}
+
+// terminate 先发送 SIGTERM，超时后发送 SIGKILL
+func terminate(pid int) error {
+	if err := signal(pid, syscall.SIGTERM); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return nil
+		}
+		return fmt.Errorf("无法结束 mosdns (PID %d): %v", pid, err)
+	}
+	deadline := time.Now().Add(stopTimeout)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			signal(pid, syscall.SIGKILL)
+			time.Sleep(200 * time.Millisecond)
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+func signal(pid int, sig os.Signal) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+// pidOf 返回正在运行的 mosdns 进程号，优先使用 PIDFile，否则扫描 /proc
+func pidOf() int {
+	if data, err := os.ReadFile(PIDFile); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && isMosDNS(pid) {
+			return pid
+		}
+	}
+	entries, _ := os.ReadDir("/proc")
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		if isMosDNS(pid) {
+			return pid
+		}
+	}
+	return 0
+}
+
+func isMosDNS(pid int) bool {
+	comm, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	return err == nil && strings.TrimSpace(string(comm)) == ServiceName && processAlive(pid)
+}
+
+// processAlive 判断进程是否存在且不是僵尸进程
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	fields := procStatFields(string(stat))
+	return len(fields) > 0 && fields[0] != "Z" && fields[0] != "X"
+}
+
+// procStatFields 返回 /proc/<pid>/stat 中进程名之后的字段 (从 state 开始)
+func procStatFields(stat string) []string {
+	if i := strings.LastIndexByte(stat, ')'); i >= 0 {
+		stat = stat[i+1:]
+	}
+	return strings.Fields(stat)
+}
+
+// procStart 计算进程的启动时间: 开机时间 + starttime (时钟周期，按 100Hz 计)
+func procStart(pid int) time.Time {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return time.Time{}
+	}
+	fields := procStatFields(string(stat))
+	// starttime 是第 22 个字段，从 state (第 3 个) 开始计数时下标为 19
+	if len(fields) < 20 {
+		return time.Time{}
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if btime, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			boot, err := strconv.ParseInt(btime, 10, 64)
+			if err != nil {
+				break
+			}
+			return time.Unix(boot, 0).Add(time.Duration(ticks) * time.Second / 100)
+		}
+	}
+	return time.Time{}
+}
+
+// procRSS 返回进程的常驻内存 (字节)
+func procRSS(pid int) uint64 {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rss, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+			kb, _ := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(rss), " kB"), 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
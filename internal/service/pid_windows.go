@@ -0,0 +1,5 @@
+package service
+
+import "os/exec"
+
+func detach(cmd *exec.Cmd) {}
@@ -17,9 +17,12 @@ func EnableRescue() error {
 		return fmt.Errorf("无法开启内核转发: %v", err)
 	}
 
-	// 1.5 确保 INPUT 链放行 53 端口 (防止被拦截)
-	_ = runCommand("iptables", "-I", "INPUT", "-p", "udp", "--dport", "53", "-j", "ACCEPT")
-	_ = runCommand("iptables", "-I", "INPUT", "-p", "tcp", "--dport", "53", "-j", "ACCEPT")
+	// 1.5 确保 INPUT 链放行 53 端口 (防止被拦截)，已放行时不再重复添加
+	for _, proto := range []string{"udp", "tcp"} {
+		if exec.Command("iptables", "-C", "INPUT", "-p", proto, "--dport", "53", "-j", "ACCEPT").Run() != nil {
+			_ = runCommand("iptables", "-I", "INPUT", "-p", proto, "--dport", "53", "-j", "ACCEPT")
+		}
+	}
 
 	// 2. 创建并初始化自定义链
 	_ = runCommand("iptables", "-t", "nat", "-N", "MOSCTL_RESCUE")
@@ -83,6 +86,11 @@ func DisableRescue() error {
 	return nil
 }
 
+// RescueActive 判断救援模式是否开启 (PREROUTING 中存在跳转到 MOSCTL_RESCUE 的规则)
+func RescueActive() bool {
+	return exec.Command("iptables", "-t", "nat", "-C", "PREROUTING", "-j", "MOSCTL_RESCUE").Run() == nil
+}
+
 // runCommand 简单的命令封装
 func runCommand(name string, args ...string) error {
 	cmd := exec.Command(name, args...)
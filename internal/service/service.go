@@ -2,59 +2,54 @@ package service
 
 import (
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"os/exec"
 	"time"
+
+	"github.com/KyleYu2024/mosctl/internal/api"
 )
 
 const SystemCtl = "systemctl"
 
+// restartDumpTimeout 是重启前导出缓存的超时
+const restartDumpTimeout = 2 * time.Second
+
 // RestartService restarts the mosdns service
+// 重启前先通过 API 导出缓存，MosDNS 启动时会从 dump_file 重新加载
 func RestartService() error {
-	if _, err := exec.LookPath(SystemCtl); err != nil {
-		fmt.Println("⚠️  未找到 systemctl，跳过服务重载 (仅限开发环境)")
-		return nil
+	// 服务未运行时没有缓存可保存；卡住的进程也不应拖慢重启，因此只等待很短的时间
+	if st, err := GetStatus(); err == nil && st.Active() {
+		if _, err := api.Default().WithTimeout(restartDumpTimeout).SaveCache(api.CacheTag, api.DumpFile()); err != nil {
+			fmt.Printf("⚠️  重启前保存缓存失败 (将丢失上次 dump 之后的缓存): %v\n", err)
+		}
 	}
-	return exec.Command(SystemCtl, "restart", "mosdns").Run()
+	return Manager().Restart()
+}
+
+// RestartServiceDiscardCache restarts the mosdns service without saving the cache
+func RestartServiceDiscardCache() error {
+	return Manager().Restart()
 }
 
 // ReloadService reloads the mosdns service
 func ReloadService() error {
-	if _, err := exec.LookPath(SystemCtl); err != nil {
-		return nil
-	}
-	return exec.Command(SystemCtl, "reload", "mosdns").Run()
+	return Manager().Reload()
 }
 
-// DownloadFile downloads a file from URL to dest
-func DownloadFile(url, dest string) error {
-	client := http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-
-	out, err := os.Create(dest)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
+// StartService starts the mosdns service
+func StartService() error {
+	return Manager().Start()
+}
 
-	written, err := io.Copy(out, resp.Body)
-	if err != nil {
-		return err
-	}
+// StopService stops the mosdns service
+func StopService() error {
+	return Manager().Stop()
+}
 
-	if written < 10 {
-		return fmt.Errorf("下载的文件太小，可能是错误的响应")
-	}
+// EnableService 设置 mosdns 开机自启，enable 为 false 时取消
+func EnableService(enable bool) error {
+	return Manager().Enable(enable)
+}
 
-	return nil
-}
\ No newline at end of file
+// GetStatus 返回 mosdns 服务的运行状态
+func GetStatus() (UnitStatus, error) {
+	return Manager().Status()
+}
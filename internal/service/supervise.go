@@ -0,0 +1,175 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunitSvDir 存放 runit 的服务定义，启用时链接到 runsvdir 扫描的目录
+const RunitSvDir = "/etc/sv"
+
+// s6Dirs 是 s6 / s6-overlay 扫描的服务目录
+var s6Dirs = []string{"/run/service/" + ServiceName, "/var/run/s6/services/" + ServiceName, "/etc/s6/service/" + ServiceName}
+
+// runitDirs 是 runsvdir 扫描目录中的 mosdns，SVDIR 优先
+func runitDirs() []string {
+	dirs := []string{"/etc/service/" + ServiceName, "/var/service/" + ServiceName, "/service/" + ServiceName}
+	if svdir := os.Getenv("SVDIR"); svdir != "" {
+		dirs = append([]string{filepath.Join(svdir, ServiceName)}, dirs...)
+	}
+	return dirs
+}
+
+var (
+	// run: /etc/service/mosdns: (pid 123) 45s; run: log: ...
+	// down: /etc/service/mosdns: 3s, normally up, want up
+	runitStatusRegex = regexp.MustCompile(`^(\w+): [^:]+: (?:\(pid (\d+)\) )?(\d+)s`)
+	// up (pid 123) 45 seconds
+	// down (exitcode 1) 3 seconds, normally up, want up
+	s6StatusRegex = regexp.MustCompile(`^(up|down) \((?:pid (\d+)|exitcode (\d+)|signal \w+)\) (\d+) seconds`)
+)
+
+// superviseTimeout 是等待监督进程完成启停的时间 (秒)
+const superviseTimeout = 30
+
+// superviseManager 通过 runit 的 sv 或 s6 的 s6-svc 控制被监督的服务目录
+type superviseManager struct {
+	kind string // runit / s6
+	dir  string
+}
+
+func (m superviseManager) Name() string { return m.kind }
+
+func (m superviseManager) check() error {
+	if m.dir == "" {
+		return fmt.Errorf("未找到 %s 的 %s 服务目录", m.kind, ServiceName)
+	}
+	return nil
+}
+
+func (m superviseManager) Start() error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	if m.kind == "runit" {
+		return runService("sv", "-w", strconv.Itoa(superviseTimeout), "start", m.dir)
+	}
+	return runService("s6-svc", "-wu", "-T", m.timeoutMillis(), "-u", m.dir)
+}
+
+func (m superviseManager) Stop() error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	if m.kind == "runit" {
+		return runService("sv", "-w", strconv.Itoa(superviseTimeout), "stop", m.dir)
+	}
+	return runService("s6-svc", "-wd", "-T", m.timeoutMillis(), "-d", m.dir)
+}
+
+func (m superviseManager) Restart() error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	if m.kind == "runit" {
+		return runService("sv", "-w", strconv.Itoa(superviseTimeout), "restart", m.dir)
+	}
+	// s6-svc -r 只对运行中的服务有效，未运行时改为启动
+	if st, err := m.Status(); err == nil && !st.Active() {
+		return m.Start()
+	}
+	return runService("s6-svc", "-wr", "-T", m.timeoutMillis(), "-r", m.dir)
+}
+
+// Reload mosdns 不支持重新加载配置，直接重启
+func (m superviseManager) Reload() error { return m.Restart() }
+
+func (m superviseManager) Status() (UnitStatus, error) {
+	st := UnitStatus{Unit: ServiceName, Via: m.kind, LoadState: "loaded"}
+	if m.dir == "" {
+		st.LoadState = "not-found"
+		st.fillProcess(0)
+		return st, nil
+	}
+	var out []byte
+	var err error
+	if m.kind == "runit" {
+		out, err = exec.Command("sv", "status", m.dir).Output()
+	} else {
+		out, err = exec.Command("s6-svstat", m.dir).Output()
+	}
+	if err != nil {
+		return st, fmt.Errorf("无法读取 %s 的状态: %v", m.dir, err)
+	}
+	line := strings.TrimSpace(string(out))
+
+	var state, pid, exit, seconds string
+	if m.kind == "runit" {
+		match := runitStatusRegex.FindStringSubmatch(line)
+		if match == nil {
+			return st, fmt.Errorf("无法解析 sv status 的输出: %s", line)
+		}
+		state, pid, seconds = match[1], match[2], match[3]
+	} else {
+		match := s6StatusRegex.FindStringSubmatch(line)
+		if match == nil {
+			return st, fmt.Errorf("无法解析 s6-svstat 的输出: %s", line)
+		}
+		state, pid, exit, seconds = match[1], match[2], match[3], match[4]
+	}
+
+	if secs, err := strconv.Atoi(seconds); err == nil {
+		st.Since = time.Now().Add(-time.Duration(secs) * time.Second)
+	}
+	switch {
+	case state == "run" || state == "up":
+		n, _ := strconv.Atoi(pid)
+		since := st.Since
+		st.fillProcess(n)
+		st.ActiveState, st.SubState, st.Since = "active", "running", since
+	case strings.Contains(line, "want up"):
+		// 进程已退出，监督进程稍后会重新拉起
+		st.ActiveState, st.SubState = "activating", "auto-restart"
+	default:
+		st.ActiveState, st.SubState = "inactive", "dead"
+	}
+	if exit != "" {
+		st.ExitCode = "exited"
+		st.ExitStatus, _ = strconv.Atoi(exit)
+	}
+	return st, nil
+}
+
+// Enable runit 与 s6 在服务目录中存在 down 文件时不会自动启动服务
+func (m superviseManager) Enable(enable bool) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	down := filepath.Join(m.dir, "down")
+	if enable {
+		if err := os.Remove(down); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(down, nil, 0644)
+}
+
+// RunitServiceDirs 返回 runsvdir 可能扫描的目录，SVDIR 优先
+func RunitServiceDirs() []string {
+	var dirs []string
+	for _, dir := range runitDirs() {
+		dirs = append(dirs, filepath.Dir(dir))
+	}
+	return dirs
+}
+
+func (m superviseManager) timeoutMillis() string {
+	return strconv.Itoa(superviseTimeout * 1000)
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unit 是 MosDNS 的 systemd 单元
+const Unit = "mosdns.service"
+
+const (
+	systemdDest     = "org.freedesktop.systemd1"
+	systemdPath     = "/org/freedesktop/systemd1"
+	managerIface    = "org.freedesktop.systemd1.Manager"
+	unitIface       = "org.freedesktop.systemd1.Unit"
+	serviceIface    = "org.freedesktop.systemd1.Service"
+	propertiesIface = "org.freedesktop.DBus.Properties"
+	// jobTimeout 是等待 start/stop/restart 任务完成的最长时间
+	jobTimeout = 2 * time.Minute
+)
+
+// UnitStatus 是服务的运行状态
+type UnitStatus struct {
+	Unit        string
+	Via         string // 状态的来源: D-Bus 或 systemctl
+	LoadState   string // loaded / not-found ...
+	ActiveState string // active / inactive / failed / activating ...
+	SubState    string // running / dead / auto-restart ...
+	Result      string // success / exit-code / signal / timeout ...
+	MainPID     int
+	Since       time.Time // 进入当前状态的时间
+	Restarts    int       // 自动重启次数 (NRestarts)
+	Memory      uint64    // 当前内存占用，0 表示未知
+	ExitCode    string    // 主进程上次退出的方式: exited / killed / dumped
+	ExitStatus  int       // 退出码或信号编号
+}
+
+// Active 判断服务是否在运行
+func (s UnitStatus) Active() bool {
+	return s.ActiveState == "active" || s.ActiveState == "reloading"
+}
+
+// Uptime 返回服务已运行的时间，未运行时为 0
+func (s UnitStatus) Uptime() time.Duration {
+	if !s.Active() || s.Since.IsZero() {
+		return 0
+	}
+	return time.Since(s.Since).Round(time.Second)
+}
+
+// Reason 描述服务停止或失败的原因
+func (s UnitStatus) Reason() string {
+	if s.LoadState == "not-found" {
+		return "服务未安装"
+	}
+	var parts []string
+	if s.Result != "" && s.Result != "success" {
+		parts = append(parts, "结果 "+s.Result)
+	}
+	switch s.ExitCode {
+	case "exited":
+		if s.ExitStatus != 0 {
+			parts = append(parts, fmt.Sprintf("退出码 %d", s.ExitStatus))
+		}
+	case "killed", "dumped":
+		parts = append(parts, fmt.Sprintf("被信号 %d 终止", s.ExitStatus))
+	}
+	if len(parts) == 0 {
+		return s.ActiveState + "/" + s.SubState
+	}
+	return strings.Join(parts, "，")
+}
+
+// Summary 返回菜单中显示的一行状态
+func (s UnitStatus) Summary() string {
+	switch {
+	case s.Active():
+		return "🟢 运行中"
+	case s.ActiveState == "activating":
+		return "🟡 启动中"
+	case s.ActiveState == "failed":
+		return "🔴 失败 (" + s.Reason() + ")"
+	default:
+		return "🔴 未运行"
+	}
+}
+
+// systemdManager 通过 D-Bus 控制 systemd 单元，D-Bus 不可用时改用 systemctl
+type systemdManager struct {
+	unit string
+}
+
+func (systemdManager) Name() string { return "systemd" }
+
+func (m systemdManager) Start() error { return systemdJob("start", m.unit) }
+
+func (m systemdManager) Stop() error { return systemdJob("stop", m.unit) }
+
+func (m systemdManager) Restart() error { return systemdJob("restart", m.unit) }
+
+// Reload mosdns.service 没有 ExecReload，systemd 会拒绝 reload 任务，直接重启
+func (m systemdManager) Reload() error { return m.Restart() }
+
+func (m systemdManager) Status() (UnitStatus, error) { return systemdStatus(m.unit) }
+
+func (m systemdManager) Enable(enable bool) error { return systemdEnable(m.unit, enable) }
+
+// systemdJob 通过 D-Bus 执行 start/stop/restart 并等待任务完成，D-Bus 不可用时改用 systemctl
+// 启动类操作完成后服务没有运行时，返回包含失败原因的错误
+func systemdJob(action, unit string) error {
+	methods := map[string]string{"start": "StartUnit", "stop": "StopUnit", "restart": "RestartUnit"}
+	c, err := dialDBus()
+	if err != nil {
+		return runService(SystemCtl, action, unit)
+	}
+	defer c.Close()
+
+	out, err := c.call(systemdDest, systemdPath, managerIface, methods[action], "ss", unit, "replace")
+	if err != nil {
+		return err
+	}
+	job, ok := firstString(out)
+	if !ok {
+		return fmt.Errorf("systemd 没有返回任务")
+	}
+	deadline := time.Now().Add(jobTimeout)
+	for {
+		// 任务对象消失即表示任务已完成
+		_, err := c.call(systemdDest, job, propertiesIface, "Get", "ss", "org.freedesktop.systemd1.Job", "State")
+		if e, ok := err.(DBusError); ok && e.Name == "org.freedesktop.DBus.Error.UnknownObject" {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("等待 %s %s 超时", action, unit)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if action == "stop" {
+		return nil
+	}
+	st, err := c.unitStatus(unit)
+	if err != nil {
+		return err
+	}
+	if !st.Active() && st.ActiveState != "activating" {
+		return fmt.Errorf("%s 启动失败 (%s)", unit, st.Reason())
+	}
+	return nil
+}
+
+// systemdEnable 设置开机自启
+func systemdEnable(unit string, enable bool) error {
+	c, err := dialDBus()
+	if err != nil {
+		action := "enable"
+		if !enable {
+			action = "disable"
+		}
+		return runService(SystemCtl, action, unit)
+	}
+	defer c.Close()
+	if enable {
+		_, err = c.call(systemdDest, systemdPath, managerIface, "EnableUnitFiles", "asbb", []string{unit}, false, true)
+	} else {
+		_, err = c.call(systemdDest, systemdPath, managerIface, "DisableUnitFiles", "asb", []string{unit}, false)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.call(systemdDest, systemdPath, managerIface, "Reload", "")
+	return err
+}
+
+// systemdStatus 读取单元状态，D-Bus 不可用时解析 systemctl show
+func systemdStatus(unit string) (UnitStatus, error) {
+	if c, err := dialDBus(); err == nil {
+		defer c.Close()
+		return c.unitStatus(unit)
+	}
+	out, err := exec.Command(SystemCtl, "show", unit, "--property=LoadState,ActiveState,SubState,Result,MainPID,NRestarts,MemoryCurrent,ExecMainCode,ExecMainStatus,ActiveEnterTimestamp,StateChangeTimestamp").Output()
+	if err != nil {
+		return UnitStatus{}, fmt.Errorf("无法读取 %s 的状态: %v", unit, err)
+	}
+	props := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			props[key] = value
+		}
+	}
+	st := UnitStatus{
+		Unit:        unit,
+		Via:         "systemctl",
+		LoadState:   props["LoadState"],
+		ActiveState: props["ActiveState"],
+		SubState:    props["SubState"],
+		Result:      props["Result"],
+		ExitCode:    exitCodeName(props["ExecMainCode"]),
+	}
+	st.MainPID, _ = strconv.Atoi(props["MainPID"])
+	st.Restarts, _ = strconv.Atoi(props["NRestarts"])
+	st.ExitStatus, _ = strconv.Atoi(props["ExecMainStatus"])
+	st.Memory, _ = strconv.ParseUint(props["MemoryCurrent"], 10, 64)
+	since := props["StateChangeTimestamp"]
+	if st.Active() {
+		since = props["ActiveEnterTimestamp"]
+	}
+	st.Since, _ = time.Parse("Mon 2006-01-02 15:04:05 MST", since)
+	return st, nil
+}
+
+// unitStatus 通过 D-Bus 读取单元与服务的属性
+func (c *dbusConn) unitStatus(unit string) (UnitStatus, error) {
+	out, err := c.call(systemdDest, systemdPath, managerIface, "LoadUnit", "s", unit)
+	if err != nil {
+		return UnitStatus{}, err
+	}
+	path, ok := firstString(out)
+	if !ok {
+		return UnitStatus{}, fmt.Errorf("systemd 没有返回 %s 的对象路径", unit)
+	}
+	props := map[string]any{}
+	for _, iface := range []string{unitIface, serviceIface} {
+		out, err := c.call(systemdDest, path, propertiesIface, "GetAll", "s", iface)
+		if err != nil {
+			return UnitStatus{}, err
+		}
+		if len(out) == 0 {
+			continue
+		}
+		if m, ok := out[0].(map[string]any); ok {
+			for k, v := range m {
+				props[k] = v
+			}
+		}
+	}
+
+	str := func(key string) string { s, _ := props[key].(string); return s }
+	u32 := func(key string) uint32 { u, _ := props[key].(uint32); return u }
+	u64 := func(key string) uint64 { u, _ := props[key].(uint64); return u }
+	st := UnitStatus{
+		Unit:        unit,
+		Via:         "D-Bus",
+		LoadState:   str("LoadState"),
+		ActiveState: str("ActiveState"),
+		SubState:    str("SubState"),
+		Result:      str("Result"),
+		MainPID:     int(u32("MainPID")),
+		Restarts:    int(u32("NRestarts")),
+	}
+	if code, ok := props["ExecMainCode"].(int32); ok {
+		st.ExitCode = exitCodeName(strconv.Itoa(int(code)))
+	}
+	if status, ok := props["ExecMainStatus"].(int32); ok {
+		st.ExitStatus = int(status)
+	}
+	// 未启用内存统计时为 UINT64_MAX
+	if mem := u64("MemoryCurrent"); mem != math.MaxUint64 {
+		st.Memory = mem
+	}
+	since := u64("StateChangeTimestamp")
+	if st.Active() {
+		since = u64("ActiveEnterTimestamp")
+	}
+	if since > 0 {
+		st.Since = time.UnixMicro(int64(since))
+	}
+	return st, nil
+}
+
+func firstString(values []any) (string, bool) {
+	if len(values) == 0 {
+		return "", false
+	}
+	s, ok := values[0].(string)
+	return s, ok
+}
+
+// exitCodeName 把 siginfo 的 CLD_* 代码转换为名称
+func exitCodeName(code string) string {
+	switch code {
+	case "1":
+		return "exited"
+	case "2":
+		return "killed"
+	case "3":
+		return "dumped"
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+// Package version 比较 MosDNS 与 mosctl 的发布版本号
+package version
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Compare 比较 v5.3.3 / 0.5.2 / 5.3.3-rc1 形式的版本号 (忽略 v 前缀与 + 之后的构建信息)，返回 -1、0、1。
+// 主体按数字逐段比较，缺少的段视为 0；主体相同时预发布版本 (带 - 后缀) 低于正式版本，
+// 两个预发布版本按 SemVer 的规则逐段比较
+func Compare(a, b string) int {
+	coreA, preA := split(a)
+	coreB, preB := split(b)
+	if c := compareFields(strings.Split(coreA, "."), strings.Split(coreB, "."), true); c != 0 {
+		return c
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return compareFields(strings.Split(preA, "."), strings.Split(preB, "."), false)
+}
+
+// split 去掉 v 前缀与构建信息，返回主体与预发布后缀
+func split(v string) (core, pre string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "+")
+	core, pre, _ = strings.Cut(v, "-")
+	return core, pre
+}
+
+// compareFields 逐段比较。pad 为 true 时缺少的段视为 0 (5.3 == 5.3.0)，
+// 否则段数少的一方更低 (rc.1 < rc.1.1)
+func compareFields(a, b []string, pad bool) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if !pad && (i >= len(a) || i >= len(b)) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+		x, y := "0", "0"
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if c := compareField(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareField 比较单段：都是数字时按数值比较，数字低于非数字，其余按字符串比较
+func compareField(x, y string) int {
+	nx, ex := strconv.Atoi(x)
+	ny, ey := strconv.Atoi(y)
+	switch {
+	case ex == nil && ey == nil:
+		switch {
+		case nx < ny:
+			return -1
+		case nx > ny:
+			return 1
+		}
+		return 0
+	case ex == nil:
+		return -1
+	case ey == nil:
+		return 1
+	}
+	return strings.Compare(x, y)
+}
@@ -0,0 +1,30 @@
+package version
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v5.3.3", "5.3.3", 0},
+		{"v5.3.3", "v5.3.2", 1},
+		{"v5.3.10", "v5.3.9", 1},
+		{"0.5.2", "0.10.0", -1},
+		{"5.3", "5.3.0", 0},
+		{"5.3.3-rc1", "5.3.3", -1},
+		{"5.3.3", "5.3.3-rc1", 1},
+		{"5.3.3-rc1", "5.3.2", 1},
+		{"5.3.3-rc.2", "5.3.3-rc.10", -1},
+		{"5.3.3-alpha", "5.3.3-beta", -1},
+		{"5.3.3-rc.1", "5.3.3-rc.1.1", -1},
+		{"5.3.3-1", "5.3.3-alpha", -1},
+		{"5.3.3+build1", "5.3.3+build2", 0},
+		{"5.3.3-rc1+build", "5.3.3-rc1", 0},
+	}
+	for _, tt := range tests {
+		if got := Compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
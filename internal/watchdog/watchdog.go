@@ -0,0 +1,153 @@
+// Package watchdog 实现 mosctl watchdog：持续探测 MosDNS 的解析，
+// 连续失败时重启 MosDNS，重启无效时开启救援模式，恢复后关闭救援模式
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/KyleYu2024/mosctl/internal/config"
+	"github.com/KyleYu2024/mosctl/internal/service"
+)
+
+// Unit 是看门狗的 systemd 单元
+const Unit = "mosctl-watchdog.service"
+
+// Options 是 mosctl watchdog 的参数
+type Options struct {
+	Domain       string        // 探测的域名
+	Interval     time.Duration // 探测间隔
+	Timeout      time.Duration // 单次探测的超时
+	FailAfter    int           // 连续失败多少次后重启，重启后再失败同样次数时开启救援
+	RecoverAfter int           // 连续成功多少次后关闭救援，应大于 FailAfter 以免来回切换
+}
+
+// DefaultOptions 是看门狗的默认参数：约 30 秒无法解析时接管，恢复 1 分钟后回切
+var DefaultOptions = Options{
+	Domain:       config.ProbeDomestic,
+	Interval:     10 * time.Second,
+	Timeout:      3 * time.Second,
+	FailAfter:    3,
+	RecoverAfter: 6,
+}
+
+// 救援模式下再次尝试重启的间隔，每次翻倍。mosdns 启动前会关闭救援模式，
+// 因此重启不能过于频繁，否则客户端会反复短暂失去解析
+const (
+	minRestartBackoff = 5 * time.Minute
+	maxRestartBackoff = time.Hour
+)
+
+// watchdog 记录连续探测的结果
+type watchdog struct {
+	opts        Options
+	failures    int
+	successes   int
+	lastRestart int           // 上次重启时的 failures
+	nextRestart time.Time     // 早于此时间不再重启
+	backoff     time.Duration // 下次重启的间隔
+}
+
+// Run 持续探测，直到收到 SIGINT / SIGTERM
+func Run(opts Options) error {
+	if opts.FailAfter < 1 || opts.RecoverAfter < 1 {
+		return fmt.Errorf("失败与恢复次数必须大于 0")
+	}
+	if opts.Interval <= 0 || opts.Timeout <= 0 {
+		return fmt.Errorf("探测间隔与超时必须大于 0")
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	w := &watchdog{opts: opts, backoff: minRestartBackoff}
+	logf("🐕 看门狗已启动: 每 %s 通过 %s 解析 %s，连续失败 %d 次重启 mosdns，重启无效时开启救援，连续成功 %d 次关闭救援",
+		opts.Interval, config.ListenAddr(), opts.Domain, opts.FailAfter, opts.RecoverAfter)
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		w.check()
+		select {
+		case <-stop:
+			logf("🛑 看门狗已停止")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// check 执行一次探测并根据连续结果切换救援模式
+func (w *watchdog) check() {
+	st, err := service.GetStatus()
+	if err == nil && !st.Active() && st.ActiveState != "failed" {
+		// 手动停止的服务不应被拉起；进程退出由服务管理器的自动重启与 OnFailure 处理
+		if w.failures > 0 || w.successes > 0 {
+			logf("⏸️  mosdns 未运行 (%s)，暂停探测", st.Reason())
+		}
+		w.failures, w.successes, w.lastRestart = 0, 0, 0
+		return
+	}
+
+	res := config.Probe(w.opts.Domain, w.opts.Timeout)
+	if res.Err == nil {
+		w.failures, w.lastRestart = 0, 0
+		w.successes++
+		if w.successes == 1 && service.RescueActive() {
+			logf("💚 解析已恢复 (%s)，连续成功 %d 次后关闭救援模式", res.Latency.Round(time.Millisecond), w.opts.RecoverAfter)
+		}
+		if w.successes >= w.opts.RecoverAfter {
+			w.backoff = minRestartBackoff
+			if service.RescueActive() {
+				logf("🛡️  解析已连续成功 %d 次，关闭救援模式", w.successes)
+				if err := service.DisableRescue(); err != nil {
+					logf("❌ 关闭救援模式失败: %v", err)
+				}
+			}
+		}
+		return
+	}
+
+	w.successes = 0
+	w.failures++
+	probeErr := res.Err
+	// net.DNSError 会带上系统 resolv.conf 中的服务器地址，容易误导
+	if dnsErr, ok := probeErr.(*net.DNSError); ok {
+		probeErr = errors.New(dnsErr.Err)
+	}
+	logf("⚠️  第 %d 次解析 %s 失败: %v", w.failures, w.opts.Domain, probeErr)
+	if w.failures < w.opts.FailAfter {
+		return
+	}
+	// 重启无效时不再每轮重启，而是在救援模式下按退避间隔重试；
+	// 退避期内再次达到阈值时跳过重启，直接开启救援
+	confirm := w.lastRestart + w.opts.FailAfter
+	switch {
+	case (w.failures == w.opts.FailAfter || w.failures > confirm) && !time.Now().Before(w.nextRestart):
+		w.restart()
+	case w.failures == confirm && !service.RescueActive():
+		// mosdns 启动前会关闭救援模式，因此确认重启无效后才开启，直到解析连续成功 RecoverAfter 次
+		logf("🛟 连续 %d 次解析失败且重启无效，开启救援模式", w.failures)
+		if err := service.EnableRescue(); err != nil {
+			logf("❌ 开启救援模式失败: %v", err)
+		}
+	}
+}
+
+// restart 重启 mosdns 并推迟下一次重启
+func (w *watchdog) restart() {
+	logf("🔁 连续 %d 次解析失败，正在重启 mosdns...", w.failures)
+	if err := service.RestartService(); err != nil {
+		logf("❌ 重启 mosdns 失败: %v", err)
+	}
+	w.lastRestart = w.failures
+	w.nextRestart = time.Now().Add(w.backoff)
+	w.backoff = min(w.backoff*2, maxRestartBackoff)
+}
+
+func logf(format string, args ...any) {
+	fmt.Printf(time.Now().Format("2006-01-02 15:04:05")+" "+format+"\n", args...)
+}
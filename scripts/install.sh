@@ -28,6 +28,9 @@ touch /etc/mosdns/rules/force-cn.txt
 touch /etc/mosdns/rules/force-nocn.txt
 touch /etc/mosdns/rules/hosts.txt
 touch /etc/mosdns/rules/user_iot.txt
+touch /etc/mosdns/rules/block.txt
+touch /etc/mosdns/rules/block-allow.txt
+touch /etc/mosdns/rules/geosite_block.txt
 
 # 5. 安装 Systemd 服务
 echo ">>> 安装 Systemd 服务..."
@@ -0,0 +1,18 @@
+// Package templates 内嵌 mosctl install 使用的配置文件与服务模板
+package templates
+
+import "embed"
+
+// FS 包含本目录下的全部模板
+//
+//go:embed config.yaml mosdns.service mosdns-rescue.service mosdns.openrc mosdns.run mosdns.logrotate mosctl-watchdog.service
+var FS embed.FS
+
+// Read 读取内嵌的模板
+func Read(name string) []byte {
+	data, err := FS.ReadFile(name)
+	if err != nil {
+		panic("templates: " + err.Error())
+	}
+	return data
+}